@@ -4,4 +4,6 @@ package api
 type Config struct {
 	EnableCORS bool
 	Listen     string
+	// MetricsTTLSeconds is a time metrics are kept in Moira for, it limits history available to local triggers
+	MetricsTTLSeconds int64
 }
@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"sort"
+
 	"github.com/moira-alert/moira"
 	"github.com/moira-alert/moira/api"
 	"github.com/moira-alert/moira/api/dto"
@@ -12,6 +14,10 @@ func GetAllPatterns(database moira.Database, logger moira.Logger) (*dto.PatternL
 	if err != nil {
 		return nil, api.ErrorInternalServer(err)
 	}
+	limitedPatterns, err := database.GetLimitedPatterns(patterns)
+	if err != nil {
+		return nil, api.ErrorInternalServer(err)
+	}
 	pattersList := dto.PatternList{
 		List: make([]dto.PatternData, 0, len(patterns)),
 	}
@@ -20,32 +26,20 @@ func GetAllPatterns(database moira.Database, logger moira.Logger) (*dto.PatternL
 
 	for _, pattern := range patterns {
 		go func(pattern string) {
-			triggerIDs, err := database.GetPatternTriggerIDs(pattern)
-			if err != nil {
-				logger.Error(err.Error())
-				rch <- nil
-			}
-			triggers, err := database.GetTriggers(triggerIDs)
+			metrics, err := database.GetPatternMetrics(pattern)
 			if err != nil {
 				logger.Error(err.Error())
 				rch <- nil
+				return
 			}
-			metrics, err := database.GetPatternMetrics(pattern)
+			patternData, err := getPatternData(database, pattern, metrics, int64(len(metrics)))
 			if err != nil {
 				logger.Error(err.Error())
 				rch <- nil
+				return
 			}
-			patternData := dto.PatternData{
-				Pattern:  pattern,
-				Triggers: make([]dto.TriggerModel, 0),
-				Metrics:  metrics,
-			}
-			for _, trigger := range triggers {
-				if trigger != nil {
-					patternData.Triggers = append(patternData.Triggers, dto.CreateTriggerModel(trigger))
-				}
-			}
-			rch <- &patternData
+			_, patternData.Limited = limitedPatterns[pattern]
+			rch <- patternData
 		}(pattern)
 	}
 
@@ -58,6 +52,74 @@ func GetAllPatterns(database moira.Database, logger moira.Logger) (*dto.PatternL
 	return &pattersList, nil
 }
 
+// GetTopPatterns gets given page of patterns sorted by number of their metrics in descending order with triggers of them.
+// Metrics of patterns are not listed, only their number
+func GetTopPatterns(database moira.Database, page, size int64) (*dto.PatternList, *api.ErrorResponse) {
+	patterns, err := database.GetPatterns()
+	if err != nil {
+		return nil, api.ErrorInternalServer(err)
+	}
+	metricsCount, err := database.GetPatternsMetricsCount(patterns)
+	if err != nil {
+		return nil, api.ErrorInternalServer(err)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if metricsCount[patterns[i]] != metricsCount[patterns[j]] {
+			return metricsCount[patterns[i]] > metricsCount[patterns[j]]
+		}
+		return patterns[i] < patterns[j]
+	})
+
+	topPatterns := make([]string, 0)
+	if from := page * size; from >= 0 && from < int64(len(patterns)) {
+		to := from + size
+		if to > int64(len(patterns)) {
+			to = int64(len(patterns))
+		}
+		topPatterns = patterns[from:to]
+	}
+	limitedPatterns, err := database.GetLimitedPatterns(topPatterns)
+	if err != nil {
+		return nil, api.ErrorInternalServer(err)
+	}
+
+	patternsList := dto.PatternList{
+		List: make([]dto.PatternData, 0, len(topPatterns)),
+	}
+	for _, pattern := range topPatterns {
+		patternData, err := getPatternData(database, pattern, make([]string, 0), metricsCount[pattern])
+		if err != nil {
+			return nil, api.ErrorInternalServer(err)
+		}
+		_, patternData.Limited = limitedPatterns[pattern]
+		patternsList.List = append(patternsList.List, *patternData)
+	}
+	return &patternsList, nil
+}
+
+func getPatternData(database moira.Database, pattern string, metrics []string, metricsCount int64) (*dto.PatternData, error) {
+	triggerIDs, err := database.GetPatternTriggerIDs(pattern)
+	if err != nil {
+		return nil, err
+	}
+	triggers, err := database.GetTriggers(triggerIDs)
+	if err != nil {
+		return nil, err
+	}
+	patternData := dto.PatternData{
+		Pattern:      pattern,
+		Triggers:     make([]dto.TriggerModel, 0),
+		Metrics:      metrics,
+		MetricsCount: metricsCount,
+	}
+	for _, trigger := range triggers {
+		if trigger != nil {
+			patternData.Triggers = append(patternData.Triggers, dto.CreateTriggerModel(trigger))
+		}
+	}
+	return &patternData, nil
+}
+
 // DeletePattern deletes trigger pattern
 func DeletePattern(database moira.Database, pattern string) *api.ErrorResponse {
 	if err := database.RemovePattern(pattern); err != nil {
@@ -44,11 +44,12 @@ func TestGetAllPatterns(t *testing.T) {
 		triggers := []*dto.TriggerModel{{ID: uuid.NewV4().String()}, {ID: uuid.NewV4().String()}}
 		metrics := []string{"my.first.metric"}
 		dataBase.EXPECT().GetPatterns().Return([]string{pattern1}, nil)
+		dataBase.EXPECT().GetLimitedPatterns([]string{pattern1}).Return(map[string]int64{}, nil)
 		expectGettingPatternList(dataBase, pattern1, triggers, metrics)
 		list, err := GetAllPatterns(dataBase, logger)
 		So(err, ShouldBeNil)
 		So(list, ShouldResemble, &dto.PatternList{
-			List: []dto.PatternData{{Metrics: metrics, Pattern: pattern1, Triggers: []dto.TriggerModel{*triggers[0], *triggers[1]}}},
+			List: []dto.PatternData{{Metrics: metrics, MetricsCount: 1, Pattern: pattern1, Triggers: []dto.TriggerModel{*triggers[0], *triggers[1]}}},
 		})
 	})
 
@@ -58,6 +59,7 @@ func TestGetAllPatterns(t *testing.T) {
 		metrics1 := []string{"my.first.metric"}
 		metrics2 := []string{"my.second.metric"}
 		dataBase.EXPECT().GetPatterns().Return([]string{pattern1, pattern2}, nil)
+		dataBase.EXPECT().GetLimitedPatterns([]string{pattern1, pattern2}).Return(map[string]int64{pattern2: 1}, nil)
 		expectGettingPatternList(dataBase, pattern1, triggers1, metrics1)
 		expectGettingPatternList(dataBase, pattern2, triggers2, metrics2)
 		list, err := GetAllPatterns(dataBase, logger)
@@ -65,10 +67,10 @@ func TestGetAllPatterns(t *testing.T) {
 		So(list.List, ShouldHaveLength, 2)
 		for _, patternStat := range list.List {
 			if patternStat.Pattern == pattern1 {
-				So(patternStat, ShouldResemble, dto.PatternData{Metrics: metrics1, Pattern: pattern1, Triggers: []dto.TriggerModel{*triggers1[0], *triggers1[1]}})
+				So(patternStat, ShouldResemble, dto.PatternData{Metrics: metrics1, MetricsCount: 1, Pattern: pattern1, Triggers: []dto.TriggerModel{*triggers1[0], *triggers1[1]}})
 			}
 			if patternStat.Pattern == pattern2 {
-				So(patternStat, ShouldResemble, dto.PatternData{Metrics: metrics2, Pattern: pattern2, Triggers: []dto.TriggerModel{*triggers2[0]}})
+				So(patternStat, ShouldResemble, dto.PatternData{Metrics: metrics2, MetricsCount: 1, Limited: true, Pattern: pattern2, Triggers: []dto.TriggerModel{*triggers2[0]}})
 			}
 		}
 	})
@@ -84,7 +86,55 @@ func TestGetAllPatterns(t *testing.T) {
 	})
 }
 
+func TestGetTopPatterns(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	dataBase := mock_moira_alert.NewMockDatabase(mockCtrl)
+	defer mockCtrl.Finish()
+	patterns := []string{"my.first.pattern", "my.second.pattern", "my.third.pattern"}
+	metricsCount := map[string]int64{"my.first.pattern": 10, "my.second.pattern": 1000, "my.third.pattern": 100}
+
+	Convey("Should return patterns sorted by metrics count", t, func() {
+		triggers := []*dto.TriggerModel{{ID: "1111"}}
+		dataBase.EXPECT().GetPatterns().Return(patterns, nil)
+		dataBase.EXPECT().GetPatternsMetricsCount(patterns).Return(metricsCount, nil)
+		dataBase.EXPECT().GetLimitedPatterns([]string{"my.second.pattern", "my.third.pattern"}).Return(map[string]int64{"my.second.pattern": 1000}, nil)
+		expectGettingPatternTriggers(dataBase, "my.second.pattern", triggers)
+		expectGettingPatternTriggers(dataBase, "my.third.pattern", triggers)
+		list, err := GetTopPatterns(dataBase, 0, 2)
+		So(err, ShouldBeNil)
+		So(list, ShouldResemble, &dto.PatternList{
+			List: []dto.PatternData{
+				{Metrics: []string{}, MetricsCount: 1000, Limited: true, Pattern: "my.second.pattern", Triggers: []dto.TriggerModel{*triggers[0]}},
+				{Metrics: []string{}, MetricsCount: 100, Pattern: "my.third.pattern", Triggers: []dto.TriggerModel{*triggers[0]}},
+			},
+		})
+	})
+
+	Convey("Should return empty list for page after the last pattern", t, func() {
+		dataBase.EXPECT().GetPatterns().Return(patterns, nil)
+		dataBase.EXPECT().GetPatternsMetricsCount(patterns).Return(metricsCount, nil)
+		dataBase.EXPECT().GetLimitedPatterns([]string{}).Return(map[string]int64{}, nil)
+		list, err := GetTopPatterns(dataBase, 1, 10)
+		So(err, ShouldBeNil)
+		So(list.List, ShouldBeEmpty)
+	})
+
+	Convey("GetPatternsMetricsCount error", t, func() {
+		expected := fmt.Errorf("oh no!!!11 Cant count metrics")
+		dataBase.EXPECT().GetPatterns().Return(patterns, nil)
+		dataBase.EXPECT().GetPatternsMetricsCount(patterns).Return(nil, expected)
+		list, err := GetTopPatterns(dataBase, 0, 10)
+		So(err, ShouldResemble, api.ErrorInternalServer(expected))
+		So(list, ShouldBeNil)
+	})
+}
+
 func expectGettingPatternList(database *mock_moira_alert.MockDatabase, pattern string, triggers []*dto.TriggerModel, metrics []string) {
+	database.EXPECT().GetPatternMetrics(pattern).Return(metrics, nil)
+	expectGettingPatternTriggers(database, pattern, triggers)
+}
+
+func expectGettingPatternTriggers(database *mock_moira_alert.MockDatabase, pattern string, triggers []*dto.TriggerModel) {
 	tr := make([]*moira.Trigger, 0)
 	for _, trigger := range triggers {
 		tr = append(tr, trigger.ToMoiraTrigger())
@@ -92,5 +142,4 @@ func expectGettingPatternList(database *mock_moira_alert.MockDatabase, pattern s
 
 	database.EXPECT().GetPatternTriggerIDs(pattern).Return([]string{pattern}, nil)
 	database.EXPECT().GetTriggers([]string{pattern}).Return(tr, nil)
-	database.EXPECT().GetPatternMetrics(pattern).Return(metrics, nil)
 }
@@ -25,6 +25,9 @@ func UpdateTrigger(dataBase moira.Database, trigger *dto.TriggerModel, triggerID
 
 // saveTrigger create or update trigger data and update trigger metrics in last state
 func saveTrigger(dataBase moira.Database, trigger *moira.Trigger, triggerID string, timeSeriesNames map[string]bool) (*dto.SaveTriggerResponse, *api.ErrorResponse) {
+	if err := checkTriggerDependencies(dataBase, trigger, triggerID); err != nil {
+		return nil, err
+	}
 	if err := dataBase.AcquireTriggerCheckLock(triggerID, 10); err != nil {
 		return nil, api.ErrorInternalServer(err)
 	}
@@ -67,6 +70,81 @@ func saveTrigger(dataBase moira.Database, trigger *moira.Trigger, triggerID stri
 	return &resp, nil
 }
 
+// checkTriggerDependencies checks that parent triggers exist and trigger does not depend on itself directly or through its parents.
+// Input triggers of composite triggers, including ones selected by tags, are walked as parents too, so inputs can not form a cycle
+func checkTriggerDependencies(dataBase moira.Database, trigger *moira.Trigger, triggerID string) *api.ErrorResponse {
+	cycleError := api.ErrorInvalidRequest(fmt.Errorf("trigger can not depend on itself, check dependencies of trigger %s", triggerID))
+	dependencies := make(map[string]bool, len(trigger.Dependencies))
+	for _, parentID := range trigger.Dependencies {
+		dependencies[parentID] = true
+	}
+	checked := make(map[string]bool)
+	parentIDs, err := getTriggerParentIDs(dataBase, trigger, triggerID)
+	if err != nil {
+		return api.ErrorInternalServer(err)
+	}
+	for level := 0; len(parentIDs) > 0; level++ {
+		for _, parentID := range parentIDs {
+			if parentID == triggerID {
+				return cycleError
+			}
+			checked[parentID] = true
+		}
+		parents, err := dataBase.GetTriggers(parentIDs)
+		if err != nil {
+			return api.ErrorInternalServer(err)
+		}
+		grandParentIDs := make([]string, 0)
+		for i, parent := range parents {
+			if parent == nil {
+				if level == 0 && dependencies[parentIDs[i]] {
+					return api.ErrorInvalidRequest(fmt.Errorf("dependency trigger with ID = '%s' does not exists", parentIDs[i]))
+				}
+				continue
+			}
+			// saved tags of trigger can differ from given ones, so tags selecting trigger as input are checked with given ones
+			if parent.Composite != nil && parent.Composite.HasInput(triggerID, trigger.Tags) {
+				return cycleError
+			}
+			parentParentIDs, err := getTriggerParentIDs(dataBase, parent, triggerID)
+			if err != nil {
+				return api.ErrorInternalServer(err)
+			}
+			for _, grandParentID := range parentParentIDs {
+				if !checked[grandParentID] {
+					checked[grandParentID] = true
+					grandParentIDs = append(grandParentIDs, grandParentID)
+				}
+			}
+		}
+		parentIDs = grandParentIDs
+	}
+	return nil
+}
+
+// getTriggerParentIDs returns IDs of triggers which given trigger depends on and of its composite input triggers.
+// Triggers selected by composite tags are found by saved tags, so checked trigger is not selected by them
+func getTriggerParentIDs(dataBase moira.Database, trigger *moira.Trigger, checkedTriggerID string) ([]string, error) {
+	parentIDs := append(make([]string, 0, len(trigger.Dependencies)), trigger.Dependencies...)
+	if trigger.Composite == nil {
+		return parentIDs, nil
+	}
+	parentIDs = append(parentIDs, trigger.Composite.TriggerIDs...)
+	if len(trigger.Composite.Tags) == 0 {
+		return parentIDs, nil
+	}
+	tagsTriggerIDs, err := dataBase.GetTriggerCheckIDs(trigger.Composite.Tags, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, tagsTriggerID := range tagsTriggerIDs {
+		if tagsTriggerID != checkedTriggerID && tagsTriggerID != trigger.ID {
+			parentIDs = append(parentIDs, tagsTriggerID)
+		}
+	}
+	return parentIDs, nil
+}
+
 // GetTrigger gets trigger with his throttling - next allowed message time
 func GetTrigger(dataBase moira.Database, triggerID string) (*dto.Trigger, *api.ErrorResponse) {
 	trigger, err := dataBase.GetTrigger(triggerID)
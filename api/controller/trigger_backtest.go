@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/api"
+	"github.com/moira-alert/moira/api/dto"
+	"github.com/moira-alert/moira/checker"
+	"github.com/moira-alert/moira/database"
+	"github.com/moira-alert/moira/remote"
+)
+
+// BacktestTrigger replays checks of given trigger over historical data and returns events it would have generated
+// and time which its metrics spent in every state, nothing is saved to database.
+// Local trigger can be replayed only over metrics kept for given metrics TTL in seconds
+func BacktestTrigger(dataBase moira.Database, logger moira.Logger, remoteConfig *remote.Config, metricsTTL int64, trigger *dto.TriggerModel, from, to, checkInterval int64) (*dto.TriggerBacktest, *api.ErrorResponse) {
+	return backtestTrigger(dataBase, logger, remoteConfig, metricsTTL, trigger.ToMoiraTrigger(), from, to, checkInterval)
+}
+
+// BacktestExistingTrigger replays checks of saved trigger over historical data, nothing is saved to database
+func BacktestExistingTrigger(dataBase moira.Database, logger moira.Logger, remoteConfig *remote.Config, metricsTTL int64, triggerID string, from, to, checkInterval int64) (*dto.TriggerBacktest, *api.ErrorResponse) {
+	trigger, err := dataBase.GetTrigger(triggerID)
+	if err != nil {
+		if err == database.ErrNil {
+			return nil, api.ErrorNotFound("trigger not found")
+		}
+		return nil, api.ErrorInternalServer(err)
+	}
+	return backtestTrigger(dataBase, logger, remoteConfig, metricsTTL, &trigger, from, to, checkInterval)
+}
+
+func backtestTrigger(dataBase moira.Database, logger moira.Logger, remoteConfig *remote.Config, metricsTTL int64, trigger *moira.Trigger, from, to, checkInterval int64) (*dto.TriggerBacktest, *api.ErrorResponse) {
+	if trigger.IsRemote && !remoteConfig.IsEnabled() {
+		return nil, api.ErrorInvalidRequest(remote.ErrRemoteStorageDisabled)
+	}
+	result, err := checker.Backtest(dataBase, logger, remoteConfig, metricsTTL, trigger, from, to, checkInterval)
+	if err != nil {
+		switch err.(type) {
+		case checker.ErrInvalidBacktest:
+			return nil, api.ErrorInvalidRequest(err)
+		case remote.ErrRemoteTriggerResponse:
+			return nil, api.ErrorRemoteServerUnavailable(err)
+		default:
+			return nil, api.ErrorInternalServer(err)
+		}
+	}
+	return &dto.TriggerBacktest{
+		Events:      result.Events,
+		TimeInState: result.TimeInState,
+	}, nil
+}
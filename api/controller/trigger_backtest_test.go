@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	"github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/api"
+	"github.com/moira-alert/moira/database"
+	"github.com/moira-alert/moira/mock/moira-alert"
+	"github.com/moira-alert/moira/remote"
+)
+
+func TestBacktestExistingTrigger(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dataBase := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("Test")
+	triggerID := uuid.NewV4().String()
+
+	Convey("No trigger", t, func() {
+		dataBase.EXPECT().GetTrigger(triggerID).Return(moira.Trigger{}, database.ErrNil)
+		backtest, err := BacktestExistingTrigger(dataBase, logger, &remote.Config{}, 0, triggerID, 0, 3600, 60)
+		So(err, ShouldResemble, api.ErrorNotFound("trigger not found"))
+		So(backtest, ShouldBeNil)
+	})
+
+	Convey("Get trigger error", t, func() {
+		expected := fmt.Errorf("oooops! Can not get trigger")
+		dataBase.EXPECT().GetTrigger(triggerID).Return(moira.Trigger{}, expected)
+		backtest, err := BacktestExistingTrigger(dataBase, logger, &remote.Config{}, 0, triggerID, 0, 3600, 60)
+		So(err, ShouldResemble, api.ErrorInternalServer(expected))
+		So(backtest, ShouldBeNil)
+	})
+
+	Convey("Remote trigger with disabled remote storage", t, func() {
+		dataBase.EXPECT().GetTrigger(triggerID).Return(moira.Trigger{ID: triggerID, IsRemote: true}, nil)
+		backtest, err := BacktestExistingTrigger(dataBase, logger, &remote.Config{}, 0, triggerID, 0, 3600, 60)
+		So(err, ShouldResemble, api.ErrorInvalidRequest(remote.ErrRemoteStorageDisabled))
+		So(backtest, ShouldBeNil)
+	})
+
+	Convey("Invalid time range", t, func() {
+		dataBase.EXPECT().GetTrigger(triggerID).Return(moira.Trigger{ID: triggerID}, nil)
+		backtest, err := BacktestExistingTrigger(dataBase, logger, &remote.Config{}, 0, triggerID, 3600, 0, 60)
+		So(err.HTTPStatusCode, ShouldEqual, 400)
+		So(err.ErrorText, ShouldEqual, "from should be less than until")
+		So(backtest, ShouldBeNil)
+	})
+}
@@ -151,6 +151,72 @@ func TestSaveTrigger(t *testing.T) {
 	})
 }
 
+func TestCheckTriggerDependencies(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dataBase := mock_moira_alert.NewMockDatabase(mockCtrl)
+	triggerID := uuid.NewV4().String()
+
+	Convey("Existing parents without cycle", t, func() {
+		dataBase.EXPECT().GetTriggers([]string{"parent1", "parent2"}).Return([]*moira.Trigger{{ID: "parent1", Dependencies: []string{"parent2", "grandParent"}}, {ID: "parent2"}}, nil)
+		dataBase.EXPECT().GetTriggers([]string{"grandParent"}).Return([]*moira.Trigger{nil}, nil)
+		err := checkTriggerDependencies(dataBase, &moira.Trigger{Dependencies: []string{"parent1", "parent2"}}, triggerID)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Not existing parent", t, func() {
+		dataBase.EXPECT().GetTriggers([]string{"parent1"}).Return([]*moira.Trigger{nil}, nil)
+		err := checkTriggerDependencies(dataBase, &moira.Trigger{Dependencies: []string{"parent1"}}, triggerID)
+		So(err, ShouldResemble, api.ErrorInvalidRequest(fmt.Errorf("dependency trigger with ID = 'parent1' does not exists")))
+	})
+
+	Convey("Dependency on itself", t, func() {
+		expected := api.ErrorInvalidRequest(fmt.Errorf("trigger can not depend on itself, check dependencies of trigger %s", triggerID))
+		err := checkTriggerDependencies(dataBase, &moira.Trigger{Dependencies: []string{triggerID}}, triggerID)
+		So(err, ShouldResemble, expected)
+
+		dataBase.EXPECT().GetTriggers([]string{"parent1"}).Return([]*moira.Trigger{{ID: "parent1", Dependencies: []string{triggerID}}}, nil)
+		err = checkTriggerDependencies(dataBase, &moira.Trigger{Dependencies: []string{"parent1"}}, triggerID)
+		So(err, ShouldResemble, expected)
+	})
+
+	Convey("Composite inputs", t, func() {
+		expected := api.ErrorInvalidRequest(fmt.Errorf("trigger can not depend on itself, check dependencies of trigger %s", triggerID))
+
+		Convey("Without cycle", func() {
+			trigger := &moira.Trigger{ID: triggerID, Tags: []string{"own"}, Composite: &moira.CompositeData{TriggerIDs: []string{"input1"}, Tags: []string{"inputs"}}}
+			dataBase.EXPECT().GetTriggerCheckIDs([]string{"inputs"}, false).Return([]string{"input2", triggerID}, nil)
+			dataBase.EXPECT().GetTriggers([]string{"input1", "input2"}).Return([]*moira.Trigger{{ID: "input1"}, {ID: "input2", Dependencies: []string{"input1"}}}, nil)
+			err := checkTriggerDependencies(dataBase, trigger, triggerID)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Input composite has trigger as input", func() {
+			trigger := &moira.Trigger{ID: triggerID, Composite: &moira.CompositeData{TriggerIDs: []string{"input1"}}}
+			dataBase.EXPECT().GetTriggers([]string{"input1"}).Return([]*moira.Trigger{{ID: "input1", Composite: &moira.CompositeData{TriggerIDs: []string{"input2"}}}}, nil)
+			dataBase.EXPECT().GetTriggers([]string{"input2"}).Return([]*moira.Trigger{{ID: "input2", Composite: &moira.CompositeData{TriggerIDs: []string{triggerID}}}}, nil)
+			err := checkTriggerDependencies(dataBase, trigger, triggerID)
+			So(err, ShouldResemble, expected)
+		})
+
+		Convey("Input composite selects trigger by its tags", func() {
+			trigger := &moira.Trigger{ID: triggerID, Tags: []string{"new", "selected"}, Composite: &moira.CompositeData{TriggerIDs: []string{"input1"}}}
+			dataBase.EXPECT().GetTriggers([]string{"input1"}).Return([]*moira.Trigger{{ID: "input1", Composite: &moira.CompositeData{Tags: []string{"selected"}}}}, nil)
+			err := checkTriggerDependencies(dataBase, trigger, triggerID)
+			So(err, ShouldResemble, expected)
+		})
+
+		Convey("Trigger depends on composite having it as input", func() {
+			trigger := &moira.Trigger{ID: triggerID, Tags: []string{"own"}, Dependencies: []string{"parent1"}}
+			dataBase.EXPECT().GetTriggers([]string{"parent1"}).Return([]*moira.Trigger{{ID: "parent1", Composite: &moira.CompositeData{Tags: []string{"other"}}}}, nil)
+			dataBase.EXPECT().GetTriggerCheckIDs([]string{"other"}, false).Return([]string{"parent1", "input1"}, nil)
+			dataBase.EXPECT().GetTriggers([]string{"input1"}).Return([]*moira.Trigger{{ID: "input1", Dependencies: []string{triggerID}}}, nil)
+			err := checkTriggerDependencies(dataBase, trigger, triggerID)
+			So(err, ShouldResemble, expected)
+		})
+	})
+}
+
 func TestVariousTtlState(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -14,7 +14,9 @@ func (*PatternList) Render(w http.ResponseWriter, r *http.Request) error {
 }
 
 type PatternData struct {
-	Metrics  []string       `json:"metrics"`
-	Pattern  string         `json:"pattern"`
-	Triggers []TriggerModel `json:"triggers"`
+	Metrics      []string       `json:"metrics"`
+	MetricsCount int64          `json:"metrics_count"`
+	Limited      bool           `json:"limited"`
+	Pattern      string         `json:"pattern"`
+	Triggers     []TriggerModel `json:"triggers"`
 }
@@ -44,7 +44,11 @@ type TriggerModel struct {
 	WarnValue *float64 `json:"warn_value"`
 	// ERROR threshold
 	ErrorValue *float64 `json:"error_value"`
-	// Could be: rising, falling, expression
+	// Rising trigger in WARN state returns to OK only below this value, falling trigger only above it
+	WarnRecoverValue *float64 `json:"warn_recover_value,omitempty"`
+	// Rising trigger in ERROR state returns to WARN or OK only below this value, falling trigger only above it
+	ErrorRecoverValue *float64 `json:"error_recover_value,omitempty"`
+	// Could be: rising, falling, expression, anomaly, composite
 	TriggerType string `json:"trigger_type"`
 	// Set of tags to manipulate subscriptions
 	Tags []string `json:"tags"`
@@ -62,53 +66,82 @@ type TriggerModel struct {
 	IsRemote bool `json:"is_remote"`
 	// If true, first event NODATA → OK will be omitted
 	MuteNewMetrics bool `json:"mute_new_metrics"`
+	// Historical baseline of anomaly trigger, its WARN and ERROR values are numbers of standard deviations from baseline
+	Anomaly *moira.AnomalyData `json:"anomaly,omitempty"`
+	// Number of points in WARN or ERROR state in a row required to switch metric to this state, 0 or 1 switches it on the first such point
+	PendingPoints int `json:"pending_points,omitempty"`
+	// Intervals in seconds of reminders about metrics staying in WARN, ERROR or NODATA state, 0 disables reminders of the state.
+	// Reminders of states which are not set are sent every 24 hours for ERROR and NODATA
+	RemindIntervals map[string]int64 `json:"remind_intervals,omitempty"`
+	// IDs of parent triggers, events of trigger are suppressed while any of them is in bad state
+	Dependencies []string `json:"dependencies,omitempty"`
+	// Input triggers of composite trigger and expression computing its state from their states
+	Composite *moira.CompositeData `json:"composite,omitempty"`
+	// If set, trigger state is aggregated from states of its metrics and events of single metrics are not sent
+	Aggregation *moira.AggregationData `json:"aggregation,omitempty"`
 }
 
 // ToMoiraTrigger transforms TriggerModel to moira.Trigger
 func (model *TriggerModel) ToMoiraTrigger() *moira.Trigger {
 	return &moira.Trigger{
-		ID:             model.ID,
-		Name:           model.Name,
-		Desc:           model.Desc,
-		Targets:        model.Targets,
-		WarnValue:      model.WarnValue,
-		ErrorValue:     model.ErrorValue,
-		TriggerType:    model.TriggerType,
-		Tags:           model.Tags,
-		TTLState:       model.TTLState,
-		TTL:            model.TTL,
-		Schedule:       model.Schedule,
-		Expression:     &model.Expression,
-		Patterns:       model.Patterns,
-		IsRemote:       model.IsRemote,
-		MuteNewMetrics: model.MuteNewMetrics,
+		ID:                model.ID,
+		Name:              model.Name,
+		Desc:              model.Desc,
+		Targets:           model.Targets,
+		WarnValue:         model.WarnValue,
+		ErrorValue:        model.ErrorValue,
+		WarnRecoverValue:  model.WarnRecoverValue,
+		ErrorRecoverValue: model.ErrorRecoverValue,
+		TriggerType:       model.TriggerType,
+		Tags:              model.Tags,
+		TTLState:          model.TTLState,
+		TTL:               model.TTL,
+		Schedule:          model.Schedule,
+		Expression:        &model.Expression,
+		Patterns:          model.Patterns,
+		IsRemote:          model.IsRemote,
+		MuteNewMetrics:    model.MuteNewMetrics,
+		Anomaly:           model.Anomaly,
+		PendingPoints:     model.PendingPoints,
+		RemindIntervals:   model.RemindIntervals,
+		Dependencies:      model.Dependencies,
+		Composite:         model.Composite,
+		Aggregation:       model.Aggregation,
 	}
 }
 
 // CreateTriggerModel transforms moira.Trigger to TriggerModel
 func CreateTriggerModel(trigger *moira.Trigger) TriggerModel {
 	return TriggerModel{
-		ID:             trigger.ID,
-		Name:           trigger.Name,
-		Desc:           trigger.Desc,
-		Targets:        trigger.Targets,
-		WarnValue:      trigger.WarnValue,
-		ErrorValue:     trigger.ErrorValue,
-		TriggerType:    trigger.TriggerType,
-		Tags:           trigger.Tags,
-		TTLState:       trigger.TTLState,
-		TTL:            trigger.TTL,
-		Schedule:       trigger.Schedule,
-		Expression:     moira.UseString(trigger.Expression),
-		Patterns:       trigger.Patterns,
-		IsRemote:       trigger.IsRemote,
-		MuteNewMetrics: trigger.MuteNewMetrics,
+		ID:                trigger.ID,
+		Name:              trigger.Name,
+		Desc:              trigger.Desc,
+		Targets:           trigger.Targets,
+		WarnValue:         trigger.WarnValue,
+		ErrorValue:        trigger.ErrorValue,
+		WarnRecoverValue:  trigger.WarnRecoverValue,
+		ErrorRecoverValue: trigger.ErrorRecoverValue,
+		TriggerType:       trigger.TriggerType,
+		Tags:              trigger.Tags,
+		TTLState:          trigger.TTLState,
+		TTL:               trigger.TTL,
+		Schedule:          trigger.Schedule,
+		Expression:        moira.UseString(trigger.Expression),
+		Patterns:          trigger.Patterns,
+		IsRemote:          trigger.IsRemote,
+		MuteNewMetrics:    trigger.MuteNewMetrics,
+		Anomaly:           trigger.Anomaly,
+		PendingPoints:     trigger.PendingPoints,
+		RemindIntervals:   trigger.RemindIntervals,
+		Dependencies:      trigger.Dependencies,
+		Composite:         trigger.Composite,
+		Aggregation:       trigger.Aggregation,
 	}
 }
 
 func (trigger *Trigger) Bind(request *http.Request) error {
 	trigger.Tags = normalizeTags(trigger.Tags)
-	if len(trigger.Targets) == 0 {
+	if len(trigger.Targets) == 0 && trigger.TriggerType != moira.CompositeTrigger {
 		return fmt.Errorf("targets is required")
 	}
 	if len(trigger.Tags) == 0 {
@@ -117,14 +150,39 @@ func (trigger *Trigger) Bind(request *http.Request) error {
 	if trigger.Name == "" {
 		return fmt.Errorf("trigger name is required")
 	}
+	if trigger.PendingPoints < 0 {
+		return fmt.Errorf("pending_points should not be negative")
+	}
+	if err := checkRemindIntervals(trigger); err != nil {
+		return err
+	}
+	if trigger.TriggerType == moira.CompositeTrigger {
+		if trigger.Aggregation != nil {
+			return fmt.Errorf("composite trigger has no metrics to aggregate")
+		}
+		return checkComposite(request, trigger)
+	}
+	if trigger.Aggregation != nil {
+		if err := trigger.Aggregation.Validate(); err != nil {
+			return err
+		}
+	}
 	if err := checkWarnErrorExpression(trigger); err != nil {
 		return err
 	}
+	if err := checkAnomalyHistory(request, trigger); err != nil {
+		return err
+	}
+	if err := checkRecoverValues(trigger); err != nil {
+		return err
+	}
 
 	triggerExpression := expression.TriggerExpression{
 		AdditionalTargetsValues: make(map[string]float64),
 		WarnValue:               trigger.WarnValue,
 		ErrorValue:              trigger.ErrorValue,
+		WarnRecoverValue:        trigger.WarnRecoverValue,
+		ErrorRecoverValue:       trigger.ErrorRecoverValue,
 		TriggerType:             trigger.TriggerType,
 		PreviousState:           checker.NODATA,
 		Expression:              &trigger.Expression,
@@ -233,14 +291,126 @@ func checkWarnErrorExpression(trigger *Trigger) error {
 		if trigger.Expression == "" {
 			return fmt.Errorf("trigger_type set to expression, but no expression provided")
 		}
+	case moira.AnomalyTrigger:
+		if err := trigger.Anomaly.Validate(); err != nil {
+			return err
+		}
+		if (trigger.WarnValue != nil && *trigger.WarnValue <= 0) || (trigger.ErrorValue != nil && *trigger.ErrorValue <= 0) {
+			return fmt.Errorf("warn_value and error_value of anomaly trigger are numbers of standard deviations and should be greater than 0")
+		}
+		if trigger.WarnValue != nil && trigger.ErrorValue != nil {
+			if *trigger.WarnValue > *trigger.ErrorValue {
+				return fmt.Errorf("error_value should be greater than warn_value")
+			}
+		}
 	default:
-		return fmt.Errorf("wrong trigger_type: %v, allowable values: '%v', '%v', '%v'",
-			trigger.TriggerType, moira.RisingTrigger, moira.FallingTrigger, moira.ExpressionTrigger)
+		return fmt.Errorf("wrong trigger_type: %v, allowable values: '%v', '%v', '%v', '%v', '%v'",
+			trigger.TriggerType, moira.RisingTrigger, moira.FallingTrigger, moira.ExpressionTrigger, moira.AnomalyTrigger, moira.CompositeTrigger)
 	}
 
 	return nil
 }
 
+// checkAnomalyHistory checks that metrics history needed by anomaly baseline is kept for local trigger.
+// Moira keeps metrics only for metrics TTL, so seasonal baseline and longer rolling windows are available only to remote triggers
+func checkAnomalyHistory(request *http.Request, trigger *Trigger) error {
+	if trigger.TriggerType != moira.AnomalyTrigger || trigger.IsRemote {
+		return nil
+	}
+	if trigger.Anomaly.Baseline == moira.SeasonalBaseline {
+		return fmt.Errorf("seasonal baseline needs metrics history longer than metrics TTL, it can be used only by remote trigger")
+	}
+	if metricsTTL := middleware.GetMetricsTTL(request); trigger.Anomaly.Window > metricsTTL {
+		return fmt.Errorf("window of rolling baseline should not be longer than metrics TTL (%d seconds) for local trigger", metricsTTL)
+	}
+	return nil
+}
+
+// checkComposite checks that composite trigger input triggers exist and its expression can be evaluated for their states
+func checkComposite(request *http.Request, trigger *Trigger) error {
+	if err := trigger.Composite.Validate(); err != nil {
+		return err
+	}
+	if trigger.IsRemote {
+		return fmt.Errorf("composite trigger can not be remote")
+	}
+	trigger.Targets = make([]string, 0)
+	trigger.Patterns = make([]string, 0)
+	middleware.SetTimeSeriesNames(request, make(map[string]bool))
+
+	database := middleware.GetDatabase(request)
+	inputTriggers, err := database.GetTriggers(trigger.Composite.TriggerIDs)
+	if err != nil {
+		return err
+	}
+	compositeExpression := expression.CompositeExpression{
+		Expression:  trigger.Composite.Expression,
+		InputStates: make(map[string]string),
+	}
+	for i, inputTrigger := range inputTriggers {
+		if inputTrigger == nil {
+			return fmt.Errorf("input trigger with ID = '%s' does not exists", trigger.Composite.TriggerIDs[i])
+		}
+		compositeExpression.InputStates[inputTrigger.ID] = checker.OK
+	}
+	if len(trigger.Composite.Tags) > 0 {
+		tagsTriggerIDs, err := database.GetTriggerCheckIDs(trigger.Composite.Tags, false)
+		if err != nil {
+			return err
+		}
+		for _, triggerID := range tagsTriggerIDs {
+			compositeExpression.InputStates[triggerID] = checker.OK
+		}
+	}
+	_, err = compositeExpression.Evaluate()
+	return err
+}
+
+func checkRemindIntervals(trigger *Trigger) error {
+	for state, interval := range trigger.RemindIntervals {
+		switch state {
+		case checker.WARN, checker.ERROR, checker.NODATA:
+		default:
+			return fmt.Errorf("remind_intervals can be set only for states: %s, %s, %s", checker.WARN, checker.ERROR, checker.NODATA)
+		}
+		if interval < 0 {
+			return fmt.Errorf("remind interval of state %s should not be negative", state)
+		}
+	}
+	return nil
+}
+
+func checkRecoverValues(trigger *Trigger) error {
+	if trigger.WarnRecoverValue == nil && trigger.ErrorRecoverValue == nil {
+		return nil
+	}
+	if trigger.TriggerType != moira.RisingTrigger && trigger.TriggerType != moira.FallingTrigger {
+		return fmt.Errorf("warn_recover_value and error_recover_value can be set only for %s and %s triggers", moira.RisingTrigger, moira.FallingTrigger)
+	}
+	if trigger.WarnRecoverValue != nil && trigger.WarnValue == nil {
+		return fmt.Errorf("warn_recover_value is set, but warn_value is empty")
+	}
+	if trigger.ErrorRecoverValue != nil && trigger.ErrorValue == nil {
+		return fmt.Errorf("error_recover_value is set, but error_value is empty")
+	}
+	if trigger.TriggerType == moira.RisingTrigger {
+		if trigger.WarnRecoverValue != nil && *trigger.WarnRecoverValue > *trigger.WarnValue {
+			return fmt.Errorf("warn_recover_value should not be greater than warn_value")
+		}
+		if trigger.ErrorRecoverValue != nil && *trigger.ErrorRecoverValue > *trigger.ErrorValue {
+			return fmt.Errorf("error_recover_value should not be greater than error_value")
+		}
+		return nil
+	}
+	if trigger.WarnRecoverValue != nil && *trigger.WarnRecoverValue < *trigger.WarnValue {
+		return fmt.Errorf("warn_recover_value should not be less than warn_value")
+	}
+	if trigger.ErrorRecoverValue != nil && *trigger.ErrorRecoverValue < *trigger.ErrorValue {
+		return fmt.Errorf("error_recover_value should not be less than error_value")
+	}
+	return nil
+}
+
 func (*Trigger) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
@@ -294,3 +464,12 @@ type TriggerMetrics struct {
 func (*TriggerMetrics) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
+
+type TriggerBacktest struct {
+	Events      []moira.NotificationEvent   `json:"events"`
+	TimeInState map[string]map[string]int64 `json:"time_in_state"`
+}
+
+func (*TriggerBacktest) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
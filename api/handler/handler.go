@@ -38,7 +38,7 @@ func NewHandler(db moira.Database, log moira.Logger, index moira.Searcher, confi
 		router.Use(moiramiddle.DatabaseContext(database))
 		router.Get("/config", webConfig(configFile))
 		router.Route("/user", user)
-		router.Route("/trigger", triggers(remoteConfig, searchIndex))
+		router.Route("/trigger", triggers(remoteConfig, config.MetricsTTLSeconds, searchIndex))
 		router.Route("/tag", tag)
 		router.Route("/pattern", pattern)
 		router.Route("/event", event)
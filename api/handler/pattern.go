@@ -13,6 +13,7 @@ import (
 
 func pattern(router chi.Router) {
 	router.Get("/", getAllPatterns)
+	router.With(middleware.Paginate(0, 10)).Get("/top", getTopPatterns)
 	router.Delete("/{pattern}", deletePattern)
 }
 
@@ -28,6 +29,19 @@ func getAllPatterns(writer http.ResponseWriter, request *http.Request) {
 	}
 }
 
+func getTopPatterns(writer http.ResponseWriter, request *http.Request) {
+	size := middleware.GetSize(request)
+	page := middleware.GetPage(request)
+	patternsList, err := controller.GetTopPatterns(database, page, size)
+	if err != nil {
+		render.Render(writer, request, err)
+		return
+	}
+	if err := render.Render(writer, request, patternsList); err != nil {
+		render.Render(writer, request, api.ErrorRender(err))
+	}
+}
+
 func deletePattern(writer http.ResponseWriter, request *http.Request) {
 	pattern := chi.URLParam(request, "pattern")
 	if pattern == "" {
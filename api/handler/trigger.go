@@ -29,6 +29,7 @@ func trigger(router chi.Router) {
 	router.Route("/metrics", triggerMetrics)
 	router.Put("/setMaintenance", setTriggerMaintenance)
 	router.With(middleware.DateRange("-1hour", "now")).Get("/render", renderTrigger)
+	router.With(middleware.DateRange("-1day", "now")).Get("/backtest", backtestExistingTrigger)
 	// deprecated
 	router.Put("/maintenance", setMetricsMaintenance)
 }
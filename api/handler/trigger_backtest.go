@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/go-graphite/carbonapi/date"
+
+	"github.com/moira-alert/moira/api"
+	"github.com/moira-alert/moira/api/controller"
+	"github.com/moira-alert/moira/api/dto"
+	"github.com/moira-alert/moira/api/middleware"
+	"github.com/moira-alert/moira/expression"
+	"github.com/moira-alert/moira/remote"
+	"github.com/moira-alert/moira/target"
+)
+
+// defaultBacktestCheckInterval is a default interval in seconds between replayed checks of trigger
+const defaultBacktestCheckInterval = 60
+
+func backtestTrigger(writer http.ResponseWriter, request *http.Request) {
+	trigger := &dto.Trigger{}
+	if err := render.Bind(request, trigger); err != nil {
+		switch err.(type) {
+		case target.ErrParseExpr, target.ErrEvalExpr, target.ErrUnknownFunction:
+			render.Render(writer, request, api.ErrorInvalidRequest(fmt.Errorf("invalid graphite targets: %s", err.Error())))
+		case expression.ErrInvalidExpression:
+			render.Render(writer, request, api.ErrorInvalidRequest(fmt.Errorf("invalid expression: %s", err.Error())))
+		case remote.ErrRemoteTriggerResponse:
+			render.Render(writer, request, api.ErrorRemoteServerUnavailable(err))
+		default:
+			render.Render(writer, request, api.ErrorInternalServer(err))
+		}
+		return
+	}
+	from, to, checkInterval, err := getBacktestParameters(request)
+	if err != nil {
+		render.Render(writer, request, api.ErrorInvalidRequest(err))
+		return
+	}
+	logger := middleware.GetLoggerEntry(request)
+	remoteCfg := middleware.GetRemoteConfig(request)
+	backtest, errorResponse := controller.BacktestTrigger(database, logger, remoteCfg, middleware.GetMetricsTTL(request), &trigger.TriggerModel, from, to, checkInterval)
+	if errorResponse != nil {
+		render.Render(writer, request, errorResponse)
+		return
+	}
+	if err := render.Render(writer, request, backtest); err != nil {
+		render.Render(writer, request, api.ErrorRender(err))
+	}
+}
+
+func backtestExistingTrigger(writer http.ResponseWriter, request *http.Request) {
+	from, to, checkInterval, err := getBacktestParameters(request)
+	if err != nil {
+		render.Render(writer, request, api.ErrorInvalidRequest(err))
+		return
+	}
+	triggerID := middleware.GetTriggerID(request)
+	logger := middleware.GetLoggerEntry(request)
+	remoteCfg := middleware.GetRemoteConfig(request)
+	backtest, errorResponse := controller.BacktestExistingTrigger(database, logger, remoteCfg, middleware.GetMetricsTTL(request), triggerID, from, to, checkInterval)
+	if errorResponse != nil {
+		render.Render(writer, request, errorResponse)
+		return
+	}
+	if err := render.Render(writer, request, backtest); err != nil {
+		render.Render(writer, request, api.ErrorRender(err))
+	}
+}
+
+func getBacktestParameters(request *http.Request) (from int64, to int64, checkInterval int64, err error) {
+	fromStr := middleware.GetFromStr(request)
+	toStr := middleware.GetToStr(request)
+	from = date.DateParamToEpoch(fromStr, "UTC", 0, time.UTC)
+	if from == 0 {
+		return 0, 0, 0, fmt.Errorf("can not parse from: %s", fromStr)
+	}
+	to = date.DateParamToEpoch(toStr, "UTC", 0, time.UTC)
+	if to == 0 {
+		return 0, 0, 0, fmt.Errorf("can not parse to: %s", toStr)
+	}
+	checkInterval = defaultBacktestCheckInterval
+	interval := request.URL.Query().Get("interval")
+	if interval == "" {
+		return
+	}
+	checkInterval, err = strconv.ParseInt(interval, 10, 64)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid interval param: %s", err.Error())
+	}
+	return
+}
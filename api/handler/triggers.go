@@ -19,12 +19,14 @@ import (
 	"github.com/moira-alert/moira/target"
 )
 
-func triggers(cfg *remote.Config, searcher moira.Searcher) func(chi.Router) {
+func triggers(cfg *remote.Config, metricsTTL int64, searcher moira.Searcher) func(chi.Router) {
 	return func(router chi.Router) {
 		router.Use(middleware.RemoteConfigContext(cfg))
+		router.Use(middleware.MetricsTTLContext(metricsTTL))
 		router.Use(middleware.SearchIndexContext(searcher))
 		router.Get("/", getAllTriggers)
 		router.Put("/", createTrigger)
+		router.With(middleware.DateRange("-1day", "now")).Put("/backtest", backtestTrigger)
 		router.Route("/{triggerId}", trigger)
 		router.With(middleware.Paginate(0, 10)).Get("/search", searchTriggers)
 		// ToDo: DEPRECATED method. Remove in Moira 2.5
@@ -104,6 +104,16 @@ func RemoteConfigContext(cfg *remote.Config) func(next http.Handler) http.Handle
 	}
 }
 
+// MetricsTTLContext adds time in seconds metrics are kept in Moira for to request context
+func MetricsTTLContext(metricsTTL int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			ctx := context.WithValue(request.Context(), metricsTTLKey, metricsTTL)
+			next.ServeHTTP(writer, request.WithContext(ctx))
+		})
+	}
+}
+
 // Paginate gets page and size values from URI query and set it to request context. If query has not values sets given values
 func Paginate(defaultPage, defaultSize int64) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -29,6 +29,7 @@ var (
 	loginKey           ContextKey = "login"
 	timeSeriesNamesKey ContextKey = "timeSeriesNames"
 	remoteConfigKey    ContextKey = "remoteConfig"
+	metricsTTLKey      ContextKey = "metricsTTL"
 )
 
 // GetDatabase gets moira.Database realization from request context
@@ -96,3 +97,8 @@ func GetTimeSeriesNames(request *http.Request) map[string]bool {
 func GetRemoteConfig(request *http.Request) *remote.Config {
 	return request.Context().Value(remoteConfigKey).(*remote.Config)
 }
+
+// GetMetricsTTL gets time in seconds metrics are kept in Moira for from request context
+func GetMetricsTTL(request *http.Request) int64 {
+	return request.Context().Value(metricsTTLKey).(int64)
+}
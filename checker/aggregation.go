@@ -0,0 +1,30 @@
+package checker
+
+import (
+	"fmt"
+
+	"github.com/moira-alert/moira"
+)
+
+// getAggregatedState returns trigger state aggregated from states of its metrics and message with their distribution.
+// Trigger is in ERROR state if too many metrics are in ERROR state, or in WARN state if too many metrics are in WARN or ERROR state
+func (triggerChecker *TriggerChecker) getAggregatedState(metrics map[string]moira.MetricState) (string, string) {
+	aggregation := triggerChecker.trigger.Aggregation
+	var warnCount, errorCount int
+	for _, metricState := range metrics {
+		switch metricState.State {
+		case WARN:
+			warnCount++
+		case ERROR:
+			errorCount++
+		}
+	}
+	message := fmt.Sprintf("%d of %d metrics are in bad state: ERROR: %d, WARN: %d", warnCount+errorCount, len(metrics), errorCount, warnCount)
+	if aggregation.IsExceeded(errorCount, len(metrics)) {
+		return ERROR, message
+	}
+	if aggregation.IsExceeded(warnCount+errorCount, len(metrics)) {
+		return WARN, message
+	}
+	return OK, message
+}
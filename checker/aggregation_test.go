@@ -0,0 +1,119 @@
+package checker
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/mock/moira-alert"
+)
+
+func TestGetAggregatedState(t *testing.T) {
+	getTriggerChecker := func(aggregation moira.AggregationData) TriggerChecker {
+		return TriggerChecker{
+			trigger: &moira.Trigger{Aggregation: &aggregation},
+		}
+	}
+	getMetrics := func(states ...string) map[string]moira.MetricState {
+		metrics := make(map[string]moira.MetricState, len(states))
+		for i, state := range states {
+			metrics[fmt.Sprintf("m%d", i+1)] = moira.MetricState{State: state}
+		}
+		return metrics
+	}
+
+	Convey("Should aggregate trigger state by percent of bad metrics", t, func() {
+		triggerChecker := getTriggerChecker(moira.AggregationData{Percent: 20})
+
+		Convey("Bad metrics percent is not above aggregation percent", func() {
+			state, message := triggerChecker.getAggregatedState(getMetrics(OK, OK, OK, WARN, NODATA))
+			So(state, ShouldEqual, OK)
+			So(message, ShouldEqual, "1 of 5 metrics are in bad state: ERROR: 0, WARN: 1")
+		})
+
+		Convey("Bad metrics percent is above aggregation percent, but error metrics percent is not", func() {
+			state, message := triggerChecker.getAggregatedState(getMetrics(OK, OK, ERROR, WARN, NODATA))
+			So(state, ShouldEqual, WARN)
+			So(message, ShouldEqual, "2 of 5 metrics are in bad state: ERROR: 1, WARN: 1")
+		})
+
+		Convey("Error metrics percent is above aggregation percent", func() {
+			state, _ := triggerChecker.getAggregatedState(getMetrics(OK, ERROR, ERROR, WARN, NODATA))
+			So(state, ShouldEqual, ERROR)
+		})
+	})
+
+	Convey("Should aggregate trigger state by number of bad metrics", t, func() {
+		triggerChecker := getTriggerChecker(moira.AggregationData{Count: 2})
+
+		Convey("Bad metrics number is not above aggregation count", func() {
+			state, _ := triggerChecker.getAggregatedState(getMetrics(OK, OK, ERROR, WARN, NODATA))
+			So(state, ShouldEqual, OK)
+		})
+
+		Convey("Bad metrics number is above aggregation count, but error metrics number is not", func() {
+			state, _ := triggerChecker.getAggregatedState(getMetrics(OK, ERROR, ERROR, WARN, NODATA))
+			So(state, ShouldEqual, WARN)
+		})
+
+		Convey("Error metrics number is above aggregation count", func() {
+			state, _ := triggerChecker.getAggregatedState(getMetrics(ERROR, ERROR, ERROR, OK, NODATA))
+			So(state, ShouldEqual, ERROR)
+		})
+	})
+}
+
+func TestAggregatedTriggerEvents(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	logger, _ := logging.GetLogger("Test")
+	dataBase := mock_moira_alert.NewMockDatabase(mockCtrl)
+
+	triggerChecker := TriggerChecker{
+		TriggerID: "SuperId",
+		Database:  dataBase,
+		Logger:    logger,
+		trigger:   &moira.Trigger{Name: "Super trigger", Aggregation: &moira.AggregationData{Count: 1}},
+		lastCheck: &moira.CheckData{State: OK, Timestamp: 100, EventTimestamp: 10},
+	}
+
+	Convey("Should not send events of metrics", t, func() {
+		lastState := moira.MetricState{Timestamp: 100, EventTimestamp: 10, State: OK}
+		currentState := moira.MetricState{Timestamp: 200, State: ERROR}
+
+		actual, err := triggerChecker.compareMetricStates("m1", currentState, lastState)
+		So(err, ShouldBeNil)
+		So(actual.State, ShouldEqual, ERROR)
+		So(actual.EventTimestamp, ShouldEqual, currentState.Timestamp)
+	})
+
+	Convey("Should send single trigger event with metrics states", t, func() {
+		checkData := moira.CheckData{
+			Metrics: map[string]moira.MetricState{
+				"m1": {State: ERROR},
+				"m2": {State: ERROR},
+				"m3": {State: OK},
+			},
+			Timestamp:                    200,
+			LastSuccessfulCheckTimestamp: 100,
+		}
+		message := "2 of 3 metrics are in bad state: ERROR: 2, WARN: 0"
+		dataBase.EXPECT().PushNotificationEvent(&moira.NotificationEvent{
+			IsTriggerEvent: true,
+			TriggerID:      triggerChecker.TriggerID,
+			State:          ERROR,
+			OldState:       OK,
+			Timestamp:      200,
+			Metric:         triggerChecker.trigger.Name,
+			Message:        &message,
+		}, true).Return(nil)
+		actual, err := triggerChecker.handleTriggerCheck(checkData, nil)
+		So(err, ShouldBeNil)
+		So(actual.State, ShouldEqual, ERROR)
+		So(actual.Message, ShouldEqual, message)
+	})
+}
@@ -0,0 +1,141 @@
+package checker
+
+import (
+	"math"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/remote"
+	"github.com/moira-alert/moira/target"
+)
+
+// minBaselineValues is a min number of historical values which baseline of anomaly trigger can be computed from
+const minBaselineValues = 2
+
+// ErrInvalidAnomalyTrigger used if anomaly trigger has invalid baseline parameters
+type ErrInvalidAnomalyTrigger struct {
+	internalError error
+}
+
+// ErrInvalidAnomalyTrigger implementation with error message of parameters validation
+func (err ErrInvalidAnomalyTrigger) Error() string {
+	return err.internalError.Error()
+}
+
+// baselineTimeSeries is a history of main target time series shifted back in time by given number of seconds
+type baselineTimeSeries struct {
+	*target.TimeSeries
+	shift int64
+}
+
+// getBaselines fetches history of main target which baseline of anomaly trigger is computed from, it is grouped by time series names.
+// Rolling baseline is a single time series starting window before checked interval,
+// seasonal baseline is a time series of checked interval of every previous season
+func (triggerChecker *TriggerChecker) getBaselines(from, until int64) (map[string][]baselineTimeSeries, error) {
+	anomaly := triggerChecker.trigger.Anomaly
+	if err := anomaly.Validate(); err != nil {
+		return nil, ErrInvalidAnomalyTrigger{internalError: err}
+	}
+	mainTarget := triggerChecker.trigger.Targets[0]
+	baselines := make(map[string][]baselineTimeSeries)
+
+	if anomaly.Baseline == moira.RollingBaseline {
+		timeSeries, err := triggerChecker.fetchTargetTimeSeries(mainTarget, from-anomaly.Window, until)
+		if err != nil {
+			return nil, err
+		}
+		for _, ts := range timeSeries {
+			baselines[ts.Name] = append(baselines[ts.Name], baselineTimeSeries{TimeSeries: ts})
+		}
+		return baselines, nil
+	}
+
+	for season := 1; season <= anomaly.Seasons; season++ {
+		shift := int64(season) * anomaly.Window
+		timeSeries, err := triggerChecker.fetchTargetTimeSeries(mainTarget, from-shift, until-shift)
+		if err != nil {
+			return nil, err
+		}
+		for _, ts := range timeSeries {
+			baselines[ts.Name] = append(baselines[ts.Name], baselineTimeSeries{TimeSeries: ts, shift: shift})
+		}
+	}
+	return baselines, nil
+}
+
+// fetchTargetTimeSeries evaluates target using metrics stored in Moira or fetches it from remote storage if trigger is remote
+func (triggerChecker *TriggerChecker) fetchTargetTimeSeries(tar string, from, until int64) ([]*target.TimeSeries, error) {
+	isSimpleTrigger := triggerChecker.trigger.IsSimple()
+	if triggerChecker.trigger.IsRemote {
+		return remote.Fetch(triggerChecker.RemoteConfig, tar, from, until, isSimpleTrigger)
+	}
+	result, err := target.EvaluateTarget(triggerChecker.Database, tar, from, until, isSimpleTrigger)
+	if err != nil {
+		return nil, err
+	}
+	return result.TimeSeries, nil
+}
+
+// getDeviation returns number of standard deviations of value from mean of its baseline at given timestamp.
+// Deviation is not computed if baseline has too few values
+func (triggerChecker *TriggerChecker) getDeviation(baselines []baselineTimeSeries, valueTimestamp int64, value float64) (float64, bool) {
+	anomaly := triggerChecker.trigger.Anomaly
+	values := make([]float64, 0)
+	for _, baseline := range baselines {
+		if anomaly.Baseline == moira.RollingBaseline {
+			values = append(values, baseline.getWindowValues(valueTimestamp-anomaly.Window, valueTimestamp)...)
+			continue
+		}
+		if baselineValue := baseline.GetTimestampValue(valueTimestamp - baseline.shift); !IsInvalidValue(baselineValue) {
+			values = append(values, baselineValue)
+		}
+	}
+	if len(values) < minBaselineValues {
+		return 0, false
+	}
+
+	mean, stdDev := getMeanAndStdDev(values)
+	difference := value - mean
+	switch anomaly.Direction {
+	case moira.DeviationUp:
+	case moira.DeviationDown:
+		difference = -difference
+	default:
+		difference = math.Abs(difference)
+	}
+	if stdDev == 0 {
+		if difference > 0 {
+			return math.Inf(1), true
+		}
+		return 0, true
+	}
+	return difference / stdDev, true
+}
+
+// getWindowValues returns valid values of time series with timestamps from given one inclusive until given one exclusive
+func (baseline baselineTimeSeries) getWindowValues(from, until int64) []float64 {
+	values := make([]float64, 0)
+	for index, value := range baseline.Values {
+		valueTimestamp := baseline.StartTime + int64(index)*baseline.StepTime
+		if valueTimestamp < from || IsInvalidValue(value) {
+			continue
+		}
+		if valueTimestamp >= until {
+			break
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func getMeanAndStdDev(values []float64) (float64, float64) {
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	mean := sum / float64(len(values))
+	var squares float64
+	for _, value := range values {
+		squares += (value - mean) * (value - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
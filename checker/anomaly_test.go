@@ -0,0 +1,168 @@
+package checker
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/target"
+)
+
+func newBaselineTimeSeries(startTime, stepTime int64, values []float64, shift int64) baselineTimeSeries {
+	fetchResponse := pb.FetchResponse{
+		Name:      "main.metric",
+		StartTime: startTime,
+		StopTime:  startTime + stepTime*int64(len(values)),
+		StepTime:  stepTime,
+		Values:    values,
+	}
+	return baselineTimeSeries{
+		TimeSeries: &target.TimeSeries{MetricData: types.MetricData{FetchResponse: fetchResponse}},
+		shift:      shift,
+	}
+}
+
+func TestGetDeviation(t *testing.T) {
+	logger, _ := logging.GetLogger("Test")
+
+	Convey("Rolling baseline", t, func() {
+		triggerChecker := TriggerChecker{
+			Logger: logger,
+			trigger: &moira.Trigger{
+				TriggerType: moira.AnomalyTrigger,
+				Anomaly:     &moira.AnomalyData{Baseline: moira.RollingBaseline, Window: 40},
+			},
+		}
+		baselines := []baselineTimeSeries{newBaselineTimeSeries(0, 10, []float64{100, 100, 2, math.NaN(), 6, math.NaN(), 100}, 0)}
+
+		Convey("Should use values of window preceding value", func() {
+			deviation, ok := triggerChecker.getDeviation(baselines, 60, 8)
+			So(ok, ShouldBeTrue)
+			So(deviation, ShouldEqual, 2)
+		})
+
+		Convey("Should use absolute deviation by default", func() {
+			deviation, ok := triggerChecker.getDeviation(baselines, 60, 0)
+			So(ok, ShouldBeTrue)
+			So(deviation, ShouldEqual, 2)
+		})
+
+		Convey("Should use deviation of given direction", func() {
+			triggerChecker.trigger.Anomaly.Direction = moira.DeviationUp
+			deviation, _ := triggerChecker.getDeviation(baselines, 60, 0)
+			So(deviation, ShouldEqual, -2)
+			triggerChecker.trigger.Anomaly.Direction = moira.DeviationDown
+			deviation, _ = triggerChecker.getDeviation(baselines, 60, 0)
+			So(deviation, ShouldEqual, 2)
+		})
+
+		Convey("Should not compute deviation without enough history", func() {
+			_, ok := triggerChecker.getDeviation(baselines, 10, 8)
+			So(ok, ShouldBeFalse)
+			_, ok = triggerChecker.getDeviation(nil, 60, 8)
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Seasonal baseline", t, func() {
+		triggerChecker := TriggerChecker{
+			Logger: logger,
+			trigger: &moira.Trigger{
+				TriggerType: moira.AnomalyTrigger,
+				Anomaly:     &moira.AnomalyData{Baseline: moira.SeasonalBaseline, Window: 1000, Seasons: 3},
+			},
+		}
+		baselines := []baselineTimeSeries{
+			newBaselineTimeSeries(-1000, 10, []float64{1, 10, 1}, 1000),
+			newBaselineTimeSeries(-2000, 10, []float64{1, 20, 1}, 2000),
+			newBaselineTimeSeries(-3000, 10, []float64{1, 30, 1}, 3000),
+		}
+
+		Convey("Should use values at the same time of previous seasons", func() {
+			deviation, ok := triggerChecker.getDeviation(baselines, 10, 20+math.Sqrt(200.0/3)*3)
+			So(ok, ShouldBeTrue)
+			So(deviation, ShouldAlmostEqual, 3)
+		})
+
+		Convey("Should return infinite deviation from constant baseline", func() {
+			deviation, ok := triggerChecker.getDeviation(baselines, 0, 2)
+			So(ok, ShouldBeTrue)
+			So(math.IsInf(deviation, 1), ShouldBeTrue)
+			deviation, _ = triggerChecker.getDeviation(baselines, 0, 1)
+			So(deviation, ShouldEqual, 0)
+		})
+	})
+}
+
+func TestGetTimeSeriesStateOfAnomalyTrigger(t *testing.T) {
+	logger, _ := logging.GetLogger("Test")
+	var warnValue float64 = 2
+	var errValue float64 = 3
+	triggerChecker := TriggerChecker{
+		Logger: logger,
+		From:   40,
+		Until:  60,
+		trigger: &moira.Trigger{
+			WarnValue:   &warnValue,
+			ErrorValue:  &errValue,
+			TriggerType: moira.AnomalyTrigger,
+			Anomaly:     &moira.AnomalyData{Baseline: moira.RollingBaseline, Window: 40},
+		},
+	}
+	fetchResponse := pb.FetchResponse{
+		Name:      "main.metric",
+		StartTime: 40,
+		StopTime:  70,
+		StepTime:  10,
+		Values:    []float64{5, 7, 20},
+	}
+	timeSeries := &target.TimeSeries{MetricData: types.MetricData{FetchResponse: fetchResponse}}
+	tts := &TriggerTimeSeries{
+		Main:       []*target.TimeSeries{timeSeries},
+		Additional: make([]*target.TimeSeries, 0),
+		Baselines: map[string][]baselineTimeSeries{
+			"main.metric": {newBaselineTimeSeries(0, 10, []float64{4, 6, 4, 6, 5, 7, 20}, 0)},
+		},
+	}
+
+	Convey("Should compare deviation from baseline with trigger values", t, func() {
+		state, err := triggerChecker.getTimeSeriesState(tts, timeSeries, moira.MetricState{}, 40, 0)
+		So(err, ShouldBeNil)
+		So(state.State, ShouldEqual, OK)
+
+		state, err = triggerChecker.getTimeSeriesState(tts, timeSeries, moira.MetricState{}, 50, 0)
+		So(err, ShouldBeNil)
+		So(state.State, ShouldEqual, WARN)
+		So(*state.Value, ShouldEqual, 7)
+
+		state, err = triggerChecker.getTimeSeriesState(tts, timeSeries, moira.MetricState{}, 60, 0)
+		So(err, ShouldBeNil)
+		So(state.State, ShouldEqual, ERROR)
+	})
+
+	Convey("Should skip values without baseline", t, func() {
+		tts.Baselines = map[string][]baselineTimeSeries{}
+		state, err := triggerChecker.getTimeSeriesState(tts, timeSeries, moira.MetricState{}, 40, 0)
+		So(err, ShouldBeNil)
+		So(state, ShouldBeNil)
+	})
+}
+
+func TestGetBaselinesOfInvalidAnomalyTrigger(t *testing.T) {
+	Convey("Should return invalid anomaly trigger error", t, func() {
+		triggerChecker := TriggerChecker{
+			trigger: &moira.Trigger{
+				TriggerType: moira.AnomalyTrigger,
+				Targets:     []string{"main.metric"},
+				Anomaly:     &moira.AnomalyData{Baseline: moira.SeasonalBaseline, Window: 3600, Seasons: 1},
+			},
+		}
+		_, err := triggerChecker.getBaselines(0, 60)
+		So(err, ShouldHaveSameTypeAs, ErrInvalidAnomalyTrigger{})
+	})
+}
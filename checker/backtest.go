@@ -0,0 +1,177 @@
+package checker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/remote"
+	"github.com/moira-alert/moira/target"
+)
+
+// maxBacktestChecks is a max number of checks which trigger can be replayed with
+const maxBacktestChecks = 10000
+
+// maxRemoteBacktestChecks is a max number of checks which remote trigger can be replayed with,
+// every check of remote trigger requests remote storage
+const maxRemoteBacktestChecks = 100
+
+// ErrInvalidBacktest used if trigger can not be replayed with given parameters
+type ErrInvalidBacktest struct {
+	internalError error
+}
+
+// ErrInvalidBacktest implementation with error message of parameters validation
+func (err ErrInvalidBacktest) Error() string {
+	return err.internalError.Error()
+}
+
+// BacktestResult represents events which trigger would have generated over historical data
+// and time in seconds which every metric of trigger spent in every state
+type BacktestResult struct {
+	Events      []moira.NotificationEvent
+	TimeInState map[string]map[string]int64
+}
+
+// backtestDatabase reads metrics from database, but keeps events in memory and ignores other writes
+type backtestDatabase struct {
+	moira.Database
+	events []moira.NotificationEvent
+}
+
+// PushNotificationEvent keeps event instead of writing it to database
+func (dataBase *backtestDatabase) PushNotificationEvent(event *moira.NotificationEvent, ui bool) error {
+	dataBase.events = append(dataBase.events, *event)
+	return nil
+}
+
+// RemovePatternsMetrics does nothing, patterns metrics are kept untouched while backtesting
+func (dataBase *backtestDatabase) RemovePatternsMetrics(patterns []string) error {
+	return nil
+}
+
+// RemoveMetricsValues does nothing, metrics values are kept untouched while backtesting
+func (dataBase *backtestDatabase) RemoveMetricsValues(metrics []string, toTime int64) error {
+	return nil
+}
+
+// Backtest replays checks of trigger with given interval in seconds over data from given timestamp until given one.
+// Checks run the same logic as regular ones, but nothing is written to database.
+// Metrics stored in Moira are kept only for given metrics TTL in seconds, so older data can be replayed only for remote triggers,
+// 0 means that metrics TTL is not limited
+func Backtest(dataBase moira.Database, logger moira.Logger, remoteConfig *remote.Config, metricsTTL int64, trigger *moira.Trigger, from, until, checkInterval int64) (*BacktestResult, error) {
+	if trigger.TriggerType == moira.CompositeTrigger {
+		return nil, ErrInvalidBacktest{internalError: fmt.Errorf("composite trigger can not be backtested, history of its input triggers states is not kept")}
+	}
+	if checkInterval <= 0 {
+		return nil, ErrInvalidBacktest{internalError: fmt.Errorf("check interval should be positive")}
+	}
+	if from >= until {
+		return nil, ErrInvalidBacktest{internalError: fmt.Errorf("from should be less than until")}
+	}
+	maxChecks := int64(maxBacktestChecks)
+	if trigger.IsRemote {
+		maxChecks = maxRemoteBacktestChecks
+	}
+	if (until-from)/checkInterval > maxChecks {
+		return nil, ErrInvalidBacktest{internalError: fmt.Errorf("too many checks to replay, increase check interval or reduce time range to %d checks", maxChecks)}
+	}
+	if metricsTTL > 0 && !trigger.IsRemote {
+		if oldestMetrics := time.Now().Unix() - metricsTTL; from < oldestMetrics {
+			return nil, ErrInvalidBacktest{internalError: fmt.Errorf("metrics are kept for %d seconds only, from should not be earlier than %d for local trigger", metricsTTL, oldestMetrics)}
+		}
+	}
+
+	backtestDataBase := &backtestDatabase{Database: dataBase}
+	triggerChecker := TriggerChecker{
+		TriggerID:    trigger.ID,
+		Database:     backtestDataBase,
+		Logger:       logger,
+		Config:       &Config{MetricsTTLSeconds: metricsTTL},
+		RemoteConfig: remoteConfig,
+		trigger:      trigger,
+		lastCheck: &moira.CheckData{
+			Metrics:   make(map[string]moira.MetricState),
+			State:     OK,
+			Timestamp: from,
+		},
+		ttl:      trigger.TTL,
+		ttlState: NODATA,
+	}
+	if trigger.TTLState != nil {
+		triggerChecker.ttlState = *trigger.TTLState
+	}
+
+	result := &BacktestResult{TimeInState: make(map[string]map[string]int64)}
+	timers := make(map[string]*metricStateTimer)
+	triggerChecker.trackMetricState = func(metric string, lastState, currentState string, timestamp int64) {
+		timer, ok := timers[metric]
+		if !ok {
+			timer = &metricStateTimer{state: lastState, since: from}
+			timers[metric] = timer
+		}
+		if currentState != timer.state {
+			result.addTimeInState(metric, timer, timestamp)
+			timer.state = currentState
+		}
+	}
+	for checkTimestamp := from; checkTimestamp < until; {
+		checkTimestamp += checkInterval
+		if checkTimestamp > until {
+			checkTimestamp = until
+		}
+		checkData, err := triggerChecker.backtestCheck(checkTimestamp)
+		if err != nil {
+			return nil, err
+		}
+		triggerChecker.lastCheck = &checkData
+	}
+	for metric, timer := range timers {
+		result.addTimeInState(metric, timer, until)
+	}
+	result.Events = backtestDataBase.events
+	return result, nil
+}
+
+// metricStateTimer keeps state of metric and timestamp since which metric is in this state
+type metricStateTimer struct {
+	state string
+	since int64
+}
+
+// addTimeInState adds time since timer start until given timestamp to time which metric spent in state of timer
+// and restarts timer at this timestamp. Time before backtest range is not counted
+func (result *BacktestResult) addTimeInState(metric string, timer *metricStateTimer, timestamp int64) {
+	if timestamp <= timer.since {
+		return
+	}
+	if _, ok := result.TimeInState[metric]; !ok {
+		result.TimeInState[metric] = make(map[string]int64)
+	}
+	result.TimeInState[metric][timer.state] += timestamp - timer.since
+	timer.since = timestamp
+}
+
+// backtestCheck checks trigger at given timestamp like Check does, but returns check data instead of saving it.
+// Errors of fetching data fail backtesting instead of being turned into trigger state
+func (triggerChecker *TriggerChecker) backtestCheck(checkTimestamp int64) (moira.CheckData, error) {
+	triggerChecker.Until = checkTimestamp
+	if triggerChecker.ttl != 0 {
+		triggerChecker.From = triggerChecker.lastCheck.Timestamp - triggerChecker.ttl
+	} else {
+		triggerChecker.From = triggerChecker.lastCheck.Timestamp - 600
+	}
+	checkData, err := triggerChecker.handleMetricsCheck()
+	switch err.(type) {
+	case nil, ErrTriggerHasNoTimeSeries, ErrTriggerHasOnlyWildcards, ErrWrongTriggerTargets, ErrTriggerHasSameTimeSeriesNames,
+		ErrInvalidAnomalyTrigger, target.ErrUnknownFunction, target.ErrEvalExpr:
+	default:
+		return checkData, err
+	}
+	checkData, err = triggerChecker.handleTriggerCheck(checkData, err)
+	if err != nil {
+		return checkData, err
+	}
+	checkData.UpdateScore()
+	return checkData, nil
+}
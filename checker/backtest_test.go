@@ -0,0 +1,79 @@
+package checker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/mock/moira-alert"
+)
+
+func TestBacktest(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dataBase := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("Test")
+
+	var warnValue float64 = 10
+	var errValue float64 = 20
+	pattern := "super.puper.pattern"
+	metric := "super.puper.metric"
+	trigger := &moira.Trigger{
+		ID:          "SuperId",
+		Name:        "Super trigger",
+		ErrorValue:  &errValue,
+		WarnValue:   &warnValue,
+		TriggerType: moira.RisingTrigger,
+		Targets:     []string{pattern},
+		Patterns:    []string{pattern},
+	}
+	getMetricValues := func(values ...float64) map[string][]*moira.MetricValue {
+		metricValues := make([]*moira.MetricValue, 0, len(values))
+		for i, value := range values {
+			timestamp := int64(3610 + i*10)
+			metricValues = append(metricValues, &moira.MetricValue{RetentionTimestamp: timestamp, Timestamp: timestamp, Value: value})
+		}
+		return map[string][]*moira.MetricValue{metric: metricValues}
+	}
+
+	Convey("Should replay checks and return events without writing to database", t, func() {
+		dataBase.EXPECT().GetPatternMetrics(pattern).Return([]string{metric}, nil).Times(2)
+		dataBase.EXPECT().GetMetricRetention(metric).Return(int64(10), nil).Times(2)
+		dataBase.EXPECT().GetMetricsValues([]string{metric}, int64(3000), int64(3630)).Return(getMetricValues(5, 15, 25), nil)
+		dataBase.EXPECT().GetMetricsValues([]string{metric}, int64(3030), int64(3660)).Return(getMetricValues(5, 15, 25, 15, 5, 5), nil)
+
+		result, err := Backtest(dataBase, logger, nil, 0, trigger, 3600, 3660, 30)
+		So(err, ShouldBeNil)
+		states := make([]string, 0, len(result.Events))
+		for _, event := range result.Events {
+			So(event.TriggerID, ShouldEqual, trigger.ID)
+			So(event.Metric, ShouldEqual, metric)
+			states = append(states, event.OldState+"->"+event.State)
+		}
+		So(states, ShouldResemble, []string{"NODATA->OK", "OK->WARN", "WARN->ERROR", "ERROR->WARN", "WARN->OK"})
+		So(result.TimeInState, ShouldResemble, map[string]map[string]int64{metric: {NODATA: 10, OK: 20, WARN: 20, ERROR: 10}})
+	})
+
+	Convey("Should not replay invalid backtest", t, func() {
+		_, err := Backtest(dataBase, logger, nil, 0, trigger, 3660, 3600, 30)
+		So(err, ShouldHaveSameTypeAs, ErrInvalidBacktest{})
+		_, err = Backtest(dataBase, logger, nil, 0, trigger, 0, 3600, 0)
+		So(err, ShouldHaveSameTypeAs, ErrInvalidBacktest{})
+		_, err = Backtest(dataBase, logger, nil, 0, trigger, 0, maxBacktestChecks*60+60, 60)
+		So(err, ShouldHaveSameTypeAs, ErrInvalidBacktest{})
+		_, err = Backtest(dataBase, logger, nil, 0, &moira.Trigger{TriggerType: moira.CompositeTrigger}, 0, 3600, 60)
+		So(err, ShouldHaveSameTypeAs, ErrInvalidBacktest{})
+		_, err = Backtest(dataBase, logger, nil, 0, &moira.Trigger{IsRemote: true}, 0, maxRemoteBacktestChecks*60+60, 60)
+		So(err, ShouldHaveSameTypeAs, ErrInvalidBacktest{})
+	})
+
+	Convey("Should not replay local trigger over metrics older than metrics TTL", t, func() {
+		now := time.Now().Unix()
+		_, err := Backtest(dataBase, logger, nil, 3600, trigger, now-7200, now, 60)
+		So(err, ShouldHaveSameTypeAs, ErrInvalidBacktest{})
+	})
+}
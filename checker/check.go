@@ -2,6 +2,7 @@ package checker
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/moira-alert/moira"
@@ -39,10 +40,35 @@ func (err ErrTriggerHasSameTimeSeriesNames) Error() string {
 	return fmt.Sprintf("Trigger has same timeseries names: %s", strings.Join(err.names, ", "))
 }
 
+// ErrTriggerPatternsLimited used if trigger patterns reached limit of metrics, so new metrics matching them are not checked
+type ErrTriggerPatternsLimited struct {
+	limits map[string]int64
+}
+
+// ErrTriggerPatternsLimited implementation with patterns and their limits in error message
+func (err ErrTriggerPatternsLimited) Error() string {
+	patterns := make([]string, 0, len(err.limits))
+	for pattern := range err.limits {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	limits := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		limits = append(limits, fmt.Sprintf("%s (%d metrics)", pattern, err.limits[pattern]))
+	}
+	return fmt.Sprintf("Trigger patterns reached limit of metrics, new metrics are not checked: %s. Make patterns more specific", strings.Join(limits, ", "))
+}
+
 // Check handle trigger and last check and write new state of trigger, if state were change then write new NotificationEvent
 func (triggerChecker *TriggerChecker) Check() error {
 	triggerChecker.Logger.Debugf("Checking trigger %s", triggerChecker.TriggerID)
-	checkData, err := triggerChecker.handleMetricsCheck()
+	var checkData moira.CheckData
+	var err error
+	if triggerChecker.trigger.TriggerType == moira.CompositeTrigger {
+		checkData, err = triggerChecker.handleCompositeCheck()
+	} else {
+		checkData, err = triggerChecker.handleMetricsCheck()
+	}
 
 	checkData, err = triggerChecker.handleTriggerCheck(checkData, err)
 	if err != nil {
@@ -50,16 +76,19 @@ func (triggerChecker *TriggerChecker) Check() error {
 	}
 
 	checkData.UpdateScore()
-	return triggerChecker.Database.SetTriggerLastCheck(triggerChecker.TriggerID, &checkData, triggerChecker.trigger.IsRemote)
+	if err = triggerChecker.Database.SetTriggerLastCheck(triggerChecker.TriggerID, &checkData, triggerChecker.trigger.IsRemote); err != nil {
+		return err
+	}
+	if checkData.GetWorstState() != triggerChecker.lastCheck.GetWorstState() {
+		return triggerChecker.addCompositeTriggersToCheck()
+	}
+	return nil
 }
 
-func (triggerChecker *TriggerChecker) handleMetricsCheck() (moira.CheckData, error) {
-	lastMetrics := make(map[string]moira.MetricState, len(triggerChecker.lastCheck.Metrics))
-	for k, v := range triggerChecker.lastCheck.Metrics {
-		lastMetrics[k] = v
-	}
-	checkData := moira.CheckData{
-		Metrics:                      lastMetrics,
+// newCheckData returns check data with given metrics states and trigger state of last check
+func (triggerChecker *TriggerChecker) newCheckData(metrics map[string]moira.MetricState) moira.CheckData {
+	return moira.CheckData{
+		Metrics:                      metrics,
 		State:                        triggerChecker.lastCheck.State,
 		Timestamp:                    triggerChecker.Until,
 		EventTimestamp:               triggerChecker.lastCheck.EventTimestamp,
@@ -67,8 +96,17 @@ func (triggerChecker *TriggerChecker) handleMetricsCheck() (moira.CheckData, err
 		Score:                        triggerChecker.lastCheck.Score,
 		Suppressed:                   triggerChecker.lastCheck.Suppressed,
 		SuppressedState:              triggerChecker.lastCheck.SuppressedState,
+		SuppressedDependencyID:       triggerChecker.lastCheck.SuppressedDependencyID,
 		LastSuccessfulCheckTimestamp: triggerChecker.lastCheck.LastSuccessfulCheckTimestamp,
 	}
+}
+
+func (triggerChecker *TriggerChecker) handleMetricsCheck() (moira.CheckData, error) {
+	lastMetrics := make(map[string]moira.MetricState, len(triggerChecker.lastCheck.Metrics))
+	for k, v := range triggerChecker.lastCheck.Metrics {
+		lastMetrics[k] = v
+	}
+	checkData := triggerChecker.newCheckData(lastMetrics)
 
 	var triggerTimeSeries *TriggerTimeSeries
 	var err error
@@ -91,6 +129,13 @@ func (triggerChecker *TriggerChecker) handleMetricsCheck() (moira.CheckData, err
 		return checkData, ErrTriggerHasNoTimeSeries{}
 	}
 
+	if triggerChecker.trigger.TriggerType == moira.AnomalyTrigger {
+		triggerTimeSeries.Baselines, err = triggerChecker.getBaselines(triggerChecker.From, triggerChecker.Until)
+		if err != nil {
+			return checkData, err
+		}
+	}
+
 	if triggerTimeSeries.hasOnlyWildcards() {
 		return checkData, ErrTriggerHasOnlyWildcards{}
 	}
@@ -127,6 +172,9 @@ func (triggerChecker *TriggerChecker) handleMetricsCheck() (moira.CheckData, err
 		}
 		return checkData, ErrTriggerHasSameTimeSeriesNames{names: names}
 	}
+	if len(triggerChecker.limitedPatterns) > 0 {
+		return checkData, ErrTriggerPatternsLimited{limits: triggerChecker.limitedPatterns}
+	}
 	return checkData, nil
 }
 
@@ -137,6 +185,7 @@ func (triggerChecker *TriggerChecker) checkTimeSeries(timeSeries *target.TimeSer
 		return
 	}
 	for _, currentState := range metricStates {
+		currentState = triggerChecker.applyPendingPoints(currentState, lastState)
 		lastState, err = triggerChecker.compareMetricStates(timeSeries.Name, currentState, lastState)
 		if err != nil {
 			return
@@ -154,7 +203,14 @@ func (triggerChecker *TriggerChecker) checkTimeSeries(timeSeries *target.TimeSer
 
 func (triggerChecker *TriggerChecker) handleTriggerCheck(checkData moira.CheckData, checkingError error) (moira.CheckData, error) {
 	if checkingError == nil {
-		checkData.State = OK
+		switch {
+		case triggerChecker.trigger.TriggerType == moira.CompositeTrigger:
+			// state of composite trigger is computed from states of its input triggers
+		case triggerChecker.trigger.Aggregation != nil:
+			checkData.State, checkData.Message = triggerChecker.getAggregatedState(checkData.Metrics)
+		default:
+			checkData.State = OK
+		}
 		if checkData.LastSuccessfulCheckTimestamp == 0 {
 			checkData.LastSuccessfulCheckTimestamp = checkData.Timestamp
 			return checkData, nil
@@ -174,7 +230,7 @@ func (triggerChecker *TriggerChecker) handleTriggerCheck(checkData moira.CheckDa
 				return checkData, nil
 			}
 		}
-	case ErrWrongTriggerTargets, ErrTriggerHasSameTimeSeriesNames:
+	case ErrWrongTriggerTargets, ErrTriggerHasSameTimeSeriesNames, ErrInvalidAnomalyTrigger, ErrInvalidCompositeTrigger:
 		checkData.State = ERROR
 		checkData.Message = checkingError.Error()
 	case remote.ErrRemoteTriggerResponse:
@@ -184,6 +240,10 @@ func (triggerChecker *TriggerChecker) handleTriggerCheck(checkData moira.CheckDa
 			checkData.Message = fmt.Sprintf("Remote server unavailable. Trigger is not checked for %d seconds", timeSinceLastSuccessfulCheck)
 		}
 		triggerChecker.Logger.Errorf("Trigger %s: %s", triggerChecker.TriggerID, checkingError.Error())
+	case ErrTriggerPatternsLimited:
+		checkData.State = EXCEPTION
+		checkData.Message = checkingError.Error()
+		triggerChecker.Logger.Warningf("Trigger %s: %s", triggerChecker.TriggerID, checkingError.Error())
 	case target.ErrUnknownFunction, target.ErrEvalExpr:
 		checkData.State = EXCEPTION
 		checkData.Message = checkingError.Error()
@@ -256,10 +316,21 @@ func (triggerChecker *TriggerChecker) getTimeSeriesState(triggerTimeSeries *Trig
 
 	triggerExpression.WarnValue = triggerChecker.trigger.WarnValue
 	triggerExpression.ErrorValue = triggerChecker.trigger.ErrorValue
+	triggerExpression.WarnRecoverValue = triggerChecker.trigger.WarnRecoverValue
+	triggerExpression.ErrorRecoverValue = triggerChecker.trigger.ErrorRecoverValue
 	triggerExpression.TriggerType = triggerChecker.trigger.TriggerType
 	triggerExpression.PreviousState = lastState.State
 	triggerExpression.Expression = triggerChecker.trigger.Expression
 
+	if triggerChecker.trigger.TriggerType == moira.AnomalyTrigger {
+		deviation, ok := triggerChecker.getDeviation(triggerTimeSeries.Baselines[timeSeries.Name], valueTimestamp, triggerExpression.MainTargetValue)
+		if !ok {
+			triggerChecker.Logger.Debugf("[TriggerID:%s][TimeSeries:%s] Not enough history to compute baseline for ts %v", triggerChecker.TriggerID, timeSeries.Name, valueTimestamp)
+			return nil, nil
+		}
+		triggerExpression.Deviation = deviation
+	}
+
 	expressionState, err := triggerExpression.Evaluate()
 	if err != nil {
 		return nil, err
@@ -265,6 +265,76 @@ func TestGetTimeSeriesStepsStates(t *testing.T) {
 	})
 }
 
+func TestCheckTimeSeriesWithPendingPoints(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dataBase := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("Test")
+	logging.SetLevel(logging.INFO, "Test")
+	var warnValue float64 = 10
+	var errValue float64 = 20
+	metric := "main.metric"
+	triggerChecker := TriggerChecker{
+		TriggerID: "SuperId",
+		Database:  dataBase,
+		Logger:    logger,
+		trigger: &moira.Trigger{
+			WarnValue:     &warnValue,
+			ErrorValue:    &errValue,
+			TriggerType:   moira.RisingTrigger,
+			PendingPoints: 5,
+		},
+		lastCheck: &moira.CheckData{
+			Metrics: map[string]moira.MetricState{
+				metric: {State: OK, Timestamp: 60, EventTimestamp: 60},
+			},
+		},
+	}
+	check := func(startTime int64, values ...float64) moira.MetricState {
+		fetchResponse := pb.FetchResponse{
+			Name:      metric,
+			StartTime: startTime,
+			StopTime:  startTime + int64(len(values))*60,
+			StepTime:  60,
+			Values:    values,
+		}
+		timeSeries := &target.TimeSeries{MetricData: types.MetricData{FetchResponse: fetchResponse}}
+		triggerChecker.Until = fetchResponse.StopTime - 60
+		metricState, needToDeleteMetric, err := triggerChecker.checkTimeSeries(timeSeries, &TriggerTimeSeries{
+			Main:       []*target.TimeSeries{timeSeries},
+			Additional: make([]*target.TimeSeries, 0),
+		})
+		So(err, ShouldBeNil)
+		So(needToDeleteMetric, ShouldBeFalse)
+		triggerChecker.lastCheck.Metrics[metric] = metricState
+		return metricState
+	}
+
+	Convey("Should count every bad point once in consecutive checks with overlapping intervals", t, func() {
+		metricState := check(0, 1, 1, 25, 25)
+		So(metricState.State, ShouldEqual, OK)
+		So(metricState.PendingPoints, ShouldEqual, 2)
+
+		metricState = check(60, 1, 25, 25, 25)
+		So(metricState.State, ShouldEqual, OK)
+		So(metricState.PendingPoints, ShouldEqual, 3)
+
+		metricState = check(60, 1, 25, 25, 25)
+		So(metricState.State, ShouldEqual, OK)
+		So(metricState.PendingPoints, ShouldEqual, 3)
+
+		metricState = check(120, 25, 25, 25, 25)
+		So(metricState.State, ShouldEqual, OK)
+		So(metricState.PendingPoints, ShouldEqual, 4)
+
+		dataBase.EXPECT().PushNotificationEvent(gomock.Any(), true).Return(nil)
+		metricState = check(180, 25, 25, 25, 25)
+		So(metricState.State, ShouldEqual, ERROR)
+		So(metricState.PendingPoints, ShouldEqual, 0)
+		So(metricState.EventTimestamp, ShouldEqual, 360)
+	})
+}
+
 func TestCheckForNODATA(t *testing.T) {
 	logger, _ := logging.GetLogger("Test")
 	logging.SetLevel(logging.INFO, "Test")
@@ -494,6 +564,7 @@ func TestCheckErrors(t *testing.T) {
 			dataBase.EXPECT().GetMetricsValues([]string{metric}, triggerChecker.From, triggerChecker.Until).Return(nil, unknownFunctionExc)
 			dataBase.EXPECT().PushNotificationEvent(&event, true).Return(nil)
 			dataBase.EXPECT().SetTriggerLastCheck(triggerChecker.TriggerID, &lastCheck, triggerChecker.trigger.IsRemote).Return(nil)
+			dataBase.EXPECT().GetCompositeTriggerIDs().Return(nil, nil)
 			err := triggerChecker.Check()
 			So(err, ShouldBeNil)
 		})
@@ -540,6 +611,7 @@ func TestCheckErrors(t *testing.T) {
 			dataBase.EXPECT().GetMetricsValues([]string{metric}, triggerChecker.From, triggerChecker.Until).Return(dataList, nil)
 			dataBase.EXPECT().PushNotificationEvent(&event, true).Return(nil)
 			dataBase.EXPECT().SetTriggerLastCheck(triggerChecker.TriggerID, &lastCheck, triggerChecker.trigger.IsRemote).Return(nil)
+			dataBase.EXPECT().GetCompositeTriggerIDs().Return(nil, nil)
 			err := triggerChecker.Check()
 			So(err, ShouldBeNil)
 		})
@@ -1191,6 +1263,39 @@ func TestHandleErrorCheck(t *testing.T) {
 		mockCtrl.Finish()
 	})
 
+	Convey("Handle trigger patterns reached limit of metrics", t, func() {
+		triggerChecker := TriggerChecker{
+			TriggerID: "SuperId",
+			Database:  dataBase,
+			Logger:    logger,
+			ttl:       60,
+			trigger:   &moira.Trigger{TriggerType: moira.RisingTrigger},
+			ttlState:  NODATA,
+			lastCheck: &moira.CheckData{
+				Timestamp: time.Now().Unix(),
+				State:     OK,
+			},
+		}
+		checkData := moira.CheckData{
+			State:     OK,
+			Timestamp: time.Now().Unix(),
+		}
+
+		dataBase.EXPECT().PushNotificationEvent(gomock.Any(), true).Return(nil)
+
+		actual, err := triggerChecker.handleTriggerCheck(checkData, ErrTriggerPatternsLimited{limits: map[string]int64{"second.*.*": 100, "first.*": 10}})
+		expected := moira.CheckData{
+			State:                        EXCEPTION,
+			Timestamp:                    checkData.Timestamp,
+			EventTimestamp:               checkData.Timestamp,
+			Message:                      "Trigger patterns reached limit of metrics, new metrics are not checked: first.* (10 metrics), second.*.* (100 metrics). Make patterns more specific",
+			LastSuccessfulCheckTimestamp: 0,
+		}
+		So(err, ShouldBeNil)
+		So(actual, ShouldResemble, expected)
+		mockCtrl.Finish()
+	})
+
 	Convey("Handle additional trigger target has more than one timeseries", t, func() {
 		triggerChecker := TriggerChecker{
 			TriggerID: "SuperId",
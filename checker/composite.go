@@ -0,0 +1,130 @@
+package checker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/expression"
+)
+
+// ErrInvalidCompositeTrigger used if composite trigger has invalid inputs or expression
+type ErrInvalidCompositeTrigger struct {
+	internalError error
+}
+
+// ErrInvalidCompositeTrigger implementation with error message of inputs or expression validation
+func (err ErrInvalidCompositeTrigger) Error() string {
+	return err.internalError.Error()
+}
+
+// handleCompositeCheck computes state of composite trigger from states of its input triggers
+func (triggerChecker *TriggerChecker) handleCompositeCheck() (moira.CheckData, error) {
+	checkData := triggerChecker.newCheckData(make(map[string]moira.MetricState))
+	composite := triggerChecker.trigger.Composite
+	if err := composite.Validate(); err != nil {
+		return checkData, ErrInvalidCompositeTrigger{internalError: err}
+	}
+	inputStates, err := triggerChecker.getCompositeInputStates()
+	if err != nil {
+		return checkData, err
+	}
+	if len(inputStates) == 0 {
+		return checkData, ErrInvalidCompositeTrigger{internalError: fmt.Errorf("composite trigger has no checked input triggers")}
+	}
+	compositeExpression := expression.CompositeExpression{
+		Expression:  composite.Expression,
+		InputStates: inputStates,
+	}
+	state, err := compositeExpression.Evaluate()
+	if err != nil {
+		return checkData, ErrInvalidCompositeTrigger{internalError: err}
+	}
+	triggerChecker.Logger.Debugf("[TriggerID:%s] Composite trigger state %s computed from input triggers states: %v", triggerChecker.TriggerID, state, inputStates)
+	checkData.State = state
+	checkData.Message = getInputStatesMessage(inputStates)
+	return checkData, nil
+}
+
+// getCompositeInputStates returns the worst states of input triggers of composite trigger by their IDs,
+// triggers which do not exist or were never checked are skipped
+func (triggerChecker *TriggerChecker) getCompositeInputStates() (map[string]string, error) {
+	composite := triggerChecker.trigger.Composite
+	inputIDs := make(map[string]bool)
+	for _, triggerID := range composite.TriggerIDs {
+		inputIDs[triggerID] = true
+	}
+	if len(composite.Tags) > 0 {
+		tagsTriggerIDs, err := triggerChecker.Database.GetTriggerCheckIDs(composite.Tags, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, triggerID := range tagsTriggerIDs {
+			inputIDs[triggerID] = true
+		}
+	}
+	delete(inputIDs, triggerChecker.TriggerID)
+
+	triggerIDs := make([]string, 0, len(inputIDs))
+	for triggerID := range inputIDs {
+		triggerIDs = append(triggerIDs, triggerID)
+	}
+	sort.Strings(triggerIDs)
+	triggerChecks, err := triggerChecker.Database.GetTriggerChecks(triggerIDs)
+	if err != nil {
+		return nil, err
+	}
+	inputStates := make(map[string]string, len(triggerChecks))
+	for i, triggerCheck := range triggerChecks {
+		if triggerCheck == nil || triggerCheck.LastCheck.State == "" {
+			continue
+		}
+		inputStates[triggerIDs[i]] = triggerCheck.LastCheck.GetWorstState()
+	}
+	return inputStates, nil
+}
+
+// addCompositeTriggersToCheck adds composite triggers which have checked trigger as input to triggers to check
+func (triggerChecker *TriggerChecker) addCompositeTriggersToCheck() error {
+	compositeTriggerIDs, err := triggerChecker.Database.GetCompositeTriggerIDs()
+	if err != nil || len(compositeTriggerIDs) == 0 {
+		return err
+	}
+	compositeTriggers, err := triggerChecker.Database.GetTriggers(compositeTriggerIDs)
+	if err != nil {
+		return err
+	}
+	triggerIDsToCheck := make([]string, 0)
+	for i, compositeTrigger := range compositeTriggers {
+		if compositeTrigger == nil || compositeTrigger.Composite == nil || compositeTriggerIDs[i] == triggerChecker.TriggerID {
+			continue
+		}
+		if compositeTrigger.Composite.HasInput(triggerChecker.TriggerID, triggerChecker.trigger.Tags) {
+			triggerIDsToCheck = append(triggerIDsToCheck, compositeTriggerIDs[i])
+		}
+	}
+	if len(triggerIDsToCheck) == 0 {
+		return nil
+	}
+	triggerChecker.Logger.Debugf("[TriggerID:%s] State changed, check composite triggers: %v", triggerChecker.TriggerID, triggerIDsToCheck)
+	return triggerChecker.Database.AddTriggersToCheck(triggerIDsToCheck)
+}
+
+// getInputStatesMessage returns message with numbers of input triggers in every state, e.g. "Input triggers states: ERROR: 2, OK: 3"
+func getInputStatesMessage(inputStates map[string]string) string {
+	counts := make(map[string]int)
+	for _, state := range inputStates {
+		counts[state]++
+	}
+	states := make([]string, 0, len(counts))
+	for state := range counts {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	stateCounts := make([]string, 0, len(states))
+	for _, state := range states {
+		stateCounts = append(stateCounts, fmt.Sprintf("%s: %d", state, counts[state]))
+	}
+	return fmt.Sprintf("Input triggers states: %s", strings.Join(stateCounts, ", "))
+}
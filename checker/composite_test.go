@@ -0,0 +1,100 @@
+package checker
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/mock/moira-alert"
+)
+
+func TestHandleCompositeCheck(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	logger, _ := logging.GetLogger("Test")
+	dataBase := mock_moira_alert.NewMockDatabase(mockCtrl)
+
+	triggerChecker := TriggerChecker{
+		TriggerID: "composite",
+		Database:  dataBase,
+		Logger:    logger,
+		Until:     100,
+		trigger: &moira.Trigger{
+			TriggerType: moira.CompositeTrigger,
+			Composite: &moira.CompositeData{
+				TriggerIDs: []string{"trigger1", "trigger2"},
+				Tags:       []string{"service"},
+				Expression: "ERROR_COUNT >= 2 ? ERROR : OK",
+			},
+		},
+		lastCheck: &moira.CheckData{State: OK, Timestamp: 40},
+	}
+
+	Convey("Should compute state from the worst states of input triggers", t, func() {
+		dataBase.EXPECT().GetTriggerCheckIDs([]string{"service"}, false).Return([]string{"composite", "trigger2", "trigger3", "trigger4"}, nil)
+		dataBase.EXPECT().GetTriggerChecks([]string{"trigger1", "trigger2", "trigger3", "trigger4"}).Return([]*moira.TriggerCheck{
+			{LastCheck: moira.CheckData{State: OK, Metrics: map[string]moira.MetricState{"m1": {State: ERROR}, "m2": {State: WARN}}}},
+			{LastCheck: moira.CheckData{State: ERROR}},
+			{LastCheck: moira.CheckData{State: OK}},
+			nil,
+		}, nil)
+		checkData, err := triggerChecker.handleCompositeCheck()
+		So(err, ShouldBeNil)
+		So(checkData.State, ShouldEqual, ERROR)
+		So(checkData.Timestamp, ShouldEqual, triggerChecker.Until)
+		So(checkData.Message, ShouldEqual, "Input triggers states: ERROR: 2, OK: 1")
+
+		checkData, err = triggerChecker.handleTriggerCheck(checkData, err)
+		So(err, ShouldBeNil)
+		So(checkData.State, ShouldEqual, ERROR)
+	})
+
+	Convey("Should return invalid composite trigger error if expression can not be evaluated", t, func() {
+		triggerChecker.trigger.Composite = &moira.CompositeData{TriggerIDs: []string{"trigger1"}, Expression: "[trigger5] == ERROR ? ERROR : OK"}
+		dataBase.EXPECT().GetTriggerChecks([]string{"trigger1"}).Return([]*moira.TriggerCheck{{LastCheck: moira.CheckData{State: OK}}}, nil)
+		_, err := triggerChecker.handleCompositeCheck()
+		So(err, ShouldHaveSameTypeAs, ErrInvalidCompositeTrigger{})
+	})
+
+	Convey("Should return invalid composite trigger error without inputs", t, func() {
+		triggerChecker.trigger.Composite = &moira.CompositeData{Expression: "OK"}
+		_, err := triggerChecker.handleCompositeCheck()
+		So(err, ShouldHaveSameTypeAs, ErrInvalidCompositeTrigger{})
+	})
+}
+
+func TestAddCompositeTriggersToCheck(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	logger, _ := logging.GetLogger("Test")
+	dataBase := mock_moira_alert.NewMockDatabase(mockCtrl)
+
+	triggerChecker := TriggerChecker{
+		TriggerID: "trigger1",
+		Database:  dataBase,
+		Logger:    logger,
+		trigger:   &moira.Trigger{Tags: []string{"service", "backend"}},
+	}
+
+	Convey("Should add composite triggers having checked trigger as input", t, func() {
+		dataBase.EXPECT().GetCompositeTriggerIDs().Return([]string{"composite1", "composite2", "composite3", "composite4"}, nil)
+		dataBase.EXPECT().GetTriggers([]string{"composite1", "composite2", "composite3", "composite4"}).Return([]*moira.Trigger{
+			{Composite: &moira.CompositeData{TriggerIDs: []string{"trigger1"}}},
+			{Composite: &moira.CompositeData{Tags: []string{"service"}}},
+			{Composite: &moira.CompositeData{TriggerIDs: []string{"trigger2"}, Tags: []string{"service", "frontend"}}},
+			nil,
+		}, nil)
+		dataBase.EXPECT().AddTriggersToCheck([]string{"composite1", "composite2"}).Return(nil)
+		err := triggerChecker.addCompositeTriggersToCheck()
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Should not add anything without composite triggers", t, func() {
+		dataBase.EXPECT().GetCompositeTriggerIDs().Return([]string{}, nil)
+		err := triggerChecker.addCompositeTriggersToCheck()
+		So(err, ShouldBeNil)
+	})
+}
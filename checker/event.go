@@ -7,6 +7,8 @@ import (
 	"github.com/moira-alert/moira"
 )
 
+// badStateReminder is a default interval in seconds of reminders about metric or trigger staying in bad state,
+// it is used if trigger has no remind interval of the state
 var badStateReminder = map[string]int64{
 	ERROR:  86400,
 	NODATA: 86400,
@@ -30,8 +32,10 @@ func (triggerChecker *TriggerChecker) compareTriggerStates(currentCheck moira.Ch
 	}
 
 	currentCheck.SuppressedState = lastStateSuppressedValue
+	currentCheck.SuppressedDependencyID = triggerChecker.lastCheck.SuppressedDependencyID
 
-	needSend, message := needSendEvent(currentStateValue, lastStateValue, timestamp, triggerChecker.lastCheck.GetEventTimestamp(), lastStateSuppressed, lastStateSuppressedValue)
+	remindInterval := triggerChecker.getRemindInterval(currentStateValue)
+	needSend, message := needSendEvent(currentStateValue, lastStateValue, timestamp, triggerChecker.lastCheck.GetEventTimestamp(), lastStateSuppressed, lastStateSuppressedValue, currentCheck.SuppressedDependencyID, remindInterval)
 	if !needSend {
 		return currentCheck, nil
 	}
@@ -62,17 +66,22 @@ func (triggerChecker *TriggerChecker) compareTriggerStates(currentCheck moira.Ch
 		currentCheck.Suppressed = true
 		if !lastStateSuppressed {
 			currentCheck.SuppressedState = lastStateValue
+			currentCheck.SuppressedDependencyID = triggerChecker.badDependencyID
 		}
 		return currentCheck, nil
 	}
 
 	currentCheck.SuppressedState = ""
+	currentCheck.SuppressedDependencyID = ""
 	triggerChecker.Logger.Debugf("Writing new event: %v", event)
 	err := triggerChecker.Database.PushNotificationEvent(&event, true)
 	return currentCheck, err
 }
 
 func (triggerChecker *TriggerChecker) compareMetricStates(metric string, currentState moira.MetricState, lastState moira.MetricState) (moira.MetricState, error) {
+	if triggerChecker.trackMetricState != nil {
+		triggerChecker.trackMetricState(metric, lastState.State, currentState.State, currentState.Timestamp)
+	}
 	if lastState.EventTimestamp != 0 {
 		currentState.EventTimestamp = lastState.EventTimestamp
 	} else {
@@ -84,8 +93,10 @@ func (triggerChecker *TriggerChecker) compareMetricStates(metric string, current
 	}
 
 	currentState.SuppressedState = lastState.SuppressedState
+	currentState.SuppressedDependencyID = lastState.SuppressedDependencyID
 
-	needSend, message := needSendEvent(currentState.State, lastState.State, currentState.Timestamp, lastState.GetEventTimestamp(), lastState.Suppressed, lastState.SuppressedState)
+	remindInterval := triggerChecker.getRemindInterval(currentState.State)
+	needSend, message := needSendEvent(currentState.State, lastState.State, currentState.Timestamp, lastState.GetEventTimestamp(), lastState.Suppressed, lastState.SuppressedState, lastState.SuppressedDependencyID, remindInterval)
 	if !needSend {
 		return currentState, nil
 	}
@@ -112,16 +123,54 @@ func (triggerChecker *TriggerChecker) compareMetricStates(metric string, current
 		currentState.Suppressed = true
 		if !lastState.Suppressed {
 			currentState.SuppressedState = lastState.State
+			currentState.SuppressedDependencyID = triggerChecker.badDependencyID
 		}
 		return currentState, nil
 	}
 
 	currentState.SuppressedState = ""
+	currentState.SuppressedDependencyID = ""
+	if triggerChecker.trigger.Aggregation != nil {
+		triggerChecker.Logger.Debugf("Event %v is not sent, metrics states are aggregated to trigger state", event)
+		return currentState, nil
+	}
 	triggerChecker.Logger.Debugf("Writing new event: %v", event)
 	err := triggerChecker.Database.PushNotificationEvent(&event, true)
 	return currentState, err
 }
 
+// applyPendingPoints keeps last state of metric until trigger pending points in a row are evaluated to the same WARN or ERROR state,
+// the number of such points is kept in pending state of metric. Points after check point are re-evaluated by every check,
+// so only points newer than the latest counted one are counted
+func (triggerChecker *TriggerChecker) applyPendingPoints(currentState moira.MetricState, lastState moira.MetricState) moira.MetricState {
+	currentState.PendingState = ""
+	currentState.PendingPoints = 0
+	currentState.PendingTimestamp = 0
+	if triggerChecker.trigger.PendingPoints <= 1 || currentState.State == lastState.State {
+		return currentState
+	}
+	if currentState.State != WARN && currentState.State != ERROR {
+		return currentState
+	}
+	pendingPoints := 1
+	pendingTimestamp := currentState.Timestamp
+	if lastState.PendingState == currentState.State {
+		pendingPoints, pendingTimestamp = lastState.PendingPoints, lastState.PendingTimestamp
+		if currentState.Timestamp > lastState.PendingTimestamp {
+			pendingPoints, pendingTimestamp = pendingPoints+1, currentState.Timestamp
+		}
+	}
+	if pendingPoints >= triggerChecker.trigger.PendingPoints {
+		return currentState
+	}
+	triggerChecker.Logger.Debugf("[TriggerID:%s] Metric state %s is pending for %d of %d points", triggerChecker.TriggerID, currentState.State, pendingPoints, triggerChecker.trigger.PendingPoints)
+	currentState.PendingState = currentState.State
+	currentState.PendingPoints = pendingPoints
+	currentState.PendingTimestamp = pendingTimestamp
+	currentState.State = lastState.State
+	return currentState
+}
+
 func (triggerChecker *TriggerChecker) isTriggerSuppressed(event *moira.NotificationEvent, timestamp int64, metricMaintenance int64, triggerMaintenance int64, metric string) bool {
 	if !triggerChecker.trigger.Schedule.IsScheduleAllows(timestamp) {
 		triggerChecker.Logger.Debugf("Event %v suppressed due to trigger schedule", event)
@@ -136,25 +185,53 @@ func (triggerChecker *TriggerChecker) isTriggerSuppressed(event *moira.Notificat
 		triggerChecker.Logger.Debugf("Event %v suppressed due to metric %s maintenance until %v.", event, metric, time.Unix(metricMaintenance, 0))
 		return true
 	}
+	if triggerChecker.badDependencyID != "" {
+		triggerChecker.Logger.Debugf("Event %v suppressed due to bad state of trigger %s which trigger %s depends on.", event, triggerChecker.badDependencyID, triggerChecker.TriggerID)
+		return true
+	}
 	return false
 }
 
-func needSendEvent(currentStateValue string, lastStateValue string, currentStateTimestamp int64, lastStateEventTimestamp int64, isLastCheckSuppressed bool, lastStateSuppressedValue string) (needSend bool, message *string) {
+// getRemindInterval returns interval in seconds of reminders about metric or trigger staying in given state, 0 means no reminders
+func (triggerChecker *TriggerChecker) getRemindInterval(state string) int64 {
+	if remindInterval, ok := triggerChecker.trigger.RemindIntervals[state]; ok {
+		return remindInterval
+	}
+	return badStateReminder[state]
+}
+
+func needSendEvent(currentStateValue string, lastStateValue string, currentStateTimestamp int64, lastStateEventTimestamp int64, isLastCheckSuppressed bool, lastStateSuppressedValue string, lastStateSuppressedDependencyID string, remindInterval int64) (needSend bool, message *string) {
 	if !isLastCheckSuppressed && currentStateValue != lastStateValue {
 		return true, nil
 	}
 	if isLastCheckSuppressed && currentStateValue != lastStateSuppressedValue {
 		message := "This metric changed its state during maintenance interval."
+		if lastStateSuppressedDependencyID != "" {
+			message = fmt.Sprintf("This metric changed its state while trigger %s it depends on was in bad state.", lastStateSuppressedDependencyID)
+		}
 		return true, &message
 	}
-	remindInterval, ok := badStateReminder[currentStateValue]
-	if ok && needRemindAgain(currentStateTimestamp, lastStateEventTimestamp, remindInterval) {
-		message := fmt.Sprintf("This metric has been in bad state for more than %v hours - please, fix.", remindInterval/3600)
+	if remindInterval > 0 && needRemindAgain(currentStateTimestamp, lastStateEventTimestamp, remindInterval) {
+		message := fmt.Sprintf("This metric has been in bad state for more than %s - please, fix.", formatRemindInterval(remindInterval))
 		return true, &message
 	}
 	return false, nil
 }
 
+// formatRemindInterval returns remind interval in the largest of hours, minutes or seconds units which it is a multiple of
+func formatRemindInterval(remindInterval int64) string {
+	value, unit := remindInterval, "second"
+	if remindInterval%3600 == 0 {
+		value, unit = remindInterval/3600, "hour"
+	} else if remindInterval%60 == 0 {
+		value, unit = remindInterval/60, "minute"
+	}
+	if value != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", value, unit)
+}
+
 func needRemindAgain(currentStateTimestamp, lastStateEventTimestamp, remindInterval int64) bool {
 	return currentStateTimestamp-lastStateEventTimestamp >= remindInterval
 }
@@ -507,3 +507,160 @@ func TestTriggerMaintenance(t *testing.T) {
 		})
 	})
 }
+
+func TestBadDependencySuppression(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	logger, _ := logging.GetLogger("Test")
+	dataBase := mock_moira_alert.NewMockDatabase(mockCtrl)
+
+	triggerChecker := TriggerChecker{
+		TriggerID:       "SuperId",
+		Database:        dataBase,
+		Logger:          logger,
+		trigger:         &moira.Trigger{Dependencies: []string{"parentId"}},
+		lastCheck:       &moira.CheckData{},
+		badDependencyID: "parentId",
+	}
+
+	Convey("Should suppress event while parent trigger is in bad state", t, func() {
+		lastState := moira.MetricState{Timestamp: 100, EventTimestamp: 10, State: OK}
+		currentState := moira.MetricState{Timestamp: 200, State: ERROR}
+
+		actual, err := triggerChecker.compareMetricStates("m1", currentState, lastState)
+		So(err, ShouldBeNil)
+		So(actual.Suppressed, ShouldBeTrue)
+		So(actual.SuppressedState, ShouldEqual, OK)
+		So(actual.SuppressedDependencyID, ShouldEqual, "parentId")
+
+		Convey("Should send event when parent trigger recovers", func() {
+			triggerChecker.badDependencyID = ""
+			currentState := moira.MetricState{Timestamp: 300, State: ERROR}
+
+			message := "This metric changed its state while trigger parentId it depends on was in bad state."
+			dataBase.EXPECT().PushNotificationEvent(&moira.NotificationEvent{
+				TriggerID: triggerChecker.TriggerID,
+				Timestamp: currentState.Timestamp,
+				State:     ERROR,
+				OldState:  OK,
+				Metric:    "m1",
+				Message:   &message,
+			}, true).Return(nil)
+			actual, err := triggerChecker.compareMetricStates("m1", currentState, actual)
+			So(err, ShouldBeNil)
+			So(actual.Suppressed, ShouldBeFalse)
+			So(actual.SuppressedState, ShouldBeEmpty)
+			So(actual.SuppressedDependencyID, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestApplyPendingPoints(t *testing.T) {
+	logger, _ := logging.GetLogger("Test")
+	triggerChecker := TriggerChecker{
+		TriggerID: "SuperId",
+		Logger:    logger,
+		trigger:   &moira.Trigger{PendingPoints: 3},
+	}
+	lastState := moira.MetricState{State: OK, Timestamp: 10}
+
+	Convey("Should keep last state until required points in a row are in bad state", t, func() {
+		currentState := triggerChecker.applyPendingPoints(moira.MetricState{State: ERROR, Timestamp: 20}, lastState)
+		So(currentState, ShouldResemble, moira.MetricState{State: OK, Timestamp: 20, PendingState: ERROR, PendingPoints: 1, PendingTimestamp: 20})
+
+		currentState = triggerChecker.applyPendingPoints(moira.MetricState{State: ERROR, Timestamp: 30}, currentState)
+		So(currentState, ShouldResemble, moira.MetricState{State: OK, Timestamp: 30, PendingState: ERROR, PendingPoints: 2, PendingTimestamp: 30})
+
+		currentState = triggerChecker.applyPendingPoints(moira.MetricState{State: ERROR, Timestamp: 40}, currentState)
+		So(currentState, ShouldResemble, moira.MetricState{State: ERROR, Timestamp: 40})
+	})
+
+	Convey("Should not count again points re-evaluated by next checks", t, func() {
+		currentState := triggerChecker.applyPendingPoints(moira.MetricState{State: ERROR, Timestamp: 20}, lastState)
+		currentState = triggerChecker.applyPendingPoints(moira.MetricState{State: ERROR, Timestamp: 30}, currentState)
+		currentState = triggerChecker.applyPendingPoints(moira.MetricState{State: ERROR, Timestamp: 20}, currentState)
+		currentState = triggerChecker.applyPendingPoints(moira.MetricState{State: ERROR, Timestamp: 30}, currentState)
+		So(currentState, ShouldResemble, moira.MetricState{State: OK, Timestamp: 30, PendingState: ERROR, PendingPoints: 2, PendingTimestamp: 30})
+	})
+
+	Convey("Should restart counting if state of point differs from pending one", t, func() {
+		currentState := triggerChecker.applyPendingPoints(moira.MetricState{State: ERROR, Timestamp: 20}, lastState)
+		currentState = triggerChecker.applyPendingPoints(moira.MetricState{State: WARN, Timestamp: 30}, currentState)
+		So(currentState, ShouldResemble, moira.MetricState{State: OK, Timestamp: 30, PendingState: WARN, PendingPoints: 1, PendingTimestamp: 30})
+
+		currentState = triggerChecker.applyPendingPoints(moira.MetricState{State: OK, Timestamp: 40}, currentState)
+		So(currentState, ShouldResemble, moira.MetricState{State: OK, Timestamp: 40})
+	})
+
+	Convey("Should switch to not bad state immediately", t, func() {
+		currentState := triggerChecker.applyPendingPoints(moira.MetricState{State: OK, Timestamp: 20}, moira.MetricState{State: ERROR, Timestamp: 10})
+		So(currentState, ShouldResemble, moira.MetricState{State: OK, Timestamp: 20})
+	})
+
+	Convey("Should switch to bad state immediately without pending points", t, func() {
+		triggerChecker.trigger.PendingPoints = 0
+		currentState := triggerChecker.applyPendingPoints(moira.MetricState{State: ERROR, Timestamp: 20}, lastState)
+		So(currentState, ShouldResemble, moira.MetricState{State: ERROR, Timestamp: 20})
+	})
+}
+
+func TestCompareMetricStatesWithRemindIntervals(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	logger, _ := logging.GetLogger("Test")
+	dataBase := mock_moira_alert.NewMockDatabase(mockCtrl)
+
+	triggerChecker := TriggerChecker{
+		TriggerID: "SuperId",
+		Database:  dataBase,
+		Logger:    logger,
+		trigger:   &moira.Trigger{RemindIntervals: map[string]int64{WARN: 7200, NODATA: 0}},
+		lastCheck: &moira.CheckData{},
+	}
+	lastState := moira.MetricState{Timestamp: 1502712000, EventTimestamp: 1502708400}
+
+	Convey("Should remind about state with trigger remind interval", t, func() {
+		lastState.State = WARN
+		currentState := moira.MetricState{State: WARN, Timestamp: 1502715600}
+
+		message := "This metric has been in bad state for more than 2 hours - please, fix."
+		dataBase.EXPECT().PushNotificationEvent(&moira.NotificationEvent{
+			TriggerID: triggerChecker.TriggerID,
+			Timestamp: currentState.Timestamp,
+			State:     WARN,
+			OldState:  WARN,
+			Metric:    "m1",
+			Message:   &message,
+		}, true).Return(nil)
+		actual, err := triggerChecker.compareMetricStates("m1", currentState, lastState)
+		So(err, ShouldBeNil)
+		So(actual.EventTimestamp, ShouldEqual, currentState.Timestamp)
+	})
+
+	Convey("Should not remind about state with zero remind interval", t, func() {
+		lastState.State = NODATA
+		currentState := moira.MetricState{State: NODATA, Timestamp: 1502809200}
+
+		actual, err := triggerChecker.compareMetricStates("m1", currentState, lastState)
+		So(err, ShouldBeNil)
+		So(actual.EventTimestamp, ShouldEqual, lastState.EventTimestamp)
+	})
+
+	Convey("Should use default remind interval of state without trigger one", t, func() {
+		lastState.State = ERROR
+		currentState := moira.MetricState{State: ERROR, Timestamp: 1502715600}
+
+		actual, err := triggerChecker.compareMetricStates("m1", currentState, lastState)
+		So(err, ShouldBeNil)
+		So(actual.EventTimestamp, ShouldEqual, lastState.EventTimestamp)
+	})
+}
+
+func TestFormatRemindInterval(t *testing.T) {
+	Convey("Should format remind interval in the largest units", t, func() {
+		So(formatRemindInterval(86400), ShouldEqual, "24 hours")
+		So(formatRemindInterval(3600), ShouldEqual, "1 hour")
+		So(formatRemindInterval(5400), ShouldEqual, "90 minutes")
+		So(formatRemindInterval(90), ShouldEqual, "90 seconds")
+	})
+}
@@ -16,6 +16,8 @@ import (
 type TriggerTimeSeries struct {
 	Main       []*target.TimeSeries
 	Additional []*target.TimeSeries
+	// Baselines are histories of main target timeseries of anomaly trigger by their names
+	Baselines map[string][]baselineTimeSeries
 }
 
 // ErrWrongTriggerTargets represents targets with inconsistent number of timeseries
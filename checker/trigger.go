@@ -27,6 +27,12 @@ type TriggerChecker struct {
 
 	ttl      int64
 	ttlState string
+
+	limitedPatterns map[string]int64
+	// badDependencyID is an ID of parent trigger being in bad state, events of trigger are suppressed while it is set
+	badDependencyID string
+	// trackMetricState is called with every evaluated metric state if it is set, backtesting uses it to count time metrics spent in states
+	trackMetricState func(metric string, lastState, currentState string, timestamp int64)
 }
 
 // ErrTriggerNotExists used if trigger to check does not exists
@@ -64,6 +70,18 @@ func (triggerChecker *TriggerChecker) InitTriggerChecker() error {
 		triggerChecker.From = triggerChecker.From - 600
 	}
 
+	if !trigger.IsRemote && len(trigger.Patterns) > 0 {
+		triggerChecker.limitedPatterns, err = triggerChecker.Database.GetLimitedPatterns(trigger.Patterns)
+		if err != nil {
+			return err
+		}
+	}
+
+	triggerChecker.badDependencyID, err = getBadDependencyID(triggerChecker.Database, trigger.Dependencies)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -87,3 +105,37 @@ func getLastCheck(dataBase moira.Database, triggerID string, emptyLastCheckTimes
 
 	return &lastCheck, nil
 }
+
+// getBadDependencyID returns ID of the first of parent triggers which last check is in bad state, or empty string if all of them are fine
+func getBadDependencyID(dataBase moira.Database, dependencies []string) (string, error) {
+	for _, parentID := range dependencies {
+		parentCheck, err := dataBase.GetTriggerLastCheck(parentID)
+		if err != nil {
+			if err == database.ErrNil {
+				continue
+			}
+			return "", err
+		}
+		if isBadCheck(parentCheck) {
+			return parentID, nil
+		}
+	}
+	return "", nil
+}
+
+// isBadCheck returns true if trigger state or state of any of its metrics is ERROR, NODATA or EXCEPTION
+func isBadCheck(checkData moira.CheckData) bool {
+	if isBadState(checkData.State) {
+		return true
+	}
+	for _, metricState := range checkData.Metrics {
+		if isBadState(metricState.State) {
+			return true
+		}
+	}
+	return false
+}
+
+func isBadState(state string) bool {
+	return state == ERROR || state == NODATA || state == EXCEPTION
+}
@@ -47,6 +47,16 @@ func TestInitTriggerChecker(t *testing.T) {
 			So(err, ShouldBeError)
 			So(err, ShouldResemble, readLastCheckError)
 		})
+
+		Convey("Get limited patterns error", func() {
+			readLimitedPatternsError := fmt.Errorf("Oppps! Can't read limited patterns")
+			dataBase.EXPECT().GetTrigger(triggerChecker.TriggerID).Return(moira.Trigger{TriggerType: moira.RisingTrigger, Patterns: []string{"super.*"}}, nil)
+			dataBase.EXPECT().GetTriggerLastCheck(triggerChecker.TriggerID).Return(moira.CheckData{}, database.ErrNil)
+			dataBase.EXPECT().GetLimitedPatterns([]string{"super.*"}).Return(nil, readLimitedPatternsError)
+			err := triggerChecker.InitTriggerChecker()
+			So(err, ShouldBeError)
+			So(err, ShouldResemble, readLimitedPatternsError)
+		})
 	})
 
 	var warnWalue float64 = 10000
@@ -107,6 +117,7 @@ func TestInitTriggerChecker(t *testing.T) {
 	Convey("Test trigger checker with lastCheck", t, func() {
 		dataBase.EXPECT().GetTrigger(triggerChecker.TriggerID).Return(trigger, nil)
 		dataBase.EXPECT().GetTriggerLastCheck(triggerChecker.TriggerID).Return(lastCheck, nil)
+		dataBase.EXPECT().GetLimitedPatterns(trigger.Patterns).Return(map[string]int64{}, nil)
 		err := triggerChecker.InitTriggerChecker()
 		So(err, ShouldBeNil)
 
@@ -122,6 +133,7 @@ func TestInitTriggerChecker(t *testing.T) {
 	Convey("Test trigger checker without lastCheck", t, func() {
 		dataBase.EXPECT().GetTrigger(triggerChecker.TriggerID).Return(trigger, nil)
 		dataBase.EXPECT().GetTriggerLastCheck(triggerChecker.TriggerID).Return(moira.CheckData{}, database.ErrNil)
+		dataBase.EXPECT().GetLimitedPatterns(trigger.Patterns).Return(map[string]int64{}, nil)
 		err := triggerChecker.InitTriggerChecker()
 		So(err, ShouldBeNil)
 
@@ -144,6 +156,7 @@ func TestInitTriggerChecker(t *testing.T) {
 	Convey("Test trigger checker without lastCheck and ttl", t, func() {
 		dataBase.EXPECT().GetTrigger(triggerChecker.TriggerID).Return(trigger, nil)
 		dataBase.EXPECT().GetTriggerLastCheck(triggerChecker.TriggerID).Return(moira.CheckData{}, database.ErrNil)
+		dataBase.EXPECT().GetLimitedPatterns(trigger.Patterns).Return(map[string]int64{}, nil)
 		err := triggerChecker.InitTriggerChecker()
 		So(err, ShouldBeNil)
 
@@ -163,6 +176,7 @@ func TestInitTriggerChecker(t *testing.T) {
 	Convey("Test trigger checker with lastCheck and without ttl", t, func() {
 		dataBase.EXPECT().GetTrigger(triggerChecker.TriggerID).Return(trigger, nil)
 		dataBase.EXPECT().GetTriggerLastCheck(triggerChecker.TriggerID).Return(lastCheck, nil)
+		dataBase.EXPECT().GetLimitedPatterns(trigger.Patterns).Return(map[string]int64{}, nil)
 		err := triggerChecker.InitTriggerChecker()
 		So(err, ShouldBeNil)
 
@@ -175,3 +189,32 @@ func TestInitTriggerChecker(t *testing.T) {
 		So(triggerChecker, ShouldResemble, expectedTriggerChecker)
 	})
 }
+
+func TestGetBadDependencyID(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	dataBase := mock_moira_alert.NewMockDatabase(mockCtrl)
+	defer mockCtrl.Finish()
+
+	Convey("Should return first parent trigger in bad state", t, func() {
+		dataBase.EXPECT().GetTriggerLastCheck("parent1").Return(moira.CheckData{}, database.ErrNil)
+		dataBase.EXPECT().GetTriggerLastCheck("parent2").Return(moira.CheckData{State: OK, Metrics: map[string]moira.MetricState{"m1": {State: WARN}}}, nil)
+		dataBase.EXPECT().GetTriggerLastCheck("parent3").Return(moira.CheckData{State: OK, Metrics: map[string]moira.MetricState{"m1": {State: NODATA}}}, nil)
+		badDependencyID, err := getBadDependencyID(dataBase, []string{"parent1", "parent2", "parent3", "parent4"})
+		So(err, ShouldBeNil)
+		So(badDependencyID, ShouldEqual, "parent3")
+	})
+
+	Convey("Should return empty ID if parent triggers are fine", t, func() {
+		dataBase.EXPECT().GetTriggerLastCheck("parent1").Return(moira.CheckData{State: OK}, nil)
+		badDependencyID, err := getBadDependencyID(dataBase, []string{"parent1"})
+		So(err, ShouldBeNil)
+		So(badDependencyID, ShouldBeEmpty)
+	})
+
+	Convey("Should return error of reading parent trigger last check", t, func() {
+		readLastCheckError := fmt.Errorf("Oppps! Can't read last check")
+		dataBase.EXPECT().GetTriggerLastCheck("parent1").Return(moira.CheckData{}, readLastCheckError)
+		_, err := getBadDependencyID(dataBase, []string{"parent1"})
+		So(err, ShouldResemble, readLastCheckError)
+	})
+}
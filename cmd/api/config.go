@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/gosexy/to"
 	"github.com/moira-alert/moira/api"
 	"github.com/moira-alert/moira/cmd"
 )
@@ -21,12 +22,15 @@ type apiConfig struct {
 	EnableCORS bool `yaml:"enable_cors"`
 	// Web_UI config file path. If file not found, api will return 404 in response to "api/config"
 	WebConfigPath string `yaml:"web_config_path"`
+	// Time to live of metrics values, it should be the same as checker metrics_ttl. Used to validate triggers needing metrics history
+	MetricsTTL string `yaml:"metrics_ttl"`
 }
 
 func (config *apiConfig) getSettings() *api.Config {
 	return &api.Config{
-		Listen:     config.Listen,
-		EnableCORS: config.EnableCORS,
+		Listen:            config.Listen,
+		EnableCORS:        config.EnableCORS,
+		MetricsTTLSeconds: int64(to.Duration(config.MetricsTTL).Seconds()),
 	}
 }
 
@@ -44,6 +48,7 @@ func getDefault() config {
 			Listen:        ":8081",
 			WebConfigPath: "/etc/moira/web.json",
 			EnableCORS:    false,
+			MetricsTTL:    "1h",
 		},
 		Graphite: cmd.GraphiteConfig{
 			RuntimeStats: false,
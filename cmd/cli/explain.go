@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/moira-alert/moira/filter"
+	"github.com/moira-alert/moira/filter/debug"
+)
+
+// explainMetric requests explanation of metric handling from filter debug server
+func explainMetric(filterDebugURI, metric string) (*filter.MetricExplanation, error) {
+	if filterDebugURI == "" {
+		return nil, fmt.Errorf("filter debug server uri is not set")
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	response, err := client.Get(strings.TrimSuffix(filterDebugURI, "/") + debug.MatchPath + "?metric=" + url.QueryEscape(metric))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("filter debug server returned %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	explanation := &filter.MetricExplanation{}
+	if err := json.Unmarshal(body, explanation); err != nil {
+		return nil, fmt.Errorf("failed to parse filter debug server response: %s", err.Error())
+	}
+	return explanation, nil
+}
+
+func printExplanation(explanation *filter.MetricExplanation) {
+	fmt.Printf("Metric: %s\n", explanation.Metric)
+	if len(explanation.Rules) > 0 {
+		fmt.Printf("Matched rules: %s\n", strings.Join(explanation.Rules, ", "))
+	}
+	if explanation.Dropped {
+		fmt.Println("Metric is dropped by rules")
+		return
+	}
+	if explanation.Name != explanation.Metric {
+		fmt.Printf("Matched as: %s\n", explanation.Name)
+	}
+	fmt.Printf("Retention: %ds, timestamp policy: %s, aggregation method: %s\n", explanation.Retention, explanation.TimestampPolicy, explanation.AggregationMethod)
+	if len(explanation.Patterns) == 0 {
+		fmt.Println("No patterns are matched")
+		return
+	}
+	fmt.Println("Matched patterns:")
+	for _, pattern := range explanation.Patterns {
+		fmt.Printf("  %s\n", pattern.Pattern)
+		if len(pattern.TriggerIDs) == 0 {
+			fmt.Println("    no triggers")
+		}
+		for _, triggerID := range pattern.TriggerIDs {
+			fmt.Printf("    trigger %s\n", triggerID)
+		}
+	}
+}
@@ -41,6 +41,11 @@ var (
 	plotting = flag.Bool("plotting", false, "enable images in all notifications")
 )
 
+var (
+	explain        = flag.String("explain-metric", "", "print patterns and triggers matched by metric with given name and its retention, filter debug server must be enabled")
+	filterDebugURI = flag.String("filter-debug-uri", "http://localhost:8081", "uri of filter debug server used by '-explain-metric'")
+)
+
 func main() {
 	logger, dataBase := initApp()
 
@@ -86,6 +91,14 @@ func main() {
 			logger.Errorf("failed to enable images in all notifications")
 		}
 	}
+
+	if *explain != "" {
+		explanation, err := explainMetric(*filterDebugURI, *explain)
+		if err != nil {
+			logger.Fatalf("Failed to explain metric %s: %s", *explain, err.Error())
+		}
+		printExplanation(explanation)
+	}
 }
 
 func initApp() (moira.Logger, moira.Database) {
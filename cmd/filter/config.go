@@ -1,7 +1,11 @@
 package main
 
 import (
+	"github.com/gosexy/to"
 	"github.com/moira-alert/moira/cmd"
+	"github.com/moira-alert/moira/filter"
+	"github.com/moira-alert/moira/filter/connection"
+	"github.com/moira-alert/moira/filter/relay"
 )
 
 type config struct {
@@ -15,18 +19,209 @@ type config struct {
 type filterConfig struct {
 	// Metrics listener uri
 	Listen string `yaml:"listen"`
+	// Limits of lines rate of every plaintext (TCP and TLS) connection
+	Connections connectionsConfig `yaml:"connections"`
+	// Metrics UDP listener uri, leave empty to disable listening for graphite plaintext over UDP
+	ListenUDP string `yaml:"listen_udp"`
+	// Max size of UDP datagram in bytes, longer datagrams are truncated to the last complete line.
+	MaxUDPPacketSize int `yaml:"max_udp_packet_size"`
+	// Metrics pickle protocol listener uri (carbon uses port 2004 for it), leave empty to disable pickle listener
+	ListenPickle string `yaml:"listen_pickle"`
+	// Prometheus remote-write listener uri, leave empty to disable it.
+	// Prometheus should be configured to send samples to http://<filter host><listen_prometheus>/api/v1/write
+	ListenPrometheus string `yaml:"listen_prometheus"`
+	// Rules of flattening prometheus series labels into metric names
+	Prometheus prometheusConfig `yaml:"prometheus"`
+	// InfluxDB line protocol listeners (e.g. for telegraf agents)
+	Influx influxConfig `yaml:"influx"`
+	// Graphite plaintext over TLS listener with optional client certificate authentication
+	TLS tlsConfig `yaml:"tls"`
+	// Sanity window of metric timestamps relative to current time
+	TimestampWindow timestampWindowConfig `yaml:"timestamp_window"`
 	// Retentions config file path.
 	// Simply use your original storage-schemas.conf or create new if you're using Moira without existing Graphite installation.
 	RetentionConfig string `yaml:"retention_config"`
+	// Aggregations config file path, leave empty to keep the last received value of points falling into the same retention slot.
+	// Use your original storage-aggregation.conf to merge such points with the same aggregation methods as graphite does:
+	// average (avg), sum, min, max, last or count
+	AggregationConfig string `yaml:"aggregation_config"`
+	// Rules config file path, leave empty to disable rules.
+	// Rules drop metrics by glob or regex, allow them or rewrite their names before matching with patterns, see storage-schemas.conf-like example in pkg/filter/rules.conf
+	RulesConfig string `yaml:"rules_config"`
 	// Number of metrics to cache before checking them.
 	// Note: As this value increases, Redis CPU usage decreases.
 	// Normally, this value must be an order of magnitude less than graphite.prefix.filter.recevied.matching.count | nonNegativeDerivative() | scaleToSeconds(1)
 	// For example: with 100 matching metrics, set cache_capacity to 10. With 1000 matching metrics, increase cache_capacity up to 100.
 	CacheCapacity int `yaml:"cache_capacity"`
+	// Max number of metrics of single trigger pattern, 0 means no limit.
+	// New metrics are not added to pattern having so many metrics and triggers of it are switched to EXCEPTION state
+	PatternMetricsLimit int64 `yaml:"pattern_metrics_limit"`
+	// Limits of filter caches of last received values and retentions of metrics, they are kept per metric name
+	Caches cachesConfig `yaml:"caches"`
+	// Forwarding of received metrics to downstream carbon
+	Relay relayConfig `yaml:"relay"`
+	// On-disk spool of matched metrics failed to save to Redis, they are saved in the same order once Redis is available again
+	Spool spoolConfig `yaml:"spool"`
+	// Debug HTTP server uri, leave empty to disable it.
+	// Stats of open plaintext connections are available at http://<filter host><debug_listen>/connections,
+	// patterns, triggers and retention of metric are explained at http://<filter host><debug_listen>/match?metric=<metric name>
+	DebugListen string `yaml:"debug_listen"`
 	// Max concurrent metric matchers to run. Equals to the number of processor cores found on Moira host by default or when variable is defined as 0.
 	MaxParallelMatches int `yaml:"max_parallel_matches"`
 }
 
+type prometheusConfig struct {
+	// Make graphite tagged series "name;label1=value1;label2=value2" instead of dotted metric path
+	Tagged bool `yaml:"tagged"`
+	// Prefix of all metric names made from prometheus series
+	Prefix string `yaml:"prefix"`
+	// Ordered list of labels whose values make up dotted metric path after metric name, e.g. [job, instance] makes "name.job.instance".
+	// If empty, all labels sorted by name are added to the path as "label.value" pairs. Ignored for tagged series.
+	Labels []string `yaml:"labels"`
+}
+
+func (config *prometheusConfig) getSettings() *connection.PrometheusMapping {
+	return &connection.PrometheusMapping{
+		Tagged: config.Tagged,
+		Prefix: config.Prefix,
+		Labels: config.Labels,
+	}
+}
+
+type relayConfig struct {
+	// Addresses of downstream carbon plaintext listeners, e.g. ["carbon1:2003", "carbon2:2003"]. Leave empty to disable relay
+	Destinations []string `yaml:"destinations"`
+	// Forward only metrics matched any trigger pattern instead of every received line
+	OnlyMatched bool `yaml:"only_matched"`
+	// Max number of lines waiting for sending to each destination, new lines are dropped if destination queue is full
+	QueueSize int `yaml:"queue_size"`
+	// Delay between attempts to connect to unavailable destination
+	ReconnectInterval string `yaml:"reconnect_interval"`
+}
+
+func (config *relayConfig) getSettings() relay.Config {
+	return relay.Config{
+		Destinations:      config.Destinations,
+		OnlyMatched:       config.OnlyMatched,
+		QueueSize:         config.QueueSize,
+		ReconnectInterval: to.Duration(config.ReconnectInterval),
+	}
+}
+
+type spoolConfig struct {
+	// Directory of spooled metrics batches, leave empty to disable spool and lose metrics while Redis is unavailable
+	Dir string `yaml:"dir"`
+	// Max total size of spooled batches in megabytes, the oldest batches are dropped if it is exceeded
+	MaxSizeMB int `yaml:"max_size_mb"`
+}
+
+func (config *spoolConfig) isEnabled() bool {
+	return config.Dir != ""
+}
+
+type cachesConfig struct {
+	// Max number of metrics whose last values are cached to skip saving of unchanged values, 0 means no limit
+	MetricsCacheSize int `yaml:"metrics_cache_size"`
+	// Time since last update after which cached value of metric is removed, leave empty to keep values until size limit is reached
+	MetricsCacheTTL string `yaml:"metrics_cache_ttl"`
+	// Max number of metrics whose matched retentions are cached, 0 means no limit
+	RetentionsCacheSize int `yaml:"retentions_cache_size"`
+	// Time since last update after which cached retention of metric is removed, leave empty to keep retentions until size limit is reached
+	RetentionsCacheTTL string `yaml:"retentions_cache_ttl"`
+}
+
+func (config *cachesConfig) getSettings() filter.CacheLimits {
+	return filter.CacheLimits{
+		MetricsCacheSize:    config.MetricsCacheSize,
+		MetricsCacheTTL:     to.Duration(config.MetricsCacheTTL),
+		RetentionsCacheSize: config.RetentionsCacheSize,
+		RetentionsCacheTTL:  to.Duration(config.RetentionsCacheTTL),
+	}
+}
+
+type timestampWindowConfig struct {
+	// Max age of metric timestamp, e.g. 24h. Leave empty to accept metrics with any timestamp in the past
+	Past string `yaml:"past"`
+	// Max distance of metric timestamp in the future, e.g. 10m. Leave empty to accept metrics with any timestamp in the future
+	Future string `yaml:"future"`
+	// Action applied to metrics with timestamp outside of the window: drop, clamp (replace timestamp with current time) or count.
+	// All such metrics are counted in received.out_of_window metric.
+	// Policy can be overridden for metrics of certain retention with "timestamp_policy" line in retentions config
+	Policy string `yaml:"policy"`
+}
+
+func (config *timestampWindowConfig) getSettings() filter.TimestampWindow {
+	return filter.TimestampWindow{
+		Past:   to.Duration(config.Past),
+		Future: to.Duration(config.Future),
+		Policy: filter.TimestampPolicy(config.Policy),
+	}
+}
+
+type connectionsConfig struct {
+	// Max number of lines read from single connection per second, 0 means no limit
+	MaxLinesPerSecond int `yaml:"max_lines_per_second"`
+	// Action applied to lines exceeding limit: stall (stop reading from connection until next second) or drop
+	RateLimitPolicy string `yaml:"rate_limit_policy"`
+}
+
+func (config *connectionsConfig) getSettings() connection.ConnectionLimits {
+	return connection.ConnectionLimits{
+		MaxLinesPerSecond: config.MaxLinesPerSecond,
+		Policy:            connection.RateLimitPolicy(config.RateLimitPolicy),
+	}
+}
+
+type tlsConfig struct {
+	// TLS listener uri, leave empty to disable it
+	Listen string `yaml:"listen"`
+	// Paths of PEM encoded server certificate and its private key
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// Path of PEM encoded certificates of CAs issuing client certificates, leave empty to disable client certificates verification.
+	// Connections and lines of clients are counted in filter.tls.clients.<certificate common name> metrics
+	ClientCAFile string `yaml:"client_ca_file"`
+	// Reject clients without valid certificate issued by client CA
+	RequireClientCert bool `yaml:"require_client_cert"`
+}
+
+func (config *tlsConfig) getSettings() connection.TLSConfig {
+	return connection.TLSConfig{
+		Listen:            config.Listen,
+		CertFile:          config.CertFile,
+		KeyFile:           config.KeyFile,
+		ClientCAFile:      config.ClientCAFile,
+		RequireClientCert: config.RequireClientCert,
+	}
+}
+
+type influxConfig struct {
+	// Influx line protocol TCP listener uri, leave empty to disable it
+	ListenTCP string `yaml:"listen_tcp"`
+	// Influx line protocol UDP listener uri, leave empty to disable it
+	ListenUDP string `yaml:"listen_udp"`
+	// Influx HTTP API listener uri, leave empty to disable it. Lines should be sent to http://<filter host><listen_http>/write
+	ListenHTTP string `yaml:"listen_http"`
+	// Template of metric name made from measurement, tags and field, the same as graphite template of telegraf.
+	// Dot separated parts are "measurement", "field", "tags" (values of all other tags sorted by tag key) or tag key.
+	// Field named "value" is omitted from metric name.
+	Template string `yaml:"template"`
+}
+
+func (config *influxConfig) getSettings(maxUDPPacketSize int) connection.InfluxConfig {
+	return connection.InfluxConfig{
+		ListenTCP:        config.ListenTCP,
+		ListenUDP:        config.ListenUDP,
+		ListenHTTP:       config.ListenHTTP,
+		MaxUDPPacketSize: maxUDPPacketSize,
+		Template:         config.Template,
+	}
+}
+
+func (config *influxConfig) isEnabled() bool {
+	return config.ListenTCP != "" || config.ListenUDP != "" || config.ListenHTTP != ""
+}
+
 func getDefault() config {
 	return config{
 		Redis: cmd.RedisConfig{
@@ -39,9 +234,60 @@ func getDefault() config {
 			LogLevel: "info",
 		},
 		Filter: filterConfig{
-			Listen:             ":2003",
-			RetentionConfig:    "/etc/moira/storage-schemas.conf",
-			CacheCapacity:      10,
+			Listen: ":2003",
+			Connections: connectionsConfig{
+				MaxLinesPerSecond: 0,
+				RateLimitPolicy:   string(connection.RateLimitStall),
+			},
+			ListenUDP:        "",
+			MaxUDPPacketSize: 65507,
+			ListenPickle:     "",
+			ListenPrometheus: "",
+			Prometheus: prometheusConfig{
+				Tagged: false,
+				Prefix: "",
+				Labels: []string{},
+			},
+			Influx: influxConfig{
+				ListenTCP:  "",
+				ListenUDP:  "",
+				ListenHTTP: "",
+				Template:   connection.DefaultInfluxTemplate,
+			},
+			TLS: tlsConfig{
+				Listen:            "",
+				CertFile:          "",
+				KeyFile:           "",
+				ClientCAFile:      "",
+				RequireClientCert: false,
+			},
+			TimestampWindow: timestampWindowConfig{
+				Past:   "",
+				Future: "",
+				Policy: string(filter.TimestampDrop),
+			},
+			RetentionConfig:     "/etc/moira/storage-schemas.conf",
+			AggregationConfig:   "",
+			RulesConfig:         "",
+			CacheCapacity:       10,
+			PatternMetricsLimit: 0,
+			Caches: cachesConfig{
+				MetricsCacheSize:    1000000,
+				MetricsCacheTTL:     "1h",
+				RetentionsCacheSize: 1000000,
+				RetentionsCacheTTL:  "1h",
+			},
+			Relay: relayConfig{
+				Destinations:      []string{},
+				OnlyMatched:       false,
+				QueueSize:         100000,
+				ReconnectInterval: "5s",
+			},
+			Spool: spoolConfig{
+				Dir:       "",
+				MaxSizeMB: 1024,
+			},
+			DebugListen:        "",
 			MaxParallelMatches: 0,
 		},
 		Graphite: cmd.GraphiteConfig{
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"runtime"
@@ -13,9 +14,12 @@ import (
 	"github.com/moira-alert/moira/database/redis"
 	"github.com/moira-alert/moira/filter"
 	"github.com/moira-alert/moira/filter/connection"
+	"github.com/moira-alert/moira/filter/debug"
 	"github.com/moira-alert/moira/filter/heartbeat"
 	"github.com/moira-alert/moira/filter/matched_metrics"
 	"github.com/moira-alert/moira/filter/patterns"
+	"github.com/moira-alert/moira/filter/relay"
+	"github.com/moira-alert/moira/filter/spool"
 	"github.com/moira-alert/moira/logging/go-logging"
 	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
 )
@@ -83,18 +87,39 @@ func main() {
 	}
 
 	database := redis.NewDatabase(logger, config.Redis.GetSettings(), redis.Filter)
+	database.SetPatternMetricsLimit(config.Filter.PatternMetricsLimit)
 
 	retentionConfigFile, err := os.Open(config.Filter.RetentionConfig)
 	if err != nil {
 		logger.Fatalf("Error open retentions file [%s]: %s", config.Filter.RetentionConfig, err.Error())
 	}
 
-	cacheStorage, err := filter.NewCacheStorage(logger, cacheMetrics, retentionConfigFile)
+	var aggregationConfigFile io.Reader
+	if config.Filter.AggregationConfig != "" {
+		aggregationConfigFile, err = os.Open(config.Filter.AggregationConfig)
+		if err != nil {
+			logger.Fatalf("Error open aggregations file [%s]: %s", config.Filter.AggregationConfig, err.Error())
+		}
+	}
+
+	cacheStorage, err := filter.NewCacheStorage(logger, cacheMetrics, retentionConfigFile, aggregationConfigFile, config.Filter.TimestampWindow.getSettings(), config.Filter.Caches.getSettings())
 	if err != nil {
-		logger.Fatalf("Failed to initialize cache storage with config [%s]: %s", config.Filter.RetentionConfig, err.Error())
+		logger.Fatalf("Failed to initialize cache storage with configs [%s], [%s]: %s", config.Filter.RetentionConfig, config.Filter.AggregationConfig, err.Error())
+	}
+
+	var rules *filter.Rules
+	if config.Filter.RulesConfig != "" {
+		rulesConfigFile, err := os.Open(config.Filter.RulesConfig)
+		if err != nil {
+			logger.Fatalf("Error open rules file [%s]: %s", config.Filter.RulesConfig, err.Error())
+		}
+		rules, err = filter.NewRules(logger, cacheMetrics, rulesConfigFile)
+		if err != nil {
+			logger.Fatalf("Failed to initialize rules with config [%s]: %s", config.Filter.RulesConfig, err.Error())
+		}
 	}
 
-	patternStorage, err := filter.NewPatternStorage(database, cacheMetrics, logger)
+	patternStorage, err := filter.NewPatternStorage(database, cacheMetrics, logger, rules)
 	if err != nil {
 		logger.Fatalf("Failed to refresh pattern storage: %s", err.Error())
 	}
@@ -114,22 +139,117 @@ func main() {
 	heartbeatWorker.Start()
 	defer stopHeartbeatWorker(heartbeatWorker)
 
+	// Stats of plaintext connections are kept only if they can be queried from debug server
+	var connectionsStats *connection.ConnectionsStats
+	if config.Filter.DebugListen != "" {
+		connectionsStats = connection.NewConnectionsStats()
+	}
+
 	// Start metrics listener
-	listener, err := connection.NewListener(config.Filter.Listen, logger, cacheMetrics)
+	listener, err := connection.NewListener(config.Filter.Listen, config.Filter.Connections.getSettings(), connectionsStats, logger, cacheMetrics)
 	if err != nil {
 		logger.Fatalf("Failed to start listen: %s", err.Error())
 	}
 	lineChan := listener.Listen()
 
-	patternMatcher := patterns.NewMatcher(logger, cacheMetrics, patternStorage)
+	// Start UDP metrics listener, it shares lineChan with TCP listener
+	var udpListener *connection.UDPMetricsListener
+	if config.Filter.ListenUDP != "" {
+		udpListener, err = connection.NewUDPListener(config.Filter.ListenUDP, config.Filter.MaxUDPPacketSize, logger, cacheMetrics)
+		if err != nil {
+			logger.Fatalf("Failed to start listen udp: %s", err.Error())
+		}
+		udpListener.Listen(lineChan)
+	}
+
+	// Start pickle metrics listener, it shares lineChan with TCP listener
+	var pickleListener *connection.PickleMetricsListener
+	if config.Filter.ListenPickle != "" {
+		pickleListener, err = connection.NewPickleListener(config.Filter.ListenPickle, logger, cacheMetrics)
+		if err != nil {
+			logger.Fatalf("Failed to start listen pickle: %s", err.Error())
+		}
+		pickleListener.Listen(lineChan)
+	}
+
+	// Start prometheus remote-write listener, it shares lineChan with TCP listener
+	var prometheusListener *connection.PrometheusMetricsListener
+	if config.Filter.ListenPrometheus != "" {
+		prometheusListener, err = connection.NewPrometheusListener(config.Filter.ListenPrometheus, config.Filter.Prometheus.getSettings(), logger, cacheMetrics)
+		if err != nil {
+			logger.Fatalf("Failed to start listen prometheus: %s", err.Error())
+		}
+		prometheusListener.Listen(lineChan)
+	}
+
+	// Start influx line protocol listener, it shares lineChan with TCP listener
+	var influxListener *connection.InfluxMetricsListener
+	if config.Filter.Influx.isEnabled() {
+		influxListener, err = connection.NewInfluxListener(config.Filter.Influx.getSettings(config.Filter.MaxUDPPacketSize), logger, cacheMetrics)
+		if err != nil {
+			logger.Fatalf("Failed to start listen influx: %s", err.Error())
+		}
+		influxListener.Listen(lineChan)
+	}
+
+	// Start TLS metrics listener, it shares lineChan with TCP listener
+	var tlsListener *connection.TLSMetricsListener
+	if config.Filter.TLS.Listen != "" {
+		tlsListener, err = connection.NewTLSListener(config.Filter.TLS.getSettings(), config.Filter.Connections.getSettings(), connectionsStats, logger, cacheMetrics)
+		if err != nil {
+			logger.Fatalf("Failed to start listen tls: %s", err.Error())
+		}
+		tlsListener.Listen(lineChan)
+	}
+
+	// Start relay of received metrics to downstream carbon
+	var metricsRelay *relay.Relay
+	if len(config.Filter.Relay.Destinations) > 0 {
+		metricsRelay, err = relay.NewRelay(config.Filter.Relay.getSettings(), logger, cacheMetrics)
+		if err != nil {
+			logger.Fatalf("Failed to start relay: %s", err.Error())
+		}
+		metricsRelay.Start()
+		defer stopRelay(metricsRelay) // Relay is stopped after metrics matcher, so all received lines are forwarded
+	}
+
+	patternMatcher := patterns.NewMatcher(logger, cacheMetrics, patternStorage, metricsRelay)
 	metricsChan := patternMatcher.Start(config.Filter.MaxParallelMatches, lineChan)
 
+	// Open spool of metrics failed to save
+	var metricsSpool *spool.Spool
+	if config.Filter.Spool.isEnabled() {
+		metricsSpool, err = spool.NewSpool(config.Filter.Spool.Dir, int64(config.Filter.Spool.MaxSizeMB)*1024*1024, logger, cacheMetrics)
+		if err != nil {
+			logger.Fatalf("Failed to open metrics spool: %s", err.Error())
+		}
+	}
+
 	// Start metrics matcher
 	cacheCapacity := config.Filter.CacheCapacity
-	metricsMatcher := matchedmetrics.NewMetricsMatcher(cacheMetrics, logger, database, cacheStorage, cacheCapacity)
+	metricsMatcher := matchedmetrics.NewMetricsMatcher(cacheMetrics, logger, database, cacheStorage, cacheCapacity, metricsSpool)
 	metricsMatcher.Start(metricsChan)
-	defer metricsMatcher.Wait()  // First stop listener
+	defer metricsMatcher.Wait()  // First stop listeners
 	defer stopListener(listener) // Then waiting for metrics matcher handle all received events
+	// UDP, pickle, prometheus, influx and tls listeners write to lineChan of TCP listener,
+	// so they must be stopped before it closes the channel
+	defer stopUDPListener(udpListener)
+	defer stopPickleListener(pickleListener)
+	defer stopPrometheusListener(prometheusListener)
+	defer stopInfluxListener(influxListener)
+	defer stopTLSListener(tlsListener)
+
+	// Start debug server
+	if config.Filter.DebugListen != "" {
+		debugServer, err := debug.NewServer(config.Filter.DebugListen, logger)
+		if err != nil {
+			logger.Fatalf("Failed to start debug server: %s", err.Error())
+		}
+		debugServer.Handle(debug.ConnectionsPath, connectionsStats)
+		debugServer.Handle(debug.MatchPath, filter.NewMatchDebugger(database, patternStorage, cacheStorage))
+		debugServer.Start()
+		defer stopDebugServer(debugServer)
+	}
 
 	logger.Infof("Moira Filter started. Version: %s", MoiraVersion)
 	ch := make(chan os.Signal, 1)
@@ -144,6 +264,63 @@ func stopListener(listener *connection.MetricsListener) {
 	}
 }
 
+func stopUDPListener(listener *connection.UDPMetricsListener) {
+	if listener == nil {
+		return
+	}
+	if err := listener.Stop(); err != nil {
+		logger.Errorf("Failed to stop udp listener: %v", err)
+	}
+}
+
+func stopPickleListener(listener *connection.PickleMetricsListener) {
+	if listener == nil {
+		return
+	}
+	if err := listener.Stop(); err != nil {
+		logger.Errorf("Failed to stop pickle listener: %v", err)
+	}
+}
+
+func stopPrometheusListener(listener *connection.PrometheusMetricsListener) {
+	if listener == nil {
+		return
+	}
+	if err := listener.Stop(); err != nil {
+		logger.Errorf("Failed to stop prometheus listener: %v", err)
+	}
+}
+
+func stopInfluxListener(listener *connection.InfluxMetricsListener) {
+	if listener == nil {
+		return
+	}
+	if err := listener.Stop(); err != nil {
+		logger.Errorf("Failed to stop influx listener: %v", err)
+	}
+}
+
+func stopTLSListener(listener *connection.TLSMetricsListener) {
+	if listener == nil {
+		return
+	}
+	if err := listener.Stop(); err != nil {
+		logger.Errorf("Failed to stop tls listener: %v", err)
+	}
+}
+
+func stopDebugServer(server *debug.Server) {
+	if err := server.Stop(); err != nil {
+		logger.Errorf("Failed to stop debug server: %v", err)
+	}
+}
+
+func stopRelay(relay *relay.Relay) {
+	if err := relay.Stop(); err != nil {
+		logger.Errorf("Failed to stop relay: %v", err)
+	}
+}
+
 func stopHeartbeatWorker(heartbeatWorker *heartbeat.Worker) {
 	if err := heartbeatWorker.Stop(); err != nil {
 		logger.Errorf("Failed to stop heartbeat worker: %v", err)
@@ -4,3 +4,6 @@ import "fmt"
 
 // ErrNil return from database data storing methods if no object in DB
 var ErrNil = fmt.Errorf("Nil returned")
+
+// ErrPatternChangesLost return from GetPatternChanges if requested changes are no longer stored in DB
+var ErrPatternChangesLost = fmt.Errorf("Pattern changes lost")
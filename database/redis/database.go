@@ -49,6 +49,7 @@ type DbConnector struct {
 	messengersCache      *cache.Cache
 	sync                 *redsync.Redsync
 	source               DBSource
+	patternMetricsLimit  int64
 }
 
 // NewDatabase creates Redis pool based on config
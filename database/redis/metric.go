@@ -3,6 +3,7 @@ package redis
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/garyburd/redigo/redis"
 	"gopkg.in/tomb.v2"
@@ -10,6 +11,7 @@ import (
 	"github.com/moira-alert/moira"
 	"github.com/moira-alert/moira/database"
 	"github.com/moira-alert/moira/database/redis/reply"
+	"github.com/moira-alert/moira/tags"
 	"github.com/patrickmn/go-cache"
 )
 
@@ -90,20 +92,64 @@ func (connector *DbConnector) getMetricRetention(metric string) (int64, error) {
 	return retention, nil
 }
 
-// SaveMetrics saves new metrics
+// SaveMetrics saves new metrics, values of metrics rejected by all their patterns which reached limit of metrics are not saved
 func (connector *DbConnector) SaveMetrics(metrics map[string]*moira.MatchedMetric) error {
 	c := connector.pool.Get()
 	defer c.Close()
+	// Limited patterns are added synchronously to know which of them accepted metrics,
+	// unlimited ones accept every metric, so they are added in pipeline with values
+	limited := connector.patternMetricsLimit > 0
+	var acceptedPatterns map[string][]string
+	if limited {
+		var err error
+		if acceptedPatterns, err = connector.addLimitedPatternsMetrics(c, metrics); err != nil {
+			return err
+		}
+	}
+	getPatterns := func(metric *moira.MatchedMetric) ([]string, bool) {
+		if !limited {
+			return metric.Patterns, false
+		}
+		patterns := acceptedPatterns[metric.Metric]
+		return patterns, len(metric.Patterns) > 0 && len(patterns) == 0
+	}
+	// Aggregates are sent first, so replies of merging them are the first ones
+	aggregatedCount := 0
+	for _, metric := range metrics {
+		if _, rejected := getPatterns(metric); metric.Aggregate == nil || rejected {
+			continue
+		}
+		if aggregatedCount == 0 {
+			if err := metricAggregateSaveScript.Load(c); err != nil {
+				return fmt.Errorf("failed to load metric aggregate script, error: %v", err)
+			}
+		}
+		sendMetricAggregate(c, metric)
+		aggregatedCount++
+	}
 	for _, metric := range metrics {
-		metricValue := fmt.Sprintf("%v %v", metric.Timestamp, metric.Value)
-		c.Send("ZADD", metricDataKey(metric.Metric), metric.RetentionTimestamp, metricValue)
+		patterns, rejected := getPatterns(metric)
+		if rejected {
+			continue
+		}
+		if metric.Aggregate == nil {
+			metricValue := fmt.Sprintf("%v %v", metric.Timestamp, metric.Value)
+			c.Send("ZADD", metricDataKey(metric.Metric), metric.RetentionTimestamp, metricValue)
+		}
 
 		if err := connector.retentionSavingCache.Add(metric.Metric, true, cache.DefaultExpiration); err == nil {
 			c.Send("SET", metricRetentionKey(metric.Metric), metric.Retention)
 		}
 
-		for _, pattern := range metric.Patterns {
-			c.Send("SADD", patternMetricsKey(pattern), metric.Metric)
+		for tagName, tagValue := range getSeriesTags(metric.Metric) {
+			c.Send("SADD", seriesTagKey(tagName, tagValue), metric.Metric)
+		}
+
+		// events are published after values are saved, so checker gets new values
+		for _, pattern := range patterns {
+			if !limited {
+				c.Send("SADD", patternMetricsKey(pattern), metric.Metric)
+			}
 			event, err := json.Marshal(&moira.MetricEvent{
 				Metric:  metric.Metric,
 				Pattern: pattern,
@@ -114,7 +160,83 @@ func (connector *DbConnector) SaveMetrics(metrics map[string]*moira.MatchedMetri
 			c.Send("PUBLISH", metricEventKey, event)
 		}
 	}
-	return c.Flush()
+	if aggregatedCount == 0 {
+		return c.Flush()
+	}
+	replies, err := redis.Values(c.Do(""))
+	if err != nil {
+		return fmt.Errorf("failed to save metrics, error: %v", err)
+	}
+	droppedCount := 0
+	for _, aggregateReply := range replies[:aggregatedCount] {
+		if saved, err := redis.Int64(aggregateReply, nil); err == nil && saved == 0 {
+			droppedCount++
+		}
+	}
+	if droppedCount > 0 {
+		connector.logger.Warningf("Dropped %d aggregates of metrics retention slots, which were saved and which aggregates expired", droppedCount)
+	}
+	return nil
+}
+
+// addLimitedPatternsMetrics adds metrics to metrics of their limited patterns and returns patterns which accepted every metric,
+// pattern which reached limit of metrics does not accept new ones
+func (connector *DbConnector) addLimitedPatternsMetrics(c redis.Conn, metrics map[string]*moira.MatchedMetric) (map[string][]string, error) {
+	acceptedPatterns := make(map[string][]string, len(metrics))
+	if err := connector.loadPatternMetricAddScript(c); err != nil {
+		return nil, err
+	}
+	sentMetrics := make([]*moira.MatchedMetric, 0, len(metrics))
+	sentPatterns := 0
+	for _, metric := range metrics {
+		for _, pattern := range metric.Patterns {
+			connector.sendPatternMetric(c, pattern, metric.Metric, nil)
+			sentPatterns++
+		}
+		sentMetrics = append(sentMetrics, metric)
+	}
+	if sentPatterns == 0 {
+		return acceptedPatterns, nil
+	}
+	replies, err := redis.Values(c.Do(""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to add patterns metrics, error: %v", err)
+	}
+	replyIndex := 0
+	for _, metric := range sentMetrics {
+		for _, pattern := range metric.Patterns {
+			added, err := redis.Int64(replies[replyIndex], nil)
+			replyIndex++
+			// limit script returns 1 for added metric and for metric which pattern already has, 0 for rejected one
+			if err == nil && added == 1 {
+				acceptedPatterns[metric.Metric] = append(acceptedPatterns[metric.Metric], pattern)
+			}
+		}
+	}
+	return acceptedPatterns, nil
+}
+
+// GetTaggedMetrics gets all tagged series having all given tags with given values,
+// pseudo tag "name" contains series name
+func (connector *DbConnector) GetTaggedMetrics(tags map[string]string) ([]string, error) {
+	if len(tags) == 0 {
+		return make([]string, 0), nil
+	}
+	c := connector.pool.Get()
+	defer c.Close()
+
+	keys := make([]interface{}, 0, len(tags))
+	for tagName, tagValue := range tags {
+		keys = append(keys, seriesTagKey(tagName, tagValue))
+	}
+	metrics, err := redis.Strings(c.Do("SINTER", keys...))
+	if err != nil {
+		if err == redis.ErrNil {
+			return make([]string, 0), nil
+		}
+		return nil, fmt.Errorf("failed to get tagged metrics for tags %v, error: %v", tags, err)
+	}
+	return metrics, nil
 }
 
 // SubscribeMetricEvents creates subscription for new metrics and return channel for this events
@@ -145,11 +267,15 @@ func (connector *DbConnector) SubscribeMetricEvents(tomb *tomb.Tomb) (<-chan *mo
 	return metricsChannel, nil
 }
 
-// AddPatternMetric adds new metrics by given pattern
+// AddPatternMetric adds new metrics by given pattern, metric is not added if pattern reached limit of metrics
 func (connector *DbConnector) AddPatternMetric(pattern, metric string) error {
 	c := connector.pool.Get()
 	defer c.Close()
-	if _, err := c.Do("SADD", patternMetricsKey(pattern), metric); err != nil {
+	if err := connector.loadPatternMetricAddScript(c); err != nil {
+		return err
+	}
+	connector.sendPatternMetric(c, pattern, metric, nil)
+	if _, err := c.Do(""); err != nil {
 		return fmt.Errorf("failed to SADD pattern-metrics, pattern: %s, metric: %s, error: %v", pattern, metric, err)
 	}
 	return nil
@@ -174,19 +300,40 @@ func (connector *DbConnector) GetPatternMetrics(pattern string) ([]string, error
 func (connector *DbConnector) RemovePattern(pattern string) error {
 	c := connector.pool.Get()
 	defer c.Close()
-	if _, err := c.Do("SREM", patternsListKey, pattern); err != nil {
+	if _, err := patternChangeScript.Do(c, patternsListKey, patternsVersionKey, patternChangesKey, patternRemoved, pattern, maxPatternChanges); err != nil {
 		return fmt.Errorf("failed to remove pattern: %s, error: %v", pattern, err)
 	}
 	return nil
 }
 
-// RemovePatternsMetrics removes metrics by given patterns
+// RemovePatternsMetrics removes metrics by given patterns, removed tagged series are also removed from index of series tags.
+// Series which still come are indexed again when they are saved
 func (connector *DbConnector) RemovePatternsMetrics(patterns []string) error {
+	if len(patterns) == 0 {
+		return nil
+	}
 	c := connector.pool.Get()
 	defer c.Close()
-	c.Send("MULTI")
 	for _, pattern := range patterns {
+		c.Send("SMEMBERS", patternMetricsKey(pattern))
+	}
+	patternsMetrics, err := redis.Values(c.Do(""))
+	if err != nil {
+		return fmt.Errorf("failed to get patterns metrics, error: %v", err)
+	}
+	c.Send("MULTI")
+	for i, pattern := range patterns {
+		metrics, err := redis.Strings(patternsMetrics[i], nil)
+		if err != nil {
+			return fmt.Errorf("failed to get pattern metrics for pattern %s, error: %v", pattern, err)
+		}
+		for _, metric := range metrics {
+			for tagName, tagValue := range getSeriesTags(metric) {
+				c.Send("SREM", seriesTagKey(tagName, tagValue), metric)
+			}
+		}
 		c.Send("DEL", patternMetricsKey(pattern))
+		c.Send("HDEL", limitedPatternsKey, pattern)
 	}
 	if _, err := c.Do("EXEC"); err != nil {
 		return fmt.Errorf("failed to EXEC: %v", err)
@@ -203,40 +350,53 @@ func (connector *DbConnector) RemovePatternWithMetrics(pattern string) error {
 	c := connector.pool.Get()
 	defer c.Close()
 	c.Send("MULTI")
-	c.Send("SREM", patternsListKey, pattern)
+	sendPatternChange(c, patternRemoved, pattern)
 	for _, metric := range metrics {
 		c.Send("DEL", metricDataKey(metric))
 		c.Send("DEL", metricRetentionKey(metric))
+		for tagName, tagValue := range getSeriesTags(metric) {
+			c.Send("SREM", seriesTagKey(tagName, tagValue), metric)
+		}
 	}
 	c.Send("DEL", patternMetricsKey(pattern))
+	c.Send("HDEL", limitedPatternsKey, pattern)
 	if _, err = c.Do("EXEC"); err != nil {
 		return fmt.Errorf("failed to EXEC: %v", err)
 	}
 	return nil
 }
 
-// RemoveMetricValues remove metric timestamps values from 0 to given time
+// RemoveMetricValues remove metric timestamps values from 0 to given time,
+// tagged series having no values left are removed from index of series tags
 func (connector *DbConnector) RemoveMetricValues(metric string, toTime int64) error {
 	if !connector.needRemoveMetrics(metric) {
 		return nil
 	}
 	c := connector.pool.Get()
 	defer c.Close()
-	if _, err := c.Do("ZREMRANGEBYSCORE", metricDataKey(metric), "-inf", toTime); err != nil {
+	if err := metricValuesRemoveScript.Load(c); err != nil {
+		return fmt.Errorf("failed to load metric values remove script, error: %v", err)
+	}
+	sendMetricValuesRemove(c, metric, toTime)
+	if _, err := c.Do(""); err != nil {
 		return fmt.Errorf("Failed to remove metrics from -inf to %v, error: %v", toTime, err)
 	}
 	return nil
 }
 
-// RemoveMetricsValues remove metrics timestamps values from 0 to given time
+// RemoveMetricsValues remove metrics timestamps values from 0 to given time,
+// tagged series having no values left are removed from index of series tags
 func (connector *DbConnector) RemoveMetricsValues(metrics []string, toTime int64) error {
 	c := connector.pool.Get()
 	defer c.Close()
+	if err := metricValuesRemoveScript.Load(c); err != nil {
+		return fmt.Errorf("failed to load metric values remove script, error: %v", err)
+	}
 
 	c.Send("MULTI")
 	for _, metric := range metrics {
 		if connector.needRemoveMetrics(metric) {
-			c.Send("ZREMRANGEBYSCORE", metricDataKey(metric), "-inf", toTime)
+			sendMetricValuesRemove(c, metric, toTime)
 		}
 	}
 	if _, err := c.Do("EXEC"); err != nil {
@@ -250,6 +410,49 @@ func (connector *DbConnector) needRemoveMetrics(metric string) bool {
 	return err == nil
 }
 
+// metricValuesRemoveScript removes metric values older than given time and removes series from index of series tags
+// if it has no values left. KEYS: metric data, series tags. ARGV: time, metric
+var metricValuesRemoveScript = redis.NewScript(-1, `
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	for i = 2, #KEYS do
+		redis.call('SREM', KEYS[i], ARGV[2])
+	end
+end
+return 1
+`)
+
+// sendMetricValuesRemove queues removal of metric values older than given time,
+// script removing values should be loaded before
+func sendMetricValuesRemove(c redis.Conn, metric string, toTime int64) {
+	seriesTags := getSeriesTags(metric)
+	if len(seriesTags) == 0 {
+		c.Send("ZREMRANGEBYSCORE", metricDataKey(metric), "-inf", toTime)
+		return
+	}
+	keysAndArgs := make([]interface{}, 0, len(seriesTags)+4)
+	keysAndArgs = append(keysAndArgs, len(seriesTags)+1, metricDataKey(metric))
+	for tagName, tagValue := range seriesTags {
+		keysAndArgs = append(keysAndArgs, seriesTagKey(tagName, tagValue))
+	}
+	keysAndArgs = append(keysAndArgs, toTime, metric)
+	metricValuesRemoveScript.SendHash(c, keysAndArgs...)
+}
+
+// getSeriesTags returns tags of graphite tagged series "name;tag1=value1;tag2=value2"
+// including pseudo tag "name", plain metrics and malformed tagged series have no tags
+func getSeriesTags(metric string) map[string]string {
+	if !strings.Contains(metric, ";") {
+		return nil
+	}
+	name, seriesTags, err := tags.ParseTaggedMetric(metric)
+	if err != nil {
+		return nil
+	}
+	seriesTags["name"] = name
+	return seriesTags
+}
+
 var patternsListKey = "moira-pattern-list"
 var metricEventKey = "metric-event"
 
@@ -264,3 +467,7 @@ func metricDataKey(metric string) string {
 func metricRetentionKey(metric string) string {
 	return fmt.Sprintf("moira-metric-retention:%s", metric)
 }
+
+func seriesTagKey(tagName, tagValue string) string {
+	return fmt.Sprintf("moira-series-tag:%s=%s", tagName, tagValue)
+}
@@ -0,0 +1,60 @@
+package redis
+
+import (
+	"fmt"
+
+	"github.com/garyburd/redigo/redis"
+
+	"github.com/moira-alert/moira"
+)
+
+// metricAggregateSlots is a number of retention slots which aggregate of slot is kept for since its last point,
+// later points of the slot are dropped
+const metricAggregateSlots = 3
+
+// metricAggregateSaveScript merges aggregate of points of retention slot with saved aggregate of the slot
+// and replaces value of the slot with value of merged aggregate. If slot has value, but its aggregate has already expired,
+// points are dropped, so partial aggregate never replaces complete one, and 0 is returned.
+// KEYS: metric data, slot aggregate. ARGV: retention timestamp, timestamp, aggregation method, sum, min, max, count, aggregate ttl
+var metricAggregateSaveScript = redis.NewScript(2, `
+local slot = ARGV[1]
+local sum, min, max, count = tonumber(ARGV[4]), tonumber(ARGV[5]), tonumber(ARGV[6]), tonumber(ARGV[7])
+local saved = redis.call('HMGET', KEYS[2], 'sum', 'min', 'max', 'count')
+if saved[4] then
+	sum = sum + tonumber(saved[1])
+	min = math.min(min, tonumber(saved[2]))
+	max = math.max(max, tonumber(saved[3]))
+	count = count + tonumber(saved[4])
+elseif redis.call('ZCOUNT', KEYS[1], slot, slot) > 0 then
+	return 0
+end
+local value = count
+if ARGV[3] == 'average' then
+	value = sum / count
+elseif ARGV[3] == 'sum' then
+	value = sum
+elseif ARGV[3] == 'min' then
+	value = min
+elseif ARGV[3] == 'max' then
+	value = max
+end
+redis.call('HMSET', KEYS[2], 'sum', string.format('%.17g', sum), 'min', string.format('%.17g', min),
+	'max', string.format('%.17g', max), 'count', string.format('%d', count))
+redis.call('EXPIRE', KEYS[2], ARGV[8])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], slot, slot)
+redis.call('ZADD', KEYS[1], slot, ARGV[2] .. ' ' .. string.format('%.17g', value))
+return 1
+`)
+
+// sendMetricAggregate queues merging of metric aggregate with saved aggregate of its retention slot,
+// script merging aggregates should be loaded before
+func sendMetricAggregate(c redis.Conn, metric *moira.MatchedMetric) {
+	aggregate := metric.Aggregate
+	metricAggregateSaveScript.SendHash(c, metricDataKey(metric.Metric), metricAggregateKey(metric.Metric, metric.RetentionTimestamp),
+		metric.RetentionTimestamp, metric.Timestamp, aggregate.Method, aggregate.Sum, aggregate.Min, aggregate.Max, aggregate.Count,
+		int64(metric.Retention)*metricAggregateSlots)
+}
+
+func metricAggregateKey(metric string, retentionTimestamp int64) string {
+	return fmt.Sprintf("moira-metric-aggregate:%s:%d", metric, retentionTimestamp)
+}
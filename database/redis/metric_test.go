@@ -181,6 +181,114 @@ func TestMetricsStoring(t *testing.T) {
 		So(err, ShouldBeNil)
 		So(actualRet, ShouldEqual, 10)
 	})
+
+	Convey("Aggregate is merged with saved aggregate of its retention slot and replaces value of the slot", t, func() {
+		metric := "my.aggregated.metric"
+		err := dataBase.SaveMetrics(map[string]*moira.MatchedMetric{
+			metric: {Metric: metric, Retention: 60, RetentionTimestamp: 60, Timestamp: 61, Value: 1,
+				Aggregate: &moira.MetricAggregate{Method: "average", Sum: 3, Min: 1, Max: 2, Count: 2}},
+		})
+		So(err, ShouldBeNil)
+		err = dataBase.SaveMetrics(map[string]*moira.MatchedMetric{
+			metric: {Metric: metric, Retention: 60, RetentionTimestamp: 60, Timestamp: 62, Value: 6,
+				Aggregate: &moira.MetricAggregate{Method: "average", Sum: 6, Min: 6, Max: 6, Count: 1}},
+		})
+		So(err, ShouldBeNil)
+
+		actualValues, err := dataBase.GetMetricsValues([]string{metric}, 0, 120)
+		So(err, ShouldBeNil)
+		So(actualValues, ShouldResemble, map[string][]*moira.MetricValue{metric: {&moira.MetricValue{Timestamp: 62, RetentionTimestamp: 60, Value: 3}}})
+
+		Convey("Aggregate of saved slot is dropped if saved aggregate of the slot expired", func() {
+			c := dataBase.pool.Get()
+			c.Do("DEL", metricAggregateKey(metric, 60))
+			c.Close()
+			err = dataBase.SaveMetrics(map[string]*moira.MatchedMetric{
+				metric: {Metric: metric, Retention: 60, RetentionTimestamp: 60, Timestamp: 63, Value: 100,
+					Aggregate: &moira.MetricAggregate{Method: "average", Sum: 100, Min: 100, Max: 100, Count: 1}},
+			})
+			So(err, ShouldBeNil)
+			actualValues, err = dataBase.GetMetricsValues([]string{metric}, 0, 120)
+			So(err, ShouldBeNil)
+			So(actualValues[metric][0].Value, ShouldEqual, 3)
+		})
+	})
+
+	Convey("Tagged metrics are indexed by tags", t, func() {
+		taggedPattern := "seriesByTag('name=cpu.load')"
+		taggedMetric1 := "cpu.load;dc=x;host=a"
+		taggedMetric2 := "cpu.load;dc=y;host=a"
+		err := dataBase.SaveMetrics(map[string]*moira.MatchedMetric{
+			taggedMetric1: {Patterns: []string{taggedPattern}, Metric: taggedMetric1, Retention: 60, RetentionTimestamp: 60, Timestamp: 61, Value: 1},
+			taggedMetric2: {Patterns: []string{taggedPattern}, Metric: taggedMetric2, Retention: 60, RetentionTimestamp: 60, Timestamp: 61, Value: 2},
+		})
+		So(err, ShouldBeNil)
+
+		actual, err := dataBase.GetTaggedMetrics(map[string]string{"name": "cpu.load", "host": "a"})
+		So(err, ShouldBeNil)
+		So(actual, ShouldHaveLength, 2)
+
+		actual, err = dataBase.GetTaggedMetrics(map[string]string{"name": "cpu.load", "dc": "x"})
+		So(err, ShouldBeNil)
+		So(actual, ShouldResemble, []string{taggedMetric1})
+
+		actual, err = dataBase.GetTaggedMetrics(map[string]string{"dc": "z"})
+		So(err, ShouldBeNil)
+		So(actual, ShouldBeEmpty)
+
+		actual, err = dataBase.GetTaggedMetrics(map[string]string{})
+		So(err, ShouldBeNil)
+		So(actual, ShouldBeEmpty)
+
+		err = dataBase.RemovePatternWithMetrics(taggedPattern)
+		So(err, ShouldBeNil)
+
+		actual, err = dataBase.GetTaggedMetrics(map[string]string{"name": "cpu.load"})
+		So(err, ShouldBeNil)
+		So(actual, ShouldBeEmpty)
+
+		Convey("Series are removed from index with patterns metrics", func() {
+			err := dataBase.SaveMetrics(map[string]*moira.MatchedMetric{
+				taggedMetric1: {Patterns: []string{taggedPattern}, Metric: taggedMetric1, Retention: 60, RetentionTimestamp: 60, Timestamp: 61, Value: 1},
+			})
+			So(err, ShouldBeNil)
+
+			err = dataBase.RemovePatternsMetrics([]string{taggedPattern})
+			So(err, ShouldBeNil)
+
+			actual, err := dataBase.GetTaggedMetrics(map[string]string{"name": "cpu.load"})
+			So(err, ShouldBeNil)
+			So(actual, ShouldBeEmpty)
+
+			err = dataBase.RemovePatternWithMetrics(taggedPattern)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Series are removed from index when all their values are removed", func() {
+			err := dataBase.SaveMetrics(map[string]*moira.MatchedMetric{
+				taggedMetric1: {Patterns: []string{taggedPattern}, Metric: taggedMetric1, Retention: 60, RetentionTimestamp: 60, Timestamp: 61, Value: 1},
+				taggedMetric2: {Patterns: []string{taggedPattern}, Metric: taggedMetric2, Retention: 60, RetentionTimestamp: 120, Timestamp: 121, Value: 2},
+			})
+			So(err, ShouldBeNil)
+
+			err = dataBase.RemoveMetricValues(taggedMetric1, 60)
+			So(err, ShouldBeNil)
+
+			actual, err := dataBase.GetTaggedMetrics(map[string]string{"name": "cpu.load"})
+			So(err, ShouldBeNil)
+			So(actual, ShouldResemble, []string{taggedMetric2})
+
+			err = dataBase.RemoveMetricsValues([]string{taggedMetric2}, 120)
+			So(err, ShouldBeNil)
+
+			actual, err = dataBase.GetTaggedMetrics(map[string]string{"name": "cpu.load"})
+			So(err, ShouldBeNil)
+			So(actual, ShouldBeEmpty)
+
+			err = dataBase.RemovePatternWithMetrics(taggedPattern)
+			So(err, ShouldBeNil)
+		})
+	})
 }
 
 func TestRemoveMetricValues(t *testing.T) {
@@ -428,6 +536,10 @@ func TestMetricsStoringErrorConnection(t *testing.T) {
 		So(actual, ShouldBeEmpty)
 		So(err, ShouldNotBeNil)
 
+		actual, err = dataBase.GetTaggedMetrics(map[string]string{"name": "123"})
+		So(actual, ShouldBeEmpty)
+		So(err, ShouldNotBeNil)
+
 		err = dataBase.RemovePattern("123")
 		So(err, ShouldNotBeNil)
 
@@ -446,3 +558,19 @@ func TestMetricsStoringErrorConnection(t *testing.T) {
 		So(ch, ShouldBeNil)
 	})
 }
+
+func TestGetSeriesTags(t *testing.T) {
+	Convey("Tagged series should have its tags and name pseudo tag", t, func() {
+		So(getSeriesTags("cpu.load;host=a;dc=b=c"), ShouldResemble, map[string]string{"name": "cpu.load", "host": "a", "dc": "b=c"})
+	})
+
+	Convey("Plain metrics should have no tags", t, func() {
+		So(getSeriesTags("cpu.load"), ShouldBeEmpty)
+	})
+
+	Convey("Malformed tagged series should have no tags", t, func() {
+		for _, metric := range []string{";host=a", "cpu.load;host", "cpu.load;host=", "cpu.load;=a", "cpu.load;ho!st=a"} {
+			So(getSeriesTags(metric), ShouldBeEmpty)
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/database"
+)
+
+// maxPatternChanges is a number of latest pattern changes kept in change log,
+// filter which missed more changes rebuilds the whole pattern tree
+const maxPatternChanges = 10000
+
+const (
+	patternAdded   = "+"
+	patternRemoved = "-"
+)
+
+// patternChangeScript adds pattern to or removes it from patterns list and, if list was changed,
+// increments patterns version and logs the change with new version as score.
+// KEYS: patterns list, patterns version, pattern changes. ARGV: change type, pattern, change log length
+var patternChangeScript = redis.NewScript(3, `
+local changed
+if ARGV[1] == '+' then
+	changed = redis.call('SADD', KEYS[1], ARGV[2])
+else
+	changed = redis.call('SREM', KEYS[1], ARGV[2])
+end
+if changed == 1 then
+	local version = redis.call('INCR', KEYS[2])
+	redis.call('ZADD', KEYS[3], version, version .. ARGV[1] .. ARGV[2])
+	redis.call('ZREMRANGEBYSCORE', KEYS[3], '-inf', version - tonumber(ARGV[3]))
+end
+return changed
+`)
+
+// GetPatternsVersion gets version of patterns list, it is incremented on every pattern addition and removal
+func (connector *DbConnector) GetPatternsVersion() (int64, error) {
+	c := connector.pool.Get()
+	defer c.Close()
+	version, err := redis.Int64(c.Do("GET", patternsVersionKey))
+	if err != nil {
+		if err == redis.ErrNil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get patterns version, error: %v", err)
+	}
+	return version, nil
+}
+
+// GetPatternChanges gets changes of patterns list made after given version and current patterns version.
+// If some of these changes are already removed from change log, database.ErrPatternChangesLost is returned
+func (connector *DbConnector) GetPatternChanges(fromVersion int64) ([]*moira.PatternChange, int64, error) {
+	c := connector.pool.Get()
+	defer c.Close()
+
+	c.Send("MULTI")
+	c.Send("GET", patternsVersionKey)
+	c.Send("ZRANGEBYSCORE", patternChangesKey, fmt.Sprintf("(%d", fromVersion), "+inf")
+	rawResponse, err := redis.Values(c.Do("EXEC"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to EXEC: %v", err)
+	}
+	version, err := redis.Int64(rawResponse[0], nil)
+	if err != nil && err != redis.ErrNil {
+		return nil, 0, fmt.Errorf("failed to get patterns version, error: %v", err)
+	}
+	rawChanges, err := redis.Strings(rawResponse[1], nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get pattern changes, error: %v", err)
+	}
+
+	changes := make([]*moira.PatternChange, 0, len(rawChanges))
+	for _, rawChange := range rawChanges {
+		change, err := parsePatternChange(rawChange)
+		if err != nil {
+			return nil, 0, err
+		}
+		changes = append(changes, change)
+	}
+	if version < fromVersion || int64(len(changes)) != version-fromVersion {
+		return nil, version, database.ErrPatternChangesLost
+	}
+	return changes, version, nil
+}
+
+// sendPatternChange queues addition or removal of pattern with logging of this change
+func sendPatternChange(c redis.Conn, changeType string, pattern string) {
+	patternChangeScript.Send(c, patternsListKey, patternsVersionKey, patternChangesKey, changeType, pattern, maxPatternChanges)
+}
+
+// parsePatternChange parses change log entry "<version><change type><pattern>"
+func parsePatternChange(rawChange string) (*moira.PatternChange, error) {
+	typeIndex := strings.IndexAny(rawChange, patternAdded+patternRemoved)
+	if typeIndex < 1 {
+		return nil, fmt.Errorf("failed to parse pattern change: %s", rawChange)
+	}
+	version, err := strconv.ParseInt(rawChange[:typeIndex], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pattern change: %s, error: %v", rawChange, err)
+	}
+	return &moira.PatternChange{
+		Version: version,
+		Pattern: rawChange[typeIndex+1:],
+		Removed: rawChange[typeIndex:typeIndex+1] == patternRemoved,
+	}, nil
+}
+
+var patternsVersionKey = "moira-pattern-list-version"
+var patternChangesKey = "moira-pattern-list-changes"
@@ -0,0 +1,91 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/database"
+)
+
+func TestPatternChanges(t *testing.T) {
+	logger, _ := logging.GetLogger("dataBase")
+	dataBase := newTestDatabase(logger, config)
+	dataBase.flush()
+	defer dataBase.flush()
+
+	Convey("Pattern changes are logged only when patterns list is changed", t, func() {
+		version, err := dataBase.GetPatternsVersion()
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, 0)
+
+		trigger := &moira.Trigger{ID: "trigger1", Patterns: []string{"pattern.1", "pattern.2"}}
+		err = dataBase.SaveTrigger(trigger.ID, trigger)
+		So(err, ShouldBeNil)
+
+		// Patterns of another trigger are already in the list
+		trigger2 := &moira.Trigger{ID: "trigger2", Patterns: []string{"pattern.1"}}
+		err = dataBase.SaveTrigger(trigger2.ID, trigger2)
+		So(err, ShouldBeNil)
+
+		version, err = dataBase.GetPatternsVersion()
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, 2)
+
+		changes, version, err := dataBase.GetPatternChanges(0)
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, 2)
+		So(changes, ShouldHaveLength, 2)
+		So(changes[0].Version, ShouldEqual, 1)
+		So(changes[1].Version, ShouldEqual, 2)
+
+		err = dataBase.RemovePattern("pattern.2")
+		So(err, ShouldBeNil)
+		err = dataBase.RemovePattern("pattern.2")
+		So(err, ShouldBeNil)
+
+		changes, version, err = dataBase.GetPatternChanges(2)
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, 3)
+		So(changes, ShouldResemble, []*moira.PatternChange{{Version: 3, Pattern: "pattern.2", Removed: true}})
+
+		changes, version, err = dataBase.GetPatternChanges(3)
+		So(err, ShouldBeNil)
+		So(version, ShouldEqual, 3)
+		So(changes, ShouldBeEmpty)
+
+		Convey("If changes are not stored anymore, should return error", func() {
+			c := dataBase.pool.Get()
+			defer c.Close()
+			_, err := c.Do("ZREMRANGEBYSCORE", patternChangesKey, "-inf", 1)
+			So(err, ShouldBeNil)
+
+			_, _, err = dataBase.GetPatternChanges(0)
+			So(err, ShouldResemble, database.ErrPatternChangesLost)
+
+			_, _, err = dataBase.GetPatternChanges(5)
+			So(err, ShouldResemble, database.ErrPatternChangesLost)
+		})
+	})
+}
+
+func TestParsePatternChange(t *testing.T) {
+	Convey("Should parse change log entries", t, func() {
+		change, err := parsePatternChange("12+my.pattern")
+		So(err, ShouldBeNil)
+		So(change, ShouldResemble, &moira.PatternChange{Version: 12, Pattern: "my.pattern"})
+
+		change, err = parsePatternChange("3-seriesByTag('name=a-b')")
+		So(err, ShouldBeNil)
+		So(change, ShouldResemble, &moira.PatternChange{Version: 3, Pattern: "seriesByTag('name=a-b')", Removed: true})
+	})
+
+	Convey("Should return error for invalid entries", t, func() {
+		for _, rawChange := range []string{"", "+my.pattern", "my.pattern", "1a+my.pattern"} {
+			_, err := parsePatternChange(rawChange)
+			So(err, ShouldBeError)
+		}
+	})
+}
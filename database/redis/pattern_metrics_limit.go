@@ -0,0 +1,110 @@
+package redis
+
+import (
+	"fmt"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// patternMetricAddScript adds metric to pattern metrics if it is already there or pattern has less metrics than limit,
+// otherwise it marks pattern as limited. Event of metric is published only if metric is kept in pattern metrics.
+// KEYS: pattern metrics, limited patterns. ARGV: metric, pattern, limit, metric events channel, metric event
+var patternMetricAddScript = redis.NewScript(2, `
+if redis.call('SISMEMBER', KEYS[1], ARGV[1]) == 0 then
+	if redis.call('SCARD', KEYS[1]) >= tonumber(ARGV[3]) then
+		redis.call('HSET', KEYS[2], ARGV[2], ARGV[3])
+		return 0
+	end
+	redis.call('SADD', KEYS[1], ARGV[1])
+	redis.call('HDEL', KEYS[2], ARGV[2])
+end
+if ARGV[5] ~= '' then
+	redis.call('PUBLISH', ARGV[4], ARGV[5])
+end
+return 1
+`)
+
+// SetPatternMetricsLimit sets max number of metrics of single pattern, new metrics are not added to pattern having so many metrics.
+// 0 means no limit
+func (connector *DbConnector) SetPatternMetricsLimit(limit int64) {
+	connector.patternMetricsLimit = limit
+}
+
+// loadPatternMetricAddScript loads script limiting pattern metrics, so it can be sent by hash in pipeline
+func (connector *DbConnector) loadPatternMetricAddScript(c redis.Conn) error {
+	if connector.patternMetricsLimit <= 0 {
+		return nil
+	}
+	if err := patternMetricAddScript.Load(c); err != nil {
+		return fmt.Errorf("failed to load pattern metrics limit script, error: %v", err)
+	}
+	return nil
+}
+
+// sendPatternMetric queues addition of metric to pattern metrics and publishing of metric event if event is not empty.
+// Script limiting pattern metrics should be loaded before
+func (connector *DbConnector) sendPatternMetric(c redis.Conn, pattern, metric string, event []byte) {
+	if connector.patternMetricsLimit <= 0 {
+		c.Send("SADD", patternMetricsKey(pattern), metric)
+		if event != nil {
+			c.Send("PUBLISH", metricEventKey, event)
+		}
+		return
+	}
+	patternMetricAddScript.SendHash(c, patternMetricsKey(pattern), limitedPatternsKey, metric, pattern, connector.patternMetricsLimit, metricEventKey, event)
+}
+
+// GetPatternsMetricsCount gets number of metrics of every given pattern
+func (connector *DbConnector) GetPatternsMetricsCount(patterns []string) (map[string]int64, error) {
+	res := make(map[string]int64, len(patterns))
+	if len(patterns) == 0 {
+		return res, nil
+	}
+	c := connector.pool.Get()
+	defer c.Close()
+
+	for _, pattern := range patterns {
+		c.Send("SCARD", patternMetricsKey(pattern))
+	}
+	counts, err := redis.Int64s(c.Do(""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get patterns metrics count, error: %v", err)
+	}
+	for i, pattern := range patterns {
+		res[pattern] = counts[i]
+	}
+	return res, nil
+}
+
+// GetLimitedPatterns gets those of given patterns which reached limit of metrics with the limit
+func (connector *DbConnector) GetLimitedPatterns(patterns []string) (map[string]int64, error) {
+	res := make(map[string]int64)
+	if len(patterns) == 0 {
+		return res, nil
+	}
+	c := connector.pool.Get()
+	defer c.Close()
+
+	args := make([]interface{}, 0, len(patterns)+1)
+	args = append(args, limitedPatternsKey)
+	for _, pattern := range patterns {
+		args = append(args, pattern)
+	}
+	limits, err := redis.Values(c.Do("HMGET", args...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get limited patterns, error: %v", err)
+	}
+	for i, limit := range limits {
+		if limit == nil {
+			continue
+		}
+		value, err := redis.Int64(limit, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse metrics limit of pattern %s, error: %v", patterns[i], err)
+		}
+		res[patterns[i]] = value
+	}
+	return res, nil
+}
+
+var limitedPatternsKey = "moira-limited-patterns"
@@ -0,0 +1,77 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+)
+
+func TestPatternMetricsLimit(t *testing.T) {
+	logger, _ := logging.GetLogger("dataBase")
+	dataBase := newTestDatabase(logger, config)
+	dataBase.flush()
+	defer dataBase.SetPatternMetricsLimit(0)
+	pattern := "my.test.*.metric"
+	otherPattern := "my.test.super.*"
+
+	Convey("Without limit, should count all metrics of pattern", t, func() {
+		So(dataBase.AddPatternMetric(pattern, "my.test.first.metric"), ShouldBeNil)
+		So(dataBase.AddPatternMetric(pattern, "my.test.second.metric"), ShouldBeNil)
+
+		count, err := dataBase.GetPatternsMetricsCount([]string{pattern, otherPattern})
+		So(err, ShouldBeNil)
+		So(count, ShouldResemble, map[string]int64{pattern: 2, otherPattern: 0})
+
+		limited, err := dataBase.GetLimitedPatterns([]string{pattern, otherPattern})
+		So(err, ShouldBeNil)
+		So(limited, ShouldBeEmpty)
+	})
+
+	Convey("With limit, should not add new metrics to pattern reached it", t, func() {
+		dataBase.SetPatternMetricsLimit(2)
+		err := dataBase.SaveMetrics(map[string]*moira.MatchedMetric{
+			"my.test.first.metric": {Metric: "my.test.first.metric", Patterns: []string{pattern}, Value: 1, Timestamp: 10, RetentionTimestamp: 10, Retention: 10},
+			"my.test.super.metric": {Metric: "my.test.super.metric", Patterns: []string{pattern, otherPattern}, Value: 1, Timestamp: 10, RetentionTimestamp: 10, Retention: 10},
+		})
+		So(err, ShouldBeNil)
+
+		metrics, err := dataBase.GetPatternMetrics(pattern)
+		So(err, ShouldBeNil)
+		So(metrics, ShouldHaveLength, 2)
+		So(metrics, ShouldNotContain, "my.test.super.metric")
+		metrics, err = dataBase.GetPatternMetrics(otherPattern)
+		So(err, ShouldBeNil)
+		So(metrics, ShouldResemble, []string{"my.test.super.metric"})
+
+		limited, err := dataBase.GetLimitedPatterns([]string{pattern, otherPattern})
+		So(err, ShouldBeNil)
+		So(limited, ShouldResemble, map[string]int64{pattern: 2})
+
+		Convey("Values of metric rejected by all its patterns should not be saved", func() {
+			err := dataBase.SaveMetrics(map[string]*moira.MatchedMetric{
+				"my.test.third.metric": {Metric: "my.test.third.metric", Patterns: []string{pattern}, Value: 1, Timestamp: 10, RetentionTimestamp: 10, Retention: 10},
+			})
+			So(err, ShouldBeNil)
+
+			values, err := dataBase.GetMetricsValues([]string{"my.test.third.metric", "my.test.super.metric"}, 0, 20)
+			So(err, ShouldBeNil)
+			So(values["my.test.third.metric"], ShouldBeEmpty)
+			So(values["my.test.super.metric"], ShouldResemble, []*moira.MetricValue{{RetentionTimestamp: 10, Timestamp: 10, Value: 1}})
+		})
+	})
+
+	Convey("Removing of pattern metrics should reset its limit", t, func() {
+		So(dataBase.RemovePatternsMetrics([]string{pattern}), ShouldBeNil)
+		So(dataBase.AddPatternMetric(pattern, "my.test.super.metric"), ShouldBeNil)
+
+		limited, err := dataBase.GetLimitedPatterns([]string{pattern})
+		So(err, ShouldBeNil)
+		So(limited, ShouldBeEmpty)
+		count, err := dataBase.GetPatternsMetricsCount([]string{pattern})
+		So(err, ShouldBeNil)
+		So(count, ShouldResemble, map[string]int64{pattern: 1})
+	})
+}
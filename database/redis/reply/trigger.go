@@ -12,63 +12,87 @@ import (
 
 // Duty hack for moira.Trigger TTL int64 and stored trigger TTL string compatibility
 type triggerStorageElement struct {
-	ID               string              `json:"id"`
-	Name             string              `json:"name"`
-	Desc             *string             `json:"desc,omitempty"`
-	Targets          []string            `json:"targets"`
-	WarnValue        *float64            `json:"warn_value"`
-	ErrorValue       *float64            `json:"error_value"`
-	TriggerType      string              `json:"trigger_type,omitempty"`
-	Tags             []string            `json:"tags"`
-	TTLState         *string             `json:"ttl_state,omitempty"`
-	Schedule         *moira.ScheduleData `json:"sched,omitempty"`
-	Expression       *string             `json:"expr,omitempty"`
-	PythonExpression *string             `json:"expression,omitempty"`
-	Patterns         []string            `json:"patterns"`
-	TTL              string              `json:"ttl,omitempty"`
-	IsRemote         bool                `json:"is_remote"`
-	MuteNewMetrics   bool                `json:"mute_new_metrics,omitempty"`
+	ID                string                 `json:"id"`
+	Name              string                 `json:"name"`
+	Desc              *string                `json:"desc,omitempty"`
+	Targets           []string               `json:"targets"`
+	WarnValue         *float64               `json:"warn_value"`
+	ErrorValue        *float64               `json:"error_value"`
+	WarnRecoverValue  *float64               `json:"warn_recover_value,omitempty"`
+	ErrorRecoverValue *float64               `json:"error_recover_value,omitempty"`
+	TriggerType       string                 `json:"trigger_type,omitempty"`
+	Tags              []string               `json:"tags"`
+	TTLState          *string                `json:"ttl_state,omitempty"`
+	Schedule          *moira.ScheduleData    `json:"sched,omitempty"`
+	Expression        *string                `json:"expr,omitempty"`
+	PythonExpression  *string                `json:"expression,omitempty"`
+	Patterns          []string               `json:"patterns"`
+	TTL               string                 `json:"ttl,omitempty"`
+	IsRemote          bool                   `json:"is_remote"`
+	MuteNewMetrics    bool                   `json:"mute_new_metrics,omitempty"`
+	Anomaly           *moira.AnomalyData     `json:"anomaly,omitempty"`
+	PendingPoints     int                    `json:"pending_points,omitempty"`
+	RemindIntervals   map[string]int64       `json:"remind_intervals,omitempty"`
+	Dependencies      []string               `json:"dependencies,omitempty"`
+	Composite         *moira.CompositeData   `json:"composite,omitempty"`
+	Aggregation       *moira.AggregationData `json:"aggregation,omitempty"`
 }
 
 func (storageElement *triggerStorageElement) toTrigger() moira.Trigger {
 	return moira.Trigger{
-		ID:               storageElement.ID,
-		Name:             storageElement.Name,
-		Desc:             storageElement.Desc,
-		Targets:          storageElement.Targets,
-		WarnValue:        storageElement.WarnValue,
-		ErrorValue:       storageElement.ErrorValue,
-		TriggerType:      storageElement.TriggerType,
-		Tags:             storageElement.Tags,
-		TTLState:         storageElement.TTLState,
-		Schedule:         storageElement.Schedule,
-		Expression:       storageElement.Expression,
-		PythonExpression: storageElement.PythonExpression,
-		Patterns:         storageElement.Patterns,
-		TTL:              getTriggerTTL(storageElement.TTL),
-		IsRemote:         storageElement.IsRemote,
-		MuteNewMetrics:   storageElement.MuteNewMetrics,
+		ID:                storageElement.ID,
+		Name:              storageElement.Name,
+		Desc:              storageElement.Desc,
+		Targets:           storageElement.Targets,
+		WarnValue:         storageElement.WarnValue,
+		ErrorValue:        storageElement.ErrorValue,
+		WarnRecoverValue:  storageElement.WarnRecoverValue,
+		ErrorRecoverValue: storageElement.ErrorRecoverValue,
+		TriggerType:       storageElement.TriggerType,
+		Tags:              storageElement.Tags,
+		TTLState:          storageElement.TTLState,
+		Schedule:          storageElement.Schedule,
+		Expression:        storageElement.Expression,
+		PythonExpression:  storageElement.PythonExpression,
+		Patterns:          storageElement.Patterns,
+		TTL:               getTriggerTTL(storageElement.TTL),
+		IsRemote:          storageElement.IsRemote,
+		MuteNewMetrics:    storageElement.MuteNewMetrics,
+		Anomaly:           storageElement.Anomaly,
+		PendingPoints:     storageElement.PendingPoints,
+		RemindIntervals:   storageElement.RemindIntervals,
+		Dependencies:      storageElement.Dependencies,
+		Composite:         storageElement.Composite,
+		Aggregation:       storageElement.Aggregation,
 	}
 }
 
 func toTriggerStorageElement(trigger *moira.Trigger, triggerID string) *triggerStorageElement {
 	return &triggerStorageElement{
-		ID:               triggerID,
-		Name:             trigger.Name,
-		Desc:             trigger.Desc,
-		Targets:          trigger.Targets,
-		WarnValue:        trigger.WarnValue,
-		ErrorValue:       trigger.ErrorValue,
-		TriggerType:      trigger.TriggerType,
-		Tags:             trigger.Tags,
-		TTLState:         trigger.TTLState,
-		Schedule:         trigger.Schedule,
-		Expression:       trigger.Expression,
-		PythonExpression: trigger.PythonExpression,
-		Patterns:         trigger.Patterns,
-		TTL:              getTriggerTTLString(trigger.TTL),
-		IsRemote:         trigger.IsRemote,
-		MuteNewMetrics:   trigger.MuteNewMetrics,
+		ID:                triggerID,
+		Name:              trigger.Name,
+		Desc:              trigger.Desc,
+		Targets:           trigger.Targets,
+		WarnValue:         trigger.WarnValue,
+		ErrorValue:        trigger.ErrorValue,
+		WarnRecoverValue:  trigger.WarnRecoverValue,
+		ErrorRecoverValue: trigger.ErrorRecoverValue,
+		TriggerType:       trigger.TriggerType,
+		Tags:              trigger.Tags,
+		TTLState:          trigger.TTLState,
+		Schedule:          trigger.Schedule,
+		Expression:        trigger.Expression,
+		PythonExpression:  trigger.PythonExpression,
+		Patterns:          trigger.Patterns,
+		TTL:               getTriggerTTLString(trigger.TTL),
+		IsRemote:          trigger.IsRemote,
+		MuteNewMetrics:    trigger.MuteNewMetrics,
+		Anomaly:           trigger.Anomaly,
+		PendingPoints:     trigger.PendingPoints,
+		RemindIntervals:   trigger.RemindIntervals,
+		Dependencies:      trigger.Dependencies,
+		Composite:         trigger.Composite,
+		Aggregation:       trigger.Aggregation,
 	}
 }
 
@@ -126,7 +150,7 @@ func GetTriggerBytes(triggerID string, trigger *moira.Trigger) ([]byte, error) {
 //  - expression: trigger has custom expression
 func convertTriggerIfNecessary(trigger *moira.Trigger) {
 	switch trigger.TriggerType {
-	case moira.RisingTrigger, moira.FallingTrigger, moira.ExpressionTrigger:
+	case moira.RisingTrigger, moira.FallingTrigger, moira.ExpressionTrigger, moira.AnomalyTrigger, moira.CompositeTrigger:
 		return
 	}
 	setProperTriggerType(trigger)
@@ -44,6 +44,17 @@ func (connector *DbConnector) GetRemoteTriggerIDs() ([]string, error) {
 	return triggerIds, nil
 }
 
+// GetCompositeTriggerIDs gets moira composite triggerIDs
+func (connector *DbConnector) GetCompositeTriggerIDs() ([]string, error) {
+	c := connector.pool.Get()
+	defer c.Close()
+	triggerIds, err := redis.Strings(c.Do("SMEMBERS", compositeTriggersListKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get composite triggers-list: %s", err.Error())
+	}
+	return triggerIds, nil
+}
+
 // GetTrigger gets trigger and trigger tags by given ID and return it in merged object
 func (connector *DbConnector) GetTrigger(triggerID string) (moira.Trigger, error) {
 	c := connector.pool.Get()
@@ -151,11 +162,16 @@ func (connector *DbConnector) SaveTrigger(triggerID string, trigger *moira.Trigg
 	}
 	c.Send("SET", triggerKey(triggerID), bytes)
 	c.Send("SADD", triggersListKey, triggerID)
+	if trigger.TriggerType == moira.CompositeTrigger {
+		c.Send("SADD", compositeTriggersListKey, triggerID)
+	} else {
+		c.Send("SREM", compositeTriggersListKey, triggerID)
+	}
 	if trigger.IsRemote {
 		c.Send("SADD", remoteTriggersListKey, triggerID)
 	} else {
 		for _, pattern := range trigger.Patterns {
-			c.Send("SADD", patternsListKey, pattern)
+			sendPatternChange(c, patternAdded, pattern)
 			c.Send("SADD", patternTriggersKey(pattern), triggerID)
 		}
 	}
@@ -210,6 +226,7 @@ func (connector *DbConnector) RemoveTrigger(triggerID string) error {
 	c.Send("DEL", triggerEventsKey(triggerID))
 	c.Send("SREM", triggersListKey, triggerID)
 	c.Send("SREM", remoteTriggersListKey, triggerID)
+	c.Send("SREM", compositeTriggersListKey, triggerID)
 	c.Send("SREM", unusedTriggersKey, triggerID)
 	for _, tag := range trigger.Tags {
 		c.Send("SREM", tagTriggersKey(tag), triggerID)
@@ -329,6 +346,7 @@ func (connector *DbConnector) triggerHasSubscriptions(trigger *moira.Trigger) (b
 
 var triggersListKey = "moira-triggers-list"
 var remoteTriggersListKey = "moira-remote-triggers-list"
+var compositeTriggersListKey = "moira-composite-triggers-list"
 
 func triggerKey(triggerID string) string {
 	return fmt.Sprintf("moira-trigger:%s", triggerID)
@@ -118,6 +118,37 @@ type MatchedMetric struct {
 	Timestamp          int64
 	RetentionTimestamp int64
 	Retention          int
+	// Aggregate of points of retention slot received since metric was saved last time, if metric is aggregated.
+	// It is merged with saved aggregate of the slot, and value of the slot is replaced with value of merged aggregate
+	Aggregate *MetricAggregate
+}
+
+// MetricAggregate is an aggregated state of points of metric retention slot
+type MetricAggregate struct {
+	Method string
+	Sum    float64
+	Min    float64
+	Max    float64
+	Count  int64
+}
+
+// Add adds value of point to aggregate
+func (aggregate *MetricAggregate) Add(value float64) {
+	if aggregate.Count == 0 || value < aggregate.Min {
+		aggregate.Min = value
+	}
+	if aggregate.Count == 0 || value > aggregate.Max {
+		aggregate.Max = value
+	}
+	aggregate.Sum += value
+	aggregate.Count++
+}
+
+// PatternChange represents addition or removal of pattern to patterns list
+type PatternChange struct {
+	Version int64
+	Pattern string
+	Removed bool
 }
 
 // MetricValue represents metric data
@@ -134,26 +165,88 @@ const (
 	RisingTrigger = "rising"
 	// ExpressionTrigger represents trigger type with custom user expression
 	ExpressionTrigger = "expression"
+	// AnomalyTrigger represents trigger type, in which WARN and ERROR are numbers of standard deviations
+	// of main target value from its historical baseline
+	AnomalyTrigger = "anomaly"
+	// CompositeTrigger represents trigger type, which state is computed from states of other triggers
+	CompositeTrigger = "composite"
+)
+
+const (
+	// RollingBaseline is a baseline of anomaly trigger made of values in window preceding checked value
+	RollingBaseline = "rolling"
+	// SeasonalBaseline is a baseline of anomaly trigger made of values at the same time of previous seasons,
+	// e.g. at the same hour of previous weeks
+	SeasonalBaseline = "seasonal"
+)
+
+const (
+	// DeviationBoth makes anomaly trigger alert on values both above and below baseline
+	DeviationBoth = "both"
+	// DeviationUp makes anomaly trigger alert on values above baseline only
+	DeviationUp = "up"
+	// DeviationDown makes anomaly trigger alert on values below baseline only
+	DeviationDown = "down"
 )
 
+// AnomalyData represents parameters of historical baseline of anomaly trigger
+type AnomalyData struct {
+	// Baseline is a method of baseline computation: rolling or seasonal
+	Baseline string `json:"baseline"`
+	// Window is a length in seconds of window preceding value for rolling baseline or of season for seasonal baseline
+	Window int64 `json:"window"`
+	// Seasons is a number of previous seasons used for seasonal baseline
+	Seasons int `json:"seasons,omitempty"`
+	// Direction of alerted deviations from baseline: both, up or down. Both is used if it is empty
+	Direction string `json:"direction,omitempty"`
+}
+
+// CompositeData represents input triggers of composite trigger and expression computing its state
+type CompositeData struct {
+	// TriggerIDs are IDs of input triggers
+	TriggerIDs []string `json:"trigger_ids,omitempty"`
+	// Tags select triggers having all of these tags as input triggers
+	Tags []string `json:"tags,omitempty"`
+	// Expression computes state of composite trigger from states of input triggers,
+	// e.g. "ERROR_COUNT >= 2 ? ERROR : OK" or "[trigger-id] == ERROR ? WARN : OK"
+	Expression string `json:"expression"`
+}
+
+// AggregationData represents thresholds of bad metrics which trigger state is aggregated by,
+// trigger is in WARN or ERROR state if more than given percent or number of its metrics are in WARN or ERROR state
+type AggregationData struct {
+	// Percent is a percentage of metrics in bad state, 0 means it is not used
+	Percent float64 `json:"percent,omitempty"`
+	// Count is a number of metrics in bad state, 0 means it is not used
+	Count int `json:"count,omitempty"`
+}
+
 // Trigger represents trigger data object
 type Trigger struct {
-	ID               string        `json:"id"`
-	Name             string        `json:"name"`
-	Desc             *string       `json:"desc,omitempty"`
-	Targets          []string      `json:"targets"`
-	WarnValue        *float64      `json:"warn_value"`
-	ErrorValue       *float64      `json:"error_value"`
-	TriggerType      string        `json:"trigger_type"`
-	Tags             []string      `json:"tags"`
-	TTLState         *string       `json:"ttl_state,omitempty"`
-	TTL              int64         `json:"ttl,omitempty"`
-	Schedule         *ScheduleData `json:"sched,omitempty"`
-	Expression       *string       `json:"expression,omitempty"`
-	PythonExpression *string       `json:"python_expression,omitempty"`
-	Patterns         []string      `json:"patterns"`
-	IsRemote         bool          `json:"is_remote"`
-	MuteNewMetrics   bool          `json:"mute_new_metrics"`
+	ID                string           `json:"id"`
+	Name              string           `json:"name"`
+	Desc              *string          `json:"desc,omitempty"`
+	Targets           []string         `json:"targets"`
+	WarnValue         *float64         `json:"warn_value"`
+	ErrorValue        *float64         `json:"error_value"`
+	WarnRecoverValue  *float64         `json:"warn_recover_value,omitempty"`
+	ErrorRecoverValue *float64         `json:"error_recover_value,omitempty"`
+	TriggerType       string           `json:"trigger_type"`
+	Tags              []string         `json:"tags"`
+	TTLState          *string          `json:"ttl_state,omitempty"`
+	TTL               int64            `json:"ttl,omitempty"`
+	Schedule          *ScheduleData    `json:"sched,omitempty"`
+	Expression        *string          `json:"expression,omitempty"`
+	PythonExpression  *string          `json:"python_expression,omitempty"`
+	Patterns          []string         `json:"patterns"`
+	IsRemote          bool             `json:"is_remote"`
+	MuteNewMetrics    bool             `json:"mute_new_metrics"`
+	Anomaly           *AnomalyData     `json:"anomaly,omitempty"`
+	PendingPoints     int              `json:"pending_points,omitempty"`
+	RemindIntervals   map[string]int64 `json:"remind_intervals,omitempty"`
+	Dependencies      []string         `json:"dependencies,omitempty"`
+	Composite         *CompositeData   `json:"composite,omitempty"`
+	Aggregation       *AggregationData `json:"aggregation,omitempty"`
 }
 
 // TriggerCheck represents trigger data with last check data and check timestamp
@@ -174,6 +267,7 @@ type CheckData struct {
 	LastSuccessfulCheckTimestamp int64                  `json:"last_successful_check_timestamp"`
 	Suppressed                   bool                   `json:"suppressed,omitempty"`
 	SuppressedState              string                 `json:"suppressed_state,omitempty"`
+	SuppressedDependencyID       string                 `json:"suppressed_dependency_id,omitempty"`
 	Message                      string                 `json:"msg,omitempty"`
 }
 
@@ -186,6 +280,14 @@ type MetricState struct {
 	Timestamp       int64    `json:"timestamp"`
 	Value           *float64 `json:"value,omitempty"`
 	Maintenance     int64    `json:"maintenance,omitempty"`
+	// PendingState is a bad state of the latest points which is not switched to yet, as there are less than required points in it in a row
+	PendingState string `json:"pending_state,omitempty"`
+	// PendingPoints is a number of the latest points in pending state in a row
+	PendingPoints int `json:"pending_points,omitempty"`
+	// PendingTimestamp is a timestamp of the latest point counted in pending points, points re-evaluated by next checks are not counted again
+	PendingTimestamp int64 `json:"pending_timestamp,omitempty"`
+	// SuppressedDependencyID is an ID of parent trigger which bad state suppressed events of metric
+	SuppressedDependencyID string `json:"suppressed_dependency_id,omitempty"`
 }
 
 // MetricEvent represents filter metric event
@@ -331,6 +433,88 @@ func (trigger *Trigger) IsSimple() bool {
 	return true
 }
 
+// Validate checks baseline parameters of anomaly trigger
+func (anomaly *AnomalyData) Validate() error {
+	if anomaly == nil {
+		return fmt.Errorf("anomaly parameters are required for trigger_type anomaly")
+	}
+	if anomaly.Window <= 0 {
+		return fmt.Errorf("anomaly window should be greater than 0")
+	}
+	switch anomaly.Baseline {
+	case RollingBaseline:
+	case SeasonalBaseline:
+		if anomaly.Seasons < 2 {
+			return fmt.Errorf("seasonal baseline requires at least 2 seasons")
+		}
+	default:
+		return fmt.Errorf("wrong anomaly baseline: %v, allowable values: '%v', '%v'", anomaly.Baseline, RollingBaseline, SeasonalBaseline)
+	}
+	switch anomaly.Direction {
+	case "", DeviationBoth, DeviationUp, DeviationDown:
+	default:
+		return fmt.Errorf("wrong anomaly direction: %v, allowable values: '%v', '%v', '%v'", anomaly.Direction, DeviationBoth, DeviationUp, DeviationDown)
+	}
+	return nil
+}
+
+// Validate checks that composite trigger has input triggers and expression
+func (composite *CompositeData) Validate() error {
+	if composite == nil {
+		return fmt.Errorf("composite parameters are required for trigger_type composite")
+	}
+	if len(composite.TriggerIDs) == 0 && len(composite.Tags) == 0 {
+		return fmt.Errorf("composite trigger requires input trigger_ids or tags")
+	}
+	if composite.Expression == "" {
+		return fmt.Errorf("composite trigger requires expression")
+	}
+	return nil
+}
+
+// HasInput returns true if trigger with given ID and tags is an input trigger of composite trigger
+func (composite *CompositeData) HasInput(triggerID string, triggerTags []string) bool {
+	for _, inputID := range composite.TriggerIDs {
+		if inputID == triggerID {
+			return true
+		}
+	}
+	return len(composite.Tags) > 0 && Subset(composite.Tags, triggerTags)
+}
+
+// Validate checks that aggregation has percent or number of bad metrics
+func (aggregation *AggregationData) Validate() error {
+	if aggregation.Percent < 0 || aggregation.Percent >= 100 {
+		return fmt.Errorf("aggregation percent should be from 0 to 100")
+	}
+	if aggregation.Count < 0 {
+		return fmt.Errorf("aggregation count should not be negative")
+	}
+	if aggregation.Percent == 0 && aggregation.Count == 0 {
+		return fmt.Errorf("aggregation requires percent or count of metrics in bad state")
+	}
+	return nil
+}
+
+// IsExceeded returns true if given number of bad metrics of total ones is more than aggregation percent or count
+func (aggregation *AggregationData) IsExceeded(badMetricsCount, metricsCount int) bool {
+	if aggregation.Count > 0 && badMetricsCount > aggregation.Count {
+		return true
+	}
+	return aggregation.Percent > 0 && metricsCount > 0 && float64(badMetricsCount)*100/float64(metricsCount) > aggregation.Percent
+}
+
+// GetWorstState returns the worst of trigger state and states of its metrics
+func (checkData *CheckData) GetWorstState() string {
+	worstState := checkData.State
+	for _, metricData := range checkData.Metrics {
+		if scores[metricData.State] > scores[worstState] {
+			worstState = metricData.State
+		}
+	}
+	return worstState
+}
+
 // UpdateScore update and return checkData score, based on metric states and checkData state
 func (checkData *CheckData) UpdateScore() int64 {
 	checkData.Score = scores[checkData.State]
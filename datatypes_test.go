@@ -251,6 +251,97 @@ func TestTrigger_IsSimple(t *testing.T) {
 	})
 }
 
+func TestAnomalyData_Validate(t *testing.T) {
+	Convey("Valid anomaly parameters", t, func() {
+		anomalies := []*AnomalyData{
+			{Baseline: RollingBaseline, Window: 3600},
+			{Baseline: RollingBaseline, Window: 3600, Direction: DeviationUp},
+			{Baseline: SeasonalBaseline, Window: 604800, Seasons: 3, Direction: DeviationBoth},
+		}
+
+		for _, anomaly := range anomalies {
+			So(anomaly.Validate(), ShouldBeNil)
+		}
+	})
+
+	Convey("Invalid anomaly parameters", t, func() {
+		anomalies := []*AnomalyData{
+			nil,
+			{Baseline: RollingBaseline},
+			{Baseline: "median", Window: 3600},
+			{Baseline: SeasonalBaseline, Window: 604800, Seasons: 1},
+			{Baseline: RollingBaseline, Window: 3600, Direction: "left"},
+		}
+
+		for _, anomaly := range anomalies {
+			So(anomaly.Validate(), ShouldBeError)
+		}
+	})
+}
+
+func TestCompositeData_Validate(t *testing.T) {
+	Convey("Valid composite parameters", t, func() {
+		So((&CompositeData{TriggerIDs: []string{"trigger1"}, Expression: "ERROR_COUNT > 0 ? ERROR : OK"}).Validate(), ShouldBeNil)
+		So((&CompositeData{Tags: []string{"service"}, Expression: "ERROR_COUNT > 0 ? ERROR : OK"}).Validate(), ShouldBeNil)
+	})
+
+	Convey("Invalid composite parameters", t, func() {
+		composites := []*CompositeData{
+			nil,
+			{Expression: "ERROR_COUNT > 0 ? ERROR : OK"},
+			{TriggerIDs: []string{"trigger1"}},
+		}
+
+		for _, composite := range composites {
+			So(composite.Validate(), ShouldBeError)
+		}
+	})
+}
+
+func TestCompositeData_HasInput(t *testing.T) {
+	Convey("Input triggers are selected by IDs or all tags", t, func() {
+		composite := CompositeData{TriggerIDs: []string{"trigger1"}, Tags: []string{"service", "backend"}}
+		So(composite.HasInput("trigger1", nil), ShouldBeTrue)
+		So(composite.HasInput("trigger2", []string{"backend", "service", "db"}), ShouldBeTrue)
+		So(composite.HasInput("trigger2", []string{"service"}), ShouldBeFalse)
+
+		composite = CompositeData{TriggerIDs: []string{"trigger1"}}
+		So(composite.HasInput("trigger2", []string{"service"}), ShouldBeFalse)
+	})
+}
+
+func TestCheckData_GetWorstState(t *testing.T) {
+	Convey("Worst state of trigger and its metrics", t, func() {
+		checkData := CheckData{State: "OK"}
+		So(checkData.GetWorstState(), ShouldEqual, "OK")
+
+		checkData.Metrics = map[string]MetricState{"m1": {State: "WARN"}, "m2": {State: "NODATA"}, "m3": {State: "ERROR"}}
+		So(checkData.GetWorstState(), ShouldEqual, "NODATA")
+
+		checkData.State = "EXCEPTION"
+		So(checkData.GetWorstState(), ShouldEqual, "EXCEPTION")
+	})
+}
+
+func TestAggregationData_IsExceeded(t *testing.T) {
+	Convey("Aggregation validation", t, func() {
+		So((&AggregationData{Percent: 10}).Validate(), ShouldBeNil)
+		So((&AggregationData{Count: 3}).Validate(), ShouldBeNil)
+		So((&AggregationData{}).Validate(), ShouldBeError)
+		So((&AggregationData{Percent: 100}).Validate(), ShouldBeError)
+		So((&AggregationData{Count: -1}).Validate(), ShouldBeError)
+	})
+
+	Convey("More than percent or count of bad metrics", t, func() {
+		aggregation := AggregationData{Percent: 10, Count: 5}
+		So(aggregation.IsExceeded(1, 10), ShouldBeFalse)
+		So(aggregation.IsExceeded(2, 10), ShouldBeTrue)
+		So(aggregation.IsExceeded(5, 100), ShouldBeFalse)
+		So(aggregation.IsExceeded(6, 100), ShouldBeTrue)
+		So(aggregation.IsExceeded(0, 0), ShouldBeFalse)
+	})
+}
+
 func TestCheckData_GetEventTimestamp(t *testing.T) {
 	Convey("Get event timestamp", t, func() {
 		checkData := CheckData{Timestamp: 800, EventTimestamp: 0}
@@ -0,0 +1,68 @@
+package expression
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CompositeExpression represents composite trigger expression handler parameters, those are states of its input triggers
+type CompositeExpression struct {
+	Expression string
+
+	// InputStates are states of input triggers by their IDs
+	InputStates map[string]string
+}
+
+// Get realizing govaluate.Parameters interface used in evaluable expression.
+// Besides state values it provides numbers of input triggers in every state, e.g. ERROR_COUNT,
+// total number of input triggers as TOTAL and state of every input trigger by its ID, e.g. [trigger-id]
+func (compositeExpression CompositeExpression) Get(name string) (interface{}, error) {
+	switch name {
+	case "OK", "WARN", "ERROR", "NODATA", "EXCEPTION":
+		return name, nil
+	case "WARNING":
+		return "WARN", nil
+	case "TOTAL":
+		return float64(len(compositeExpression.InputStates)), nil
+	}
+	if strings.HasSuffix(name, "_COUNT") {
+		return compositeExpression.getStateCount(strings.TrimSuffix(name, "_COUNT"))
+	}
+	state, ok := compositeExpression.InputStates[name]
+	if !ok {
+		return nil, fmt.Errorf("no input trigger with ID %s", name)
+	}
+	return state, nil
+}
+
+func (compositeExpression CompositeExpression) getStateCount(state string) (interface{}, error) {
+	switch state {
+	case "OK", "WARN", "ERROR", "NODATA", "EXCEPTION":
+	default:
+		return nil, fmt.Errorf("no value with name %s_COUNT", state)
+	}
+	var count float64
+	for _, inputState := range compositeExpression.InputStates {
+		if inputState == state {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Evaluate gets composite trigger expression and evaluates it for states of input triggers using govaluate
+func (compositeExpression *CompositeExpression) Evaluate() (string, error) {
+	expr, err := getUserExpression(compositeExpression.Expression)
+	if err != nil {
+		return "", ErrInvalidExpression{internalError: err}
+	}
+	result, err := expr.Eval(compositeExpression)
+	if err != nil {
+		return "", ErrInvalidExpression{internalError: err}
+	}
+	switch result {
+	case "OK", "WARN", "ERROR", "NODATA":
+		return result.(string), nil
+	}
+	return "", ErrInvalidExpression{internalError: fmt.Errorf("composite expression result must be one of states: OK, WARN, ERROR, NODATA")}
+}
@@ -0,0 +1,47 @@
+package expression
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompositeExpression(t *testing.T) {
+	inputStates := map[string]string{
+		"trigger-1": "ERROR",
+		"trigger-2": "ERROR",
+		"trigger-3": "OK",
+		"trigger-4": "NODATA",
+	}
+
+	Convey("Test quorum expression", t, func() {
+		result, err := (&CompositeExpression{Expression: "ERROR_COUNT >= 2 ? ERROR : OK", InputStates: inputStates}).Evaluate()
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "ERROR")
+
+		result, err = (&CompositeExpression{Expression: "OK_COUNT < TOTAL / 2 ? WARN : OK", InputStates: inputStates}).Evaluate()
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "WARN")
+
+		result, err = (&CompositeExpression{Expression: "ERROR_COUNT + NODATA_COUNT == TOTAL ? ERROR : OK", InputStates: inputStates}).Evaluate()
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "OK")
+	})
+
+	Convey("Test expression of input triggers states", t, func() {
+		result, err := (&CompositeExpression{Expression: "[trigger-1] == ERROR && [trigger-3] == OK ? WARN : OK", InputStates: inputStates}).Evaluate()
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "WARN")
+	})
+
+	Convey("Test errors", t, func() {
+		result, err := (&CompositeExpression{Expression: "[trigger-5] == ERROR ? ERROR : OK", InputStates: inputStates}).Evaluate()
+		So(err, ShouldResemble, ErrInvalidExpression{fmt.Errorf("no input trigger with ID trigger-5")})
+		So(result, ShouldBeEmpty)
+
+		result, err = (&CompositeExpression{Expression: "ERROR_COUNT", InputStates: inputStates}).Evaluate()
+		So(err, ShouldResemble, ErrInvalidExpression{fmt.Errorf("composite expression result must be one of states: OK, WARN, ERROR, NODATA")})
+		So(result, ShouldBeEmpty)
+	})
+}
@@ -15,6 +15,9 @@ var exprWarnRising, _ = govaluate.NewEvaluableExpression("t1 >= WARN_VALUE ? WAR
 var exprErrRising, _ = govaluate.NewEvaluableExpression("t1 >= ERROR_VALUE ? ERROR : OK")
 var exprWarnFalling, _ = govaluate.NewEvaluableExpression("t1 <= WARN_VALUE ? WARN : OK")
 var exprErrFalling, _ = govaluate.NewEvaluableExpression("t1 <= ERROR_VALUE ? ERROR : OK")
+var exprWarnErrorAnomaly, _ = govaluate.NewEvaluableExpression("DEVIATION >= ERROR_VALUE ? ERROR : (DEVIATION >= WARN_VALUE ? WARN : OK)")
+var exprWarnAnomaly, _ = govaluate.NewEvaluableExpression("DEVIATION >= WARN_VALUE ? WARN : OK")
+var exprErrAnomaly, _ = govaluate.NewEvaluableExpression("DEVIATION >= ERROR_VALUE ? ERROR : OK")
 
 var cache = make(map[string]*govaluate.EvaluableExpression)
 var cacheLock sync.Mutex
@@ -36,9 +39,17 @@ type TriggerExpression struct {
 	ErrorValue  *float64
 	TriggerType string
 
+	// WarnRecoverValue and ErrorRecoverValue are thresholds which metric of rising or falling trigger
+	// should cross back to leave WARN or ERROR state, they are used to prevent flapping around threshold
+	WarnRecoverValue  *float64
+	ErrorRecoverValue *float64
+
 	MainTargetValue         float64
 	AdditionalTargetsValues map[string]float64
 	PreviousState           string
+
+	// Deviation is a number of standard deviations of main target value from its baseline, it is used by anomaly triggers
+	Deviation float64
 }
 
 // Get realizing govaluate.Parameters interface used in evaluable expression
@@ -62,10 +73,22 @@ func (triggerExpression TriggerExpression) Get(name string) (interface{}, error)
 			return nil, fmt.Errorf("no value with name ERROR_VALUE")
 		}
 		return *triggerExpression.ErrorValue, nil
+	case "WARN_RECOVER_VALUE":
+		if triggerExpression.WarnRecoverValue == nil {
+			return nil, fmt.Errorf("no value with name WARN_RECOVER_VALUE")
+		}
+		return *triggerExpression.WarnRecoverValue, nil
+	case "ERROR_RECOVER_VALUE":
+		if triggerExpression.ErrorRecoverValue == nil {
+			return nil, fmt.Errorf("no value with name ERROR_RECOVER_VALUE")
+		}
+		return *triggerExpression.ErrorRecoverValue, nil
 	case "t1":
 		return triggerExpression.MainTargetValue, nil
 	case "PREV_STATE":
 		return triggerExpression.PreviousState, nil
+	case "DEVIATION":
+		return triggerExpression.Deviation, nil
 	default:
 		value, ok := triggerExpression.AdditionalTargetsValues[name]
 		if !ok {
@@ -111,6 +134,9 @@ func getSimpleExpression(triggerExpression *TriggerExpression) (*govaluate.Evalu
 	case "":
 		return nil, fmt.Errorf("trigger_type is not set")
 	case moira.FallingTrigger:
+		if triggerExpression.hasRecoverValues() {
+			return getUserExpression(getRecoverExpression(triggerExpression))
+		}
 		if triggerExpression.ErrorValue != nil && triggerExpression.WarnValue != nil {
 			return exprWarnErrorFalling, nil
 		} else if triggerExpression.ErrorValue != nil {
@@ -119,6 +145,9 @@ func getSimpleExpression(triggerExpression *TriggerExpression) (*govaluate.Evalu
 			return exprWarnFalling, nil
 		}
 	case moira.RisingTrigger:
+		if triggerExpression.hasRecoverValues() {
+			return getUserExpression(getRecoverExpression(triggerExpression))
+		}
 		if triggerExpression.ErrorValue != nil && triggerExpression.WarnValue != nil {
 			return exprWarnErrorRising, nil
 		} else if triggerExpression.ErrorValue != nil {
@@ -126,11 +155,49 @@ func getSimpleExpression(triggerExpression *TriggerExpression) (*govaluate.Evalu
 		} else {
 			return exprWarnRising, nil
 		}
+	case moira.AnomalyTrigger:
+		if triggerExpression.ErrorValue != nil && triggerExpression.WarnValue != nil {
+			return exprWarnErrorAnomaly, nil
+		} else if triggerExpression.ErrorValue != nil {
+			return exprErrAnomaly, nil
+		} else {
+			return exprWarnAnomaly, nil
+		}
 	}
 	return nil, fmt.Errorf("wrong set of parametres: warn_value - %v, error_value - %v, trigger_type: %v",
 		triggerExpression.WarnValue, triggerExpression.ErrorValue, triggerExpression.TriggerType)
 }
 
+func (triggerExpression *TriggerExpression) hasRecoverValues() bool {
+	return triggerExpression.WarnRecoverValue != nil || triggerExpression.ErrorRecoverValue != nil
+}
+
+// getRecoverExpression returns expression of rising or falling trigger with recover values.
+// Metric enters WARN or ERROR state when it crosses threshold, but leaves it only when it crosses recover value back,
+// e.g. rising trigger: "(t1 >= ERROR_VALUE) ? ERROR : ((t1 >= WARN_VALUE || ((PREV_STATE == WARN || PREV_STATE == ERROR) && t1 > WARN_RECOVER_VALUE)) ? WARN : OK)"
+func getRecoverExpression(triggerExpression *TriggerExpression) string {
+	thresholdOperator, recoverOperator := ">=", ">"
+	if triggerExpression.TriggerType == moira.FallingTrigger {
+		thresholdOperator, recoverOperator = "<=", "<"
+	}
+	expression := "OK"
+	if triggerExpression.WarnValue != nil {
+		condition := fmt.Sprintf("t1 %s WARN_VALUE", thresholdOperator)
+		if triggerExpression.WarnRecoverValue != nil {
+			condition = fmt.Sprintf("%s || ((PREV_STATE == WARN || PREV_STATE == ERROR) && t1 %s WARN_RECOVER_VALUE)", condition, recoverOperator)
+		}
+		expression = fmt.Sprintf("(%s) ? WARN : %s", condition, expression)
+	}
+	if triggerExpression.ErrorValue != nil {
+		condition := fmt.Sprintf("t1 %s ERROR_VALUE", thresholdOperator)
+		if triggerExpression.ErrorRecoverValue != nil {
+			condition = fmt.Sprintf("%s || (PREV_STATE == ERROR && t1 %s ERROR_RECOVER_VALUE)", condition, recoverOperator)
+		}
+		expression = fmt.Sprintf("(%s) ? ERROR : (%s)", condition, expression)
+	}
+	return expression
+}
+
 func getUserExpression(triggerExpression string) (*govaluate.EvaluableExpression, error) {
 	err := evaluateAndCacheExpressionIfNeed(triggerExpression)
 	if err != nil {
@@ -71,6 +71,74 @@ func TestExpression(t *testing.T) {
 		So(result, ShouldResemble, "OK")
 	})
 
+	Convey("Test Anomaly", t, func() {
+		warnValue := 2.0
+		errorValue := 3.0
+		result, err := (&TriggerExpression{MainTargetValue: 1000.0, Deviation: 1.5, WarnValue: &warnValue, ErrorValue: &errorValue, TriggerType: moira.AnomalyTrigger}).Evaluate()
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "OK")
+
+		result, err = (&TriggerExpression{MainTargetValue: 1000.0, Deviation: 2.0, WarnValue: &warnValue, ErrorValue: &errorValue, TriggerType: moira.AnomalyTrigger}).Evaluate()
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "WARN")
+
+		result, err = (&TriggerExpression{MainTargetValue: 1000.0, Deviation: 3.5, WarnValue: &warnValue, ErrorValue: &errorValue, TriggerType: moira.AnomalyTrigger}).Evaluate()
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "ERROR")
+
+		result, err = (&TriggerExpression{MainTargetValue: 1000.0, Deviation: 3.5, WarnValue: &warnValue, TriggerType: moira.AnomalyTrigger}).Evaluate()
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "WARN")
+
+		result, err = (&TriggerExpression{MainTargetValue: 1000.0, Deviation: 2.5, ErrorValue: &errorValue, TriggerType: moira.AnomalyTrigger}).Evaluate()
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "OK")
+	})
+
+	Convey("Test Recover Values", t, func() {
+		warnValue := 60.0
+		errorValue := 90.0
+		warnRecoverValue := 50.0
+		errorRecoverValue := 80.0
+		rising := func(value float64, prevState string) (string, error) {
+			return (&TriggerExpression{MainTargetValue: value, PreviousState: prevState, WarnValue: &warnValue, ErrorValue: &errorValue,
+				WarnRecoverValue: &warnRecoverValue, ErrorRecoverValue: &errorRecoverValue, TriggerType: moira.RisingTrigger}).Evaluate()
+		}
+		result, err := rising(55.0, "OK")
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "OK")
+
+		result, err = rising(55.0, "WARN")
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "WARN")
+
+		result, err = rising(50.0, "WARN")
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "OK")
+
+		result, err = rising(85.0, "ERROR")
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "ERROR")
+
+		result, err = rising(75.0, "ERROR")
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "WARN")
+
+		result, err = rising(85.0, "WARN")
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "WARN")
+
+		warnValue = 30.0
+		warnRecoverValue = 40.0
+		result, err = (&TriggerExpression{MainTargetValue: 35.0, PreviousState: "WARN", WarnValue: &warnValue, WarnRecoverValue: &warnRecoverValue, TriggerType: moira.FallingTrigger}).Evaluate()
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "WARN")
+
+		result, err = (&TriggerExpression{MainTargetValue: 35.0, PreviousState: "NODATA", WarnValue: &warnValue, WarnRecoverValue: &warnRecoverValue, TriggerType: moira.FallingTrigger}).Evaluate()
+		So(err, ShouldBeNil)
+		So(result, ShouldResemble, "OK")
+	})
+
 	Convey("Test Custom", t, func() {
 		expression := "t1 > 10 && t2 > 3 ? ERROR : OK"
 		result, err := (&TriggerExpression{Expression: &expression, MainTargetValue: 11.0, AdditionalTargetsValues: map[string]float64{"t2": 4.0}, TriggerType: moira.ExpressionTrigger}).Evaluate()
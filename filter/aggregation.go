@@ -0,0 +1,139 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// AggregationMethod is a method of merging values of points falling into the same retention slot
+type AggregationMethod string
+
+// Aggregation methods, names are the same as in graphite storage-aggregation.conf
+const (
+	// AggregationLast keeps the last received value
+	AggregationLast AggregationMethod = "last"
+	// AggregationAverage calculates average of values
+	AggregationAverage AggregationMethod = "average"
+	// AggregationSum calculates sum of values
+	AggregationSum AggregationMethod = "sum"
+	// AggregationMin keeps min value
+	AggregationMin AggregationMethod = "min"
+	// AggregationMax keeps max value
+	AggregationMax AggregationMethod = "max"
+	// AggregationCount counts received points
+	AggregationCount AggregationMethod = "count"
+)
+
+type aggregationMatcher struct {
+	pattern      *regexp.Regexp
+	method       AggregationMethod
+	xFilesFactor float64
+}
+
+// Defaults of graphite for rules without aggregationMethod or xFilesFactor
+const (
+	defaultAggregationMethod = AggregationAverage
+	defaultXFilesFactor      = 0.5
+)
+
+// buildAggregations parses aggregations config in format of graphite storage-aggregation.conf.
+// Every "[name]" section is a rule with "pattern", "aggregationMethod" and "xFilesFactor" keys in any order,
+// missing method and xFilesFactor have graphite defaults. In file without sections every "pattern" line following
+// "aggregationMethod" one starts new rule. xFilesFactor is validated only, as single points are aggregated
+func (storage *Storage) buildAggregations(aggregationScanner *bufio.Scanner) error {
+	storage.aggregations = make([]aggregationMatcher, 0)
+	var current *aggregationMatcher
+	hasMethod := false
+	addCurrent := func() error {
+		if current == nil {
+			return nil
+		}
+		if current.pattern == nil {
+			return fmt.Errorf("aggregation with method '%s' has no pattern", current.method)
+		}
+		storage.aggregations = append(storage.aggregations, *current)
+		current = nil
+		return nil
+	}
+	startRule := func() {
+		current = &aggregationMatcher{method: defaultAggregationMethod, xFilesFactor: defaultXFilesFactor}
+		hasMethod = false
+	}
+
+	for aggregationScanner.Scan() {
+		line := strings.TrimSpace(aggregationScanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			if err := addCurrent(); err != nil {
+				return err
+			}
+			startRule()
+			continue
+		}
+		if strings.HasPrefix(line, "#") || strings.Count(line, "=") != 1 {
+			continue
+		}
+		splitted := strings.Split(line, "=")
+		key, value := strings.TrimSpace(splitted[0]), strings.TrimSpace(splitted[1])
+		if current == nil {
+			startRule()
+		}
+
+		switch key {
+		case "pattern":
+			if current.pattern != nil {
+				if !hasMethod {
+					return fmt.Errorf("aggregation of pattern '%s' has another pattern '%s'", current.pattern.String(), value)
+				}
+				if err := addCurrent(); err != nil {
+					return err
+				}
+				startRule()
+			}
+			pattern, err := regexp.Compile(value)
+			if err != nil {
+				return err
+			}
+			current.pattern = pattern
+		case "aggregationMethod":
+			method, err := parseAggregationMethod(value)
+			if err != nil {
+				return err
+			}
+			current.method = method
+			hasMethod = true
+		case "xFilesFactor":
+			xFilesFactor, err := strconv.ParseFloat(value, 64)
+			if err != nil || xFilesFactor < 0 || xFilesFactor > 1 {
+				return fmt.Errorf("invalid xFilesFactor '%s', it should be a number from 0 to 1", value)
+			}
+			current.xFilesFactor = xFilesFactor
+		}
+	}
+	if err := addCurrent(); err != nil {
+		return err
+	}
+	return aggregationScanner.Err()
+}
+
+// getAggregationMethod returns method of first matched aggregation rule, values of other metrics are not aggregated
+func (storage *Storage) getAggregationMethod(metric string) AggregationMethod {
+	for _, matcher := range storage.aggregations {
+		if matcher.pattern.MatchString(metric) {
+			return matcher.method
+		}
+	}
+	return AggregationLast
+}
+
+func parseAggregationMethod(method string) (AggregationMethod, error) {
+	switch AggregationMethod(method) {
+	case AggregationLast, AggregationAverage, AggregationSum, AggregationMin, AggregationMax, AggregationCount:
+		return AggregationMethod(method), nil
+	case "avg":
+		return AggregationAverage, nil
+	}
+	return "", fmt.Errorf("unknown aggregation method '%s'", method)
+}
@@ -0,0 +1,134 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+)
+
+var testAggregations = `
+	# comment
+	[min]
+	pattern = \.min$
+	xFilesFactor = 0.1
+	aggregationMethod = min
+
+	[count]
+	pattern = \.count$
+	aggregationMethod = count
+
+	[sum]
+	pattern = \.sum$
+	aggregationMethod = sum
+
+	[avg]
+	pattern = \.avg$
+	aggregationMethod = avg
+
+	[default_last]
+	pattern = .*
+	xFilesFactor = 0.5
+	aggregationMethod = last
+	`
+
+func TestAggregations(t *testing.T) {
+	metrics2 := metrics.ConfigureFilterMetrics("test")
+	retentions := `
+	[default]
+	pattern = .*
+	retentions = 60s:2d`
+
+	Convey("Given valid aggregations config", t, func() {
+		storage, err := NewCacheStorage(nil, metrics2, strings.NewReader(retentions), strings.NewReader(testAggregations), TimestampWindow{}, CacheLimits{})
+		So(err, ShouldBeNil)
+		So(storage.aggregations, ShouldHaveLength, 5)
+		So(storage.getAggregationMethod("my.avg"), ShouldEqual, AggregationAverage)
+		So(storage.getAggregationMethod("my.max"), ShouldEqual, AggregationLast)
+
+		buffer := make(map[string]*moira.MatchedMetric)
+		enrich := func(metric string, value float64, timestamp int64) {
+			storage.EnrichMatchedMetric(buffer, &moira.MatchedMetric{Metric: metric, Value: value, Timestamp: timestamp})
+		}
+
+		Convey("Points of one retention slot should be merged into aggregate of the slot", func() {
+			enrich("my.sum", 1, 1200)
+			enrich("my.sum", 2, 1210)
+			enrich("my.sum", 3, 1190)
+			So(buffer, ShouldHaveLength, 1)
+			metric := buffer["my.sum 1200"]
+			So(metric.RetentionTimestamp, ShouldEqual, 1200)
+			So(metric.Timestamp, ShouldEqual, 1190)
+			So(metric.Aggregate, ShouldResemble, &moira.MetricAggregate{Method: "sum", Sum: 6, Min: 1, Max: 3, Count: 3})
+		})
+
+		Convey("Points of every retention slot should be aggregated separately, including late ones", func() {
+			enrich("my.avg", 1, 1200)
+			enrich("my.avg", 2, 1260)
+			enrich("my.avg", 3, 1200)
+			So(buffer, ShouldHaveLength, 2)
+			So(buffer["my.avg 1200"].Aggregate, ShouldResemble, &moira.MetricAggregate{Method: "average", Sum: 4, Min: 1, Max: 3, Count: 2})
+			So(buffer["my.avg 1260"].Aggregate, ShouldResemble, &moira.MetricAggregate{Method: "average", Sum: 2, Min: 2, Max: 2, Count: 1})
+		})
+
+		Convey("Aggregation should not depend on metrics cache, which may evict metrics", func() {
+			storage.metricsCache = newBoundedCache(1, 0, metrics2.MetricsCacheHits, metrics2.MetricsCacheMisses, metrics2.MetricsCacheEvictions)
+			enrich("my.count", 7, 1200)
+			enrich("other.metric", 1, 1200)
+			enrich("my.count", 7, 1210)
+			So(buffer["my.count 1200"].Aggregate.Count, ShouldEqual, 2)
+		})
+
+		Convey("Metrics with last aggregation should not be aggregated", func() {
+			enrich("my.max", 1, 1200)
+			So(buffer["my.max"].Value, ShouldEqual, 1)
+			So(buffer["my.max"].Aggregate, ShouldBeNil)
+			enrich("my.max", 0, 1210)
+			So(buffer["my.max"].Value, ShouldEqual, 0)
+		})
+	})
+
+	Convey("Given graphite aggregations config without aggregationMethod, should use graphite defaults", t, func() {
+		config := `
+		[max]
+		aggregationMethod = max
+		pattern = \.max$
+
+		[no_method]
+		pattern = \.requests$
+		xFilesFactor = 0
+
+		[default]
+		pattern = .*
+		`
+		storage, err := NewCacheStorage(nil, metrics2, strings.NewReader(retentions), strings.NewReader(config), TimestampWindow{}, CacheLimits{})
+		So(err, ShouldBeNil)
+		So(storage.aggregations, ShouldHaveLength, 3)
+		So(storage.aggregations[0].method, ShouldEqual, AggregationMax)
+		So(storage.aggregations[0].xFilesFactor, ShouldEqual, 0.5)
+		So(storage.aggregations[1].method, ShouldEqual, AggregationAverage)
+		So(storage.aggregations[1].xFilesFactor, ShouldEqual, 0)
+		So(storage.getAggregationMethod("my.max"), ShouldEqual, AggregationMax)
+		So(storage.getAggregationMethod("my.requests"), ShouldEqual, AggregationAverage)
+		So(storage.getAggregationMethod("my.other"), ShouldEqual, AggregationAverage)
+	})
+
+	Convey("Given invalid aggregations config, should return error", t, func() {
+		invalidConfigs := []string{
+			"pattern = (\naggregationMethod = sum",
+			"pattern = .*\naggregationMethod = median",
+			"pattern = .*\nxFilesFactor = 2",
+			"pattern = .*\nxFilesFactor = half",
+			"[no_pattern]\naggregationMethod = sum\n[all]\npattern = .*",
+			"pattern = .*\npattern = a\naggregationMethod = sum",
+			"aggregationMethod = sum",
+		}
+		for _, config := range invalidConfigs {
+			_, err := NewCacheStorage(nil, metrics2, strings.NewReader(retentions), strings.NewReader(config), TimestampWindow{}, CacheLimits{})
+			So(err, ShouldBeError)
+		}
+	})
+}
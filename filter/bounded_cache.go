@@ -0,0 +1,95 @@
+package filter
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/moira-alert/moira/metrics/graphite"
+)
+
+// boundedCache is a cache of limited size with expiring items.
+// Items are evicted in order of their last update, so the least recently updated item is evicted
+// when size limit is reached and items expire in the same order. It is not safe for concurrent use
+type boundedCache struct {
+	capacity  int
+	ttl       time.Duration
+	items     map[string]*list.Element
+	order     *list.List
+	hits      graphite.Counter
+	misses    graphite.Counter
+	evictions graphite.Counter
+}
+
+type boundedCacheItem struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// newBoundedCache creates new cache, zero capacity or ttl disables corresponding limit
+func newBoundedCache(capacity int, ttl time.Duration, hits, misses, evictions graphite.Counter) *boundedCache {
+	return &boundedCache{
+		capacity:  capacity,
+		ttl:       ttl,
+		items:     make(map[string]*list.Element),
+		order:     list.New(),
+		hits:      hits,
+		misses:    misses,
+		evictions: evictions,
+	}
+}
+
+// get returns value of not expired item
+func (cache *boundedCache) get(key string, now time.Time) (interface{}, bool) {
+	element, ok := cache.items[key]
+	if !ok {
+		cache.misses.Inc(1)
+		return nil, false
+	}
+	item := element.Value.(*boundedCacheItem)
+	if cache.isExpired(item, now) {
+		cache.remove(element)
+		cache.misses.Inc(1)
+		return nil, false
+	}
+	cache.hits.Inc(1)
+	return item.value, true
+}
+
+// set adds or updates item, expired items and items exceeding size limit are evicted
+func (cache *boundedCache) set(key string, value interface{}, now time.Time) {
+	if element, ok := cache.items[key]; ok {
+		item := element.Value.(*boundedCacheItem)
+		item.value = value
+		item.expiresAt = now.Add(cache.ttl)
+		cache.order.MoveToFront(element)
+	} else {
+		cache.items[key] = cache.order.PushFront(&boundedCacheItem{
+			key:       key,
+			value:     value,
+			expiresAt: now.Add(cache.ttl),
+		})
+	}
+
+	for oldest := cache.order.Back(); oldest != nil; oldest = cache.order.Back() {
+		if !cache.isExpired(oldest.Value.(*boundedCacheItem), now) && (cache.capacity <= 0 || cache.order.Len() <= cache.capacity) {
+			break
+		}
+		cache.remove(oldest)
+	}
+}
+
+// len returns number of items in cache including expired but not evicted yet
+func (cache *boundedCache) len() int {
+	return cache.order.Len()
+}
+
+func (cache *boundedCache) isExpired(item *boundedCacheItem, now time.Time) bool {
+	return cache.ttl > 0 && now.After(item.expiresAt)
+}
+
+func (cache *boundedCache) remove(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.items, element.Value.(*boundedCacheItem).key)
+	cache.evictions.Inc(1)
+}
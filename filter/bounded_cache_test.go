@@ -0,0 +1,66 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+)
+
+func TestBoundedCache(t *testing.T) {
+	filterMetrics := metrics.ConfigureFilterMetrics("test")
+	hits, misses, evictions := filterMetrics.MetricsCacheHits, filterMetrics.MetricsCacheMisses, filterMetrics.MetricsCacheEvictions
+	now := time.Unix(1234567890, 0)
+
+	Convey("Given cache with size limit, least recently updated items should be evicted", t, func() {
+		hits.Clear()
+		misses.Clear()
+		evictions.Clear()
+		cache := newBoundedCache(2, 0, hits, misses, evictions)
+		cache.set("a", 1, now)
+		cache.set("b", 2, now)
+		cache.set("a", 3, now)
+		cache.set("c", 4, now)
+		So(cache.len(), ShouldEqual, 2)
+
+		_, ok := cache.get("b", now)
+		So(ok, ShouldBeFalse)
+		value, ok := cache.get("a", now)
+		So(ok, ShouldBeTrue)
+		So(value, ShouldEqual, 3)
+		value, ok = cache.get("c", now.Add(time.Hour))
+		So(ok, ShouldBeTrue)
+		So(value, ShouldEqual, 4)
+
+		So(hits.Count(), ShouldEqual, 2)
+		So(misses.Count(), ShouldEqual, 1)
+		So(evictions.Count(), ShouldEqual, 1)
+	})
+
+	Convey("Given cache with ttl, expired items should be evicted", t, func() {
+		hits.Clear()
+		misses.Clear()
+		evictions.Clear()
+		cache := newBoundedCache(0, time.Minute, hits, misses, evictions)
+		cache.set("a", 1, now)
+		cache.set("b", 2, now.Add(30*time.Second))
+
+		value, ok := cache.get("a", now.Add(time.Minute))
+		So(ok, ShouldBeTrue)
+		So(value, ShouldEqual, 1)
+		_, ok = cache.get("a", now.Add(61*time.Second))
+		So(ok, ShouldBeFalse)
+		So(cache.len(), ShouldEqual, 1)
+
+		cache.set("c", 3, now.Add(2*time.Minute))
+		So(cache.len(), ShouldEqual, 1)
+		_, ok = cache.get("b", now.Add(2*time.Minute))
+		So(ok, ShouldBeFalse)
+
+		So(hits.Count(), ShouldEqual, 1)
+		So(misses.Count(), ShouldEqual, 2)
+		So(evictions.Count(), ShouldEqual, 2)
+	})
+}
@@ -2,40 +2,88 @@ package filter
 
 import (
 	"bufio"
+	"fmt"
 	"github.com/moira-alert/moira"
 	"github.com/moira-alert/moira/metrics/graphite"
 	"io"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var defaultRetention = 60
 
+// TimestampPolicy is an action applied to metric with timestamp outside of timestamp sanity window
+type TimestampPolicy string
+
+// Policies of metrics with timestamp outside of sanity window, such metrics are counted whatever policy is
+const (
+	// TimestampDrop drops metric
+	TimestampDrop TimestampPolicy = "drop"
+	// TimestampClamp replaces metric timestamp with current time
+	TimestampClamp TimestampPolicy = "clamp"
+	// TimestampCount only counts metric and handles it as usual
+	TimestampCount TimestampPolicy = "count"
+)
+
+// TimestampWindow is a sanity window of metric timestamps relative to current time
+type TimestampWindow struct {
+	// Past is a max age of metric timestamp, zero disables the check
+	Past time.Duration
+	// Future is a max distance of metric timestamp in the future, zero disables the check
+	Future time.Duration
+	// Policy is applied to metrics matched retentions without own timestamp policy
+	Policy TimestampPolicy
+}
+
 type retentionMatcher struct {
-	pattern   *regexp.Regexp
-	retention int
+	pattern         *regexp.Regexp
+	retention       int
+	timestampPolicy TimestampPolicy
 }
 
 type retentionCacheItem struct {
-	value     int
-	timestamp int64
+	value             int
+	timestampPolicy   TimestampPolicy
+	aggregationMethod AggregationMethod
+	timestamp         int64
 }
 
 // Storage struct to store retention matchers
 type Storage struct {
 	metrics         *graphite.FilterMetrics
 	retentions      []retentionMatcher
-	retentionsCache map[string]*retentionCacheItem
-	metricsCache    map[string]*moira.MatchedMetric
+	aggregations    []aggregationMatcher
+	retentionsCache *boundedCache
+	metricsCache    *boundedCache
+	timestampWindow TimestampWindow
 	logger          moira.Logger
 }
 
-// NewCacheStorage create new Storage
-func NewCacheStorage(logger moira.Logger, metrics *graphite.FilterMetrics, reader io.Reader) (*Storage, error) {
+// CacheLimits are limits of metrics and retentions caches of Storage, zero size or ttl disables corresponding limit
+type CacheLimits struct {
+	MetricsCacheSize    int
+	MetricsCacheTTL     time.Duration
+	RetentionsCacheSize int
+	RetentionsCacheTTL  time.Duration
+}
+
+// NewCacheStorage create new Storage, aggregationReader is optional storage-aggregation.conf,
+// values of points falling into the same retention slot are merged using aggregation method of the first matched rule
+func NewCacheStorage(logger moira.Logger, metrics *graphite.FilterMetrics, reader io.Reader, aggregationReader io.Reader, timestampWindow TimestampWindow, cacheLimits CacheLimits) (*Storage, error) {
+	if timestampWindow.Policy == "" {
+		timestampWindow.Policy = TimestampDrop
+	}
+	if err := timestampWindow.Policy.validate(); err != nil {
+		return nil, err
+	}
 	storage := &Storage{
-		retentionsCache: make(map[string]*retentionCacheItem),
-		metricsCache:    make(map[string]*moira.MatchedMetric),
+		retentionsCache: newBoundedCache(cacheLimits.RetentionsCacheSize, cacheLimits.RetentionsCacheTTL,
+			metrics.RetentionsCacheHits, metrics.RetentionsCacheMisses, metrics.RetentionsCacheEvictions),
+		metricsCache: newBoundedCache(cacheLimits.MetricsCacheSize, cacheLimits.MetricsCacheTTL,
+			metrics.MetricsCacheHits, metrics.MetricsCacheMisses, metrics.MetricsCacheEvictions),
+		timestampWindow: timestampWindow,
 		metrics:         metrics,
 		logger:          logger,
 	}
@@ -43,75 +91,169 @@ func NewCacheStorage(logger moira.Logger, metrics *graphite.FilterMetrics, reade
 	if err := storage.buildRetentions(bufio.NewScanner(reader)); err != nil {
 		return nil, err
 	}
+	if aggregationReader != nil {
+		if err := storage.buildAggregations(bufio.NewScanner(aggregationReader)); err != nil {
+			return nil, err
+		}
+	}
 	return storage, nil
 }
 
-// EnrichMatchedMetric calculate retention and filter cached values
+// EnrichMatchedMetric calculate retention and filter cached values,
+// metric with timestamp outside of sanity window is handled according to timestamp policy of its retention.
+// Points of aggregated metric are merged into aggregate of their retention slot, which is merged with saved one on saving,
+// so every slot of the metric has its own buffer item
 func (storage *Storage) EnrichMatchedMetric(buffer map[string]*moira.MatchedMetric, m *moira.MatchedMetric) {
-	m.Retention = storage.getRetention(m)
+	now := time.Now()
+	retention := storage.getRetention(m, now)
+	if !storage.checkTimestamp(m, retention.timestampPolicy, now.Unix()) {
+		return
+	}
+	m.Retention = retention.value
 	m.RetentionTimestamp = roundToNearestRetention(m.Timestamp, int64(m.Retention))
-	if ex, ok := storage.metricsCache[m.Metric]; ok && ex.RetentionTimestamp == m.RetentionTimestamp && ex.Value == m.Value {
+
+	if retention.aggregationMethod != AggregationLast {
+		key := fmt.Sprintf("%s %d", m.Metric, m.RetentionTimestamp)
+		if buffered, ok := buffer[key]; ok {
+			buffered.Aggregate.Add(m.Value)
+			buffered.Value = m.Value
+			buffered.Timestamp = m.Timestamp
+			return
+		}
+		m.Aggregate = &moira.MetricAggregate{Method: string(retention.aggregationMethod)}
+		m.Aggregate.Add(m.Value)
+		buffer[key] = m
 		return
 	}
-	storage.metricsCache[m.Metric] = m
+	if cached, ok := storage.metricsCache.get(m.Metric, now); ok {
+		if ex := cached.(*moira.MatchedMetric); ex.RetentionTimestamp == m.RetentionTimestamp && ex.Value == m.Value {
+			return
+		}
+	}
+	storage.metricsCache.set(m.Metric, m, now)
 	buffer[m.Metric] = m
 }
 
-// getRetention returns first matched retention for metric
-func (storage *Storage) getRetention(m *moira.MatchedMetric) int {
-	if item, ok := storage.retentionsCache[m.Metric]; ok && item.timestamp+60 > m.Timestamp {
-		return item.value
+// getRetention returns first matched retention with its timestamp policy and aggregation method for metric
+func (storage *Storage) getRetention(m *moira.MatchedMetric, now time.Time) *retentionCacheItem {
+	if cached, ok := storage.retentionsCache.get(m.Metric, now); ok {
+		if item := cached.(*retentionCacheItem); item.timestamp+60 > m.Timestamp {
+			return item
+		}
+	}
+	item, matched := storage.matchRetention(m.Metric)
+	if matched {
+		item.timestamp = m.Timestamp
+		storage.retentionsCache.set(m.Metric, item, now)
 	}
+	return item
+}
+
+// matchRetention returns first matched retention of metric without using cache, default retention is returned if none is matched
+func (storage *Storage) matchRetention(metric string) (*retentionCacheItem, bool) {
 	for _, matcher := range storage.retentions {
-		if matcher.pattern.MatchString(m.Metric) {
-			storage.retentionsCache[m.Metric] = &retentionCacheItem{
-				value:     matcher.retention,
-				timestamp: m.Timestamp,
+		if matcher.pattern.MatchString(metric) {
+			timestampPolicy := matcher.timestampPolicy
+			if timestampPolicy == "" {
+				timestampPolicy = storage.timestampWindow.Policy
 			}
-			return matcher.retention
+			return &retentionCacheItem{
+				value:             matcher.retention,
+				timestampPolicy:   timestampPolicy,
+				aggregationMethod: storage.getAggregationMethod(metric),
+			}, true
 		}
 	}
-	return defaultRetention
+	return &retentionCacheItem{
+		value:             defaultRetention,
+		timestampPolicy:   storage.timestampWindow.Policy,
+		aggregationMethod: storage.getAggregationMethod(metric),
+	}, false
 }
 
+// checkTimestamp applies timestamp policy to metric if its timestamp is outside of sanity window,
+// returns false if metric should be dropped
+func (storage *Storage) checkTimestamp(m *moira.MatchedMetric, timestampPolicy TimestampPolicy, now int64) bool {
+	window := storage.timestampWindow
+	tooOld := window.Past > 0 && m.Timestamp < now-int64(window.Past.Seconds())
+	tooNew := window.Future > 0 && m.Timestamp > now+int64(window.Future.Seconds())
+	if !tooOld && !tooNew {
+		return true
+	}
+	storage.metrics.OutOfWindowMetricsReceived.Inc(1)
+	switch timestampPolicy {
+	case TimestampDrop:
+		return false
+	case TimestampClamp:
+		m.Timestamp = now
+	}
+	return true
+}
+
+// buildRetentions parses retentions config, every "pattern" line starts new retention,
+// next "retentions" and optional "timestamp_policy" lines belong to it
 func (storage *Storage) buildRetentions(retentionScanner *bufio.Scanner) error {
 	storage.retentions = make([]retentionMatcher, 0, 100)
+	var patternString string
+	var current *retentionMatcher
 
 	for retentionScanner.Scan() {
-		line1 := retentionScanner.Text()
-		if strings.HasPrefix(line1, "#") || strings.Count(line1, "=") != 1 {
+		line := retentionScanner.Text()
+		if strings.HasPrefix(line, "#") || strings.Count(line, "=") != 1 {
 			continue
 		}
+		splitted := strings.Split(line, "=")
+		key, value := strings.TrimSpace(splitted[0]), strings.TrimSpace(splitted[1])
 
-		patternString := strings.TrimSpace(strings.Split(line1, "=")[1])
-		pattern, err := regexp.Compile(patternString)
-		if err != nil {
-			return err
-		}
-
-		retentionScanner.Scan()
-		line2 := retentionScanner.Text()
-		splitted := strings.Split(line2, "=")
-
-		if len(splitted) < 2 {
-			storage.logger.Errorf("Invalid pattern found: '%s'", patternString)
-			continue
-		}
-
-		retentions := strings.TrimSpace(splitted[1])
-		retention, err := rawRetentionToSeconds(retentions[0:strings.Index(retentions, ":")])
-		if err != nil {
-			return err
+		switch key {
+		case "pattern":
+			if current != nil {
+				storage.logger.Errorf("Invalid pattern found: '%s'", patternString)
+			}
+			pattern, err := regexp.Compile(value)
+			if err != nil {
+				return err
+			}
+			patternString = value
+			current = &retentionMatcher{pattern: pattern}
+		case "retentions":
+			if current == nil {
+				continue
+			}
+			retention, err := rawRetentionToSeconds(value[0:strings.Index(value, ":")])
+			if err != nil {
+				return err
+			}
+			current.retention = retention
+			storage.retentions = append(storage.retentions, *current)
+			current = nil
+		case "timestamp_policy":
+			timestampPolicy := TimestampPolicy(value)
+			if err := timestampPolicy.validate(); err != nil {
+				return err
+			}
+			switch {
+			case current != nil:
+				current.timestampPolicy = timestampPolicy
+			case len(storage.retentions) > 0:
+				storage.retentions[len(storage.retentions)-1].timestampPolicy = timestampPolicy
+			}
 		}
-
-		storage.retentions = append(storage.retentions, retentionMatcher{
-			pattern:   pattern,
-			retention: retention,
-		})
+	}
+	if current != nil {
+		storage.logger.Errorf("Invalid pattern found: '%s'", patternString)
 	}
 	return retentionScanner.Err()
 }
 
+func (timestampPolicy TimestampPolicy) validate() error {
+	switch timestampPolicy {
+	case TimestampDrop, TimestampClamp, TimestampCount:
+		return nil
+	}
+	return fmt.Errorf("unknown timestamp policy '%s'", timestampPolicy)
+}
+
 func rawRetentionToSeconds(rawRetention string) (int, error) {
 	retention, err := strconv.Atoi(rawRetention)
 	if err == nil {
@@ -7,6 +7,7 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 	"strings"
 	"testing"
+	"time"
 )
 
 var testRetentions = `
@@ -167,7 +168,7 @@ var matchedMetrics = []moira.MatchedMetric{
 
 func TestCacheStorage(t *testing.T) {
 	metrics2 := metrics.ConfigureFilterMetrics("test")
-	storage, err := NewCacheStorage(nil, metrics2, strings.NewReader(testRetentions))
+	storage, err := NewCacheStorage(nil, metrics2, strings.NewReader(testRetentions), nil, TimestampWindow{}, CacheLimits{})
 
 	Convey("Test good retentions", t, func() {
 		So(err, ShouldBeEmpty)
@@ -185,7 +186,7 @@ func TestCacheStorage(t *testing.T) {
 		So(len(buffer), ShouldEqual, len(matchedMetrics))
 	})
 
-	storage, _ = NewCacheStorage(nil, metrics2, strings.NewReader(testRetentions))
+	storage, _ = NewCacheStorage(nil, metrics2, strings.NewReader(testRetentions), nil, TimestampWindow{}, CacheLimits{})
 
 	Convey("Test add one metric twice, should buffer len is 1", t, func() {
 		buffer := make(map[string]*moira.MatchedMetric)
@@ -198,7 +199,7 @@ func TestCacheStorage(t *testing.T) {
 
 func TestRetentions(t *testing.T) {
 	metrics2 := metrics.ConfigureFilterMetrics("test")
-	storage, _ := NewCacheStorage(nil, metrics2, strings.NewReader(testRetentions))
+	storage, _ := NewCacheStorage(nil, metrics2, strings.NewReader(testRetentions), nil, TimestampWindow{}, CacheLimits{})
 
 	Convey("Simple metric, should 60sec", t, func() {
 		buffer := make(map[string]*moira.MatchedMetric)
@@ -230,3 +231,72 @@ func TestRetentions(t *testing.T) {
 		So(metr.RetentionTimestamp, should.Equal, 120)
 	})
 }
+
+func TestTimestampWindow(t *testing.T) {
+	metrics2 := metrics.ConfigureFilterMetrics("test")
+	retentions := `
+	[clamped]
+	pattern = ^Clamped\.
+	retentions = 60s:2d
+	timestamp_policy = clamp
+
+	[counted]
+	pattern = ^Counted\.
+	timestamp_policy = count
+	retentions = 60s:2d
+
+	[default]
+	pattern = .*
+	retentions = 60s:2d
+	`
+	window := TimestampWindow{Past: time.Hour, Future: 10 * time.Minute}
+	storage, err := NewCacheStorage(nil, metrics2, strings.NewReader(retentions), nil, window, CacheLimits{})
+	now := time.Now().Unix()
+
+	Convey("Test retentions with timestamp policy", t, func() {
+		So(err, ShouldBeNil)
+		So(storage.timestampWindow.Policy, ShouldEqual, TimestampDrop)
+		So(storage.retentions, ShouldHaveLength, 3)
+		So(storage.retentions[0].timestampPolicy, ShouldEqual, TimestampClamp)
+		So(storage.retentions[1].timestampPolicy, ShouldEqual, TimestampCount)
+		So(storage.retentions[2].timestampPolicy, ShouldEqual, "")
+	})
+
+	Convey("Metrics inside of window should be handled as usual", t, func() {
+		buffer := make(map[string]*moira.MatchedMetric)
+		for _, timestamp := range []int64{now - 3500, now, now + 500} {
+			metric := &moira.MatchedMetric{Metric: "Default.metric", Timestamp: timestamp}
+			storage.EnrichMatchedMetric(buffer, metric)
+			So(buffer["Default.metric"], ShouldEqual, metric)
+			So(metric.Timestamp, ShouldEqual, timestamp)
+		}
+		So(metrics2.OutOfWindowMetricsReceived.Count(), ShouldEqual, 0)
+	})
+
+	Convey("Metrics outside of window should be handled according to timestamp policy", t, func() {
+		for _, timestamp := range []int64{now - 3700, now + 700} {
+			buffer := make(map[string]*moira.MatchedMetric)
+			storage.EnrichMatchedMetric(buffer, &moira.MatchedMetric{Metric: "Default.metric", Timestamp: timestamp})
+			So(buffer, ShouldBeEmpty)
+
+			clamped := &moira.MatchedMetric{Metric: "Clamped.metric", Value: float64(timestamp), Timestamp: timestamp}
+			storage.EnrichMatchedMetric(buffer, clamped)
+			So(buffer["Clamped.metric"], ShouldEqual, clamped)
+			So(clamped.Timestamp, ShouldBeGreaterThanOrEqualTo, now)
+			So(clamped.Timestamp, ShouldBeLessThanOrEqualTo, time.Now().Unix())
+
+			counted := &moira.MatchedMetric{Metric: "Counted.metric", Timestamp: timestamp}
+			storage.EnrichMatchedMetric(buffer, counted)
+			So(buffer["Counted.metric"], ShouldEqual, counted)
+			So(counted.Timestamp, ShouldEqual, timestamp)
+		}
+		So(metrics2.OutOfWindowMetricsReceived.Count(), ShouldEqual, 6)
+	})
+
+	Convey("Unknown timestamp policy should return error", t, func() {
+		_, err := NewCacheStorage(nil, metrics2, strings.NewReader(retentions), nil, TimestampWindow{Policy: "skip"}, CacheLimits{})
+		So(err, ShouldBeError)
+		_, err = NewCacheStorage(nil, metrics2, strings.NewReader("pattern = .*\ntimestamp_policy = skip\nretentions = 60s:2d"), nil, window, CacheLimits{})
+		So(err, ShouldBeError)
+	})
+}
@@ -2,7 +2,15 @@ package filter
 
 // Config is filter configuration settings
 type Config struct {
-	Enabled         bool
-	Listen          string
-	RetentionConfig string
+	Enabled          bool
+	Listen           string
+	ListenUDP        string
+	MaxUDPPacketSize int
+	ListenPickle     string
+	ListenPrometheus string
+	ListenInfluxTCP  string
+	ListenInfluxUDP  string
+	ListenInfluxHTTP string
+	InfluxTemplate   string
+	RetentionConfig  string
 }
@@ -2,18 +2,28 @@ package connection
 
 import (
 	"bufio"
+	"crypto/tls"
+	"encoding/binary"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite"
 )
 
+// maxPickleMessageSize is the same limit of a single pickle message as carbon has
+const maxPickleMessageSize = 1048576
+
 // Handler handling connection data and shift it to lineChan channel
 type Handler struct {
 	logger    moira.Logger
 	wg        sync.WaitGroup
 	terminate chan bool
+	stats     *ConnectionsStats
+	limits    ConnectionLimits
 }
 
 // NewConnectionsHandler creates new Handler
@@ -24,17 +34,49 @@ func NewConnectionsHandler(logger moira.Logger) *Handler {
 	}
 }
 
+// newPlaintextHandler creates Handler of graphite plaintext connections, it keeps their stats if stats is not nil
+// and limits rate of lines read from every connection
+func newPlaintextHandler(logger moira.Logger, limits ConnectionLimits, stats *ConnectionsStats) (*Handler, error) {
+	if err := limits.validate(); err != nil {
+		return nil, err
+	}
+	handler := NewConnectionsHandler(logger)
+	handler.limits = limits
+	handler.stats = stats
+	return handler, nil
+}
+
 // HandleConnection convert every line from connection to metric and send it to lineChan channel
 func (handler *Handler) HandleConnection(connection net.Conn, lineChan chan<- []byte) {
 	handler.wg.Add(1)
 	go func() {
 		defer handler.wg.Done()
-		handler.handle(connection, lineChan)
+		handler.handle(connection, lineChan, "", nil)
+	}()
+}
+
+// HandleTLSConnection handles connection in the same way as plaintext one after successful handshake,
+// handshake returns name of client and meter of lines received from it
+func (handler *Handler) HandleTLSConnection(connection *tls.Conn, lineChan chan<- []byte, handshake func(*tls.Conn) (string, graphite.Meter, error)) {
+	handler.wg.Add(1)
+	go func() {
+		defer handler.wg.Done()
+		client, receivedLines, err := handshake(connection)
+		if err != nil {
+			handler.logger.Infof("%s", err.Error())
+			connection.Close()
+			return
+		}
+		handler.handle(connection, lineChan, client, receivedLines)
 	}()
 }
 
-func (handler *Handler) handle(connection net.Conn, lineChan chan<- []byte) {
+// handle reads lines from connection, receivedLines counts them if it is not nil
+func (handler *Handler) handle(connection net.Conn, lineChan chan<- []byte, client string, receivedLines graphite.Meter) {
 	buffer := bufio.NewReader(connection)
+	stats := handler.stats.add(connection.RemoteAddr().String(), client)
+	defer handler.stats.remove(stats)
+	limiter := newRateLimiter(handler.limits)
 
 	go func(conn net.Conn) {
 		<-handler.terminate
@@ -50,8 +92,84 @@ func (handler *Handler) handle(connection net.Conn, lineChan chan<- []byte) {
 			}
 			break
 		}
+		atomic.AddInt64(&stats.bytes, int64(len(lineBytes)))
+		atomic.AddInt64(&stats.lines, 1)
 		lineBytes = lineBytes[:len(lineBytes)-1]
-		lineChan <- lineBytes
+		if handler.stats != nil && !isValidPlaintextLine(lineBytes) {
+			atomic.AddInt64(&stats.parseErrors, 1)
+		}
+		if limiter != nil {
+			if wait := limiter.take(time.Now()); wait > 0 {
+				if handler.limits.Policy == RateLimitDrop {
+					atomic.AddInt64(&stats.droppedLines, 1)
+					continue
+				}
+				time.Sleep(wait)
+				atomic.AddInt64(&stats.stalled, int64(wait))
+				limiter.take(time.Now())
+			}
+		}
+		if receivedLines != nil {
+			receivedLines.Mark(1)
+		}
+		select {
+		case lineChan <- lineBytes:
+		default:
+			// Channel is full, time of waiting shows how much this client is slowed down by matching
+			blockedSince := time.Now()
+			lineChan <- lineBytes
+			atomic.AddInt64(&stats.blocked, int64(time.Since(blockedSince)))
+		}
+	}
+}
+
+// HandlePickleConnection decodes every pickle message from connection and sends its datapoints
+// to lineChan channel as plaintext lines
+func (handler *Handler) HandlePickleConnection(connection net.Conn, lineChan chan<- []byte, metrics *graphite.FilterMetrics) {
+	handler.wg.Add(1)
+	go func() {
+		defer handler.wg.Done()
+		handler.handlePickle(connection, lineChan, metrics)
+	}()
+}
+
+func (handler *Handler) handlePickle(connection net.Conn, lineChan chan<- []byte, metrics *graphite.FilterMetrics) {
+	buffer := bufio.NewReader(connection)
+
+	go func(conn net.Conn) {
+		<-handler.terminate
+		conn.Close()
+	}(connection)
+
+	defer connection.Close()
+	for {
+		var messageSize uint32
+		if err := binary.Read(buffer, binary.BigEndian, &messageSize); err != nil {
+			if err != io.EOF {
+				handler.logger.Errorf("read failed: %s", err)
+			}
+			return
+		}
+		if messageSize > maxPickleMessageSize {
+			metrics.PickleMessagesMalformed.Inc(1)
+			handler.logger.Errorf("pickle message from %s is too big: %d bytes", connection.RemoteAddr(), messageSize)
+			return
+		}
+		message := make([]byte, messageSize)
+		if _, err := io.ReadFull(buffer, message); err != nil {
+			handler.logger.Errorf("read failed: %s", err)
+			return
+		}
+		metrics.PickleMessagesReceived.Inc(1)
+		pickleMetrics, err := unpickleMetrics(message)
+		if err != nil {
+			metrics.PickleMessagesMalformed.Inc(1)
+			handler.logger.Infof("cannot unpickle message from %s: %s", connection.RemoteAddr(), err.Error())
+			continue
+		}
+		for _, metric := range pickleMetrics {
+			lineChan <- metric.line()
+		}
 	}
 }
 
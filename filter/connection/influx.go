@@ -0,0 +1,281 @@
+package connection
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moira-alert/moira/metrics/graphite"
+)
+
+// DefaultInfluxTemplate is the same default template as telegraf graphite serializer uses
+const DefaultInfluxTemplate = "host.tags.measurement.field"
+
+// Special parts of influx template, any other part is a name of tag
+const (
+	influxTemplateMeasurement = "measurement"
+	influxTemplateField       = "field"
+	influxTemplateTags        = "tags"
+)
+
+// influxValueField is a name of field which is not added to metric name
+const influxValueField = "value"
+
+// influxTag is a single tag of influx point
+type influxTag struct {
+	key   string
+	value string
+}
+
+// influxField is a single numeric field of influx point
+type influxField struct {
+	key   string
+	value float64
+}
+
+// influxPoint is a single line of influx line protocol
+type influxPoint struct {
+	measurement string
+	tags        []influxTag
+	fields      []influxField
+	timestamp   int64
+	hasTime     bool
+}
+
+// influxConverter converts influx line protocol lines into graphite plaintext lines using template
+type influxConverter struct {
+	template []string
+	metrics  *graphite.FilterMetrics
+}
+
+// newInfluxConverter creates converter with template of dot separated parts: "measurement", "field",
+// "tags" (values of all tags not used by other parts sorted by tag key) or name of tag
+func newInfluxConverter(template string, metrics *graphite.FilterMetrics) (*influxConverter, error) {
+	if template == "" {
+		template = DefaultInfluxTemplate
+	}
+	parts := strings.Split(template, ".")
+	hasMeasurement := false
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("influx template has empty part: '%s'", template)
+		}
+		if part == influxTemplateMeasurement {
+			hasMeasurement = true
+		}
+	}
+	if !hasMeasurement {
+		return nil, fmt.Errorf("influx template must contain measurement: '%s'", template)
+	}
+	return &influxConverter{template: parts, metrics: metrics}, nil
+}
+
+// convert parses line protocol line and returns plaintext line for every numeric field of it,
+// timestamp of line is interpreted according to precision, points without timestamp get current time
+func (converter *influxConverter) convert(line []byte, precision time.Duration, now time.Time) ([][]byte, error) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] == '#' {
+		return nil, nil
+	}
+	converter.metrics.InfluxLinesReceived.Inc(1)
+	point, err := parseInfluxLine(line)
+	if err != nil {
+		converter.metrics.InfluxLinesMalformed.Inc(1)
+		return nil, err
+	}
+	timestamp := now.Unix()
+	if point.hasTime {
+		timestamp = point.timestamp / int64(time.Second/precision)
+	}
+	lines := make([][]byte, 0, len(point.fields))
+	for _, field := range point.fields {
+		name := converter.metricName(point, field.key)
+		metricLine := make([]byte, 0, len(name)+32)
+		metricLine = append(metricLine, name...)
+		metricLine = append(metricLine, ' ')
+		metricLine = strconv.AppendFloat(metricLine, field.value, 'f', -1, 64)
+		metricLine = append(metricLine, ' ')
+		metricLine = strconv.AppendInt(metricLine, timestamp, 10)
+		lines = append(lines, metricLine)
+	}
+	return lines, nil
+}
+
+// metricName makes dotted metric name of point field according to template, absent tags are skipped.
+// Dots in tag values are replaced, so every tag value is a single part of metric path
+func (converter *influxConverter) metricName(point *influxPoint, fieldKey string) string {
+	usedTags := make(map[string]bool, len(converter.template))
+	for _, part := range converter.template {
+		usedTags[part] = true
+	}
+	nameParts := make([]string, 0, len(converter.template)+len(point.tags))
+	for _, part := range converter.template {
+		switch part {
+		case influxTemplateMeasurement:
+			nameParts = append(nameParts, sanitizeNamePart(point.measurement, false))
+		case influxTemplateField:
+			if fieldKey != influxValueField {
+				nameParts = append(nameParts, sanitizeNamePart(fieldKey, false))
+			}
+		case influxTemplateTags:
+			for _, tag := range point.tags {
+				if !usedTags[tag.key] {
+					nameParts = append(nameParts, sanitizeNamePart(tag.value, true))
+				}
+			}
+		default:
+			for _, tag := range point.tags {
+				if tag.key == part {
+					nameParts = append(nameParts, sanitizeNamePart(tag.value, true))
+					break
+				}
+			}
+		}
+	}
+	return strings.Join(nameParts, ".")
+}
+
+// parseInfluxLine parses line "measurement[,tag=value...] field=value[,field=value...] [timestamp]".
+// String fields are skipped, boolean fields are converted to 1 and 0
+func parseInfluxLine(line []byte) (*influxPoint, error) {
+	point := &influxPoint{}
+	measurement, pos := scanInfluxToken(line, 0, ", ")
+	if measurement == "" {
+		return nil, fmt.Errorf("measurement is empty: '%s'", line)
+	}
+	point.measurement = measurement
+
+	for pos < len(line) && line[pos] == ',' {
+		var key, value string
+		key, pos = scanInfluxToken(line, pos+1, "=, ")
+		if pos >= len(line) || line[pos] != '=' || key == "" {
+			return nil, fmt.Errorf("invalid tag at position %d: '%s'", pos, line)
+		}
+		value, pos = scanInfluxToken(line, pos+1, ", ")
+		if value == "" {
+			return nil, fmt.Errorf("tag %s has empty value: '%s'", key, line)
+		}
+		point.tags = append(point.tags, influxTag{key: key, value: value})
+	}
+	sort.Slice(point.tags, func(i, j int) bool { return point.tags[i].key < point.tags[j].key })
+
+	if pos >= len(line) || line[pos] != ' ' {
+		return nil, fmt.Errorf("fields are missing: '%s'", line)
+	}
+	pos = skipSpaces(line, pos)
+
+	for fieldsEnd := false; !fieldsEnd; {
+		var key string
+		key, pos = scanInfluxToken(line, pos, "=, ")
+		if pos >= len(line) || line[pos] != '=' || key == "" {
+			return nil, fmt.Errorf("invalid field at position %d: '%s'", pos, line)
+		}
+		pos++
+		if pos < len(line) && line[pos] == '"' {
+			if pos = skipInfluxString(line, pos); pos < 0 {
+				return nil, fmt.Errorf("unterminated string field %s: '%s'", key, line)
+			}
+		} else {
+			var rawValue string
+			rawValue, pos = scanInfluxToken(line, pos, ", ")
+			value, err := parseInfluxFieldValue(rawValue)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value of field %s: '%s' (%s)", key, line, err)
+			}
+			point.fields = append(point.fields, influxField{key: key, value: value})
+		}
+		fieldsEnd = pos >= len(line) || line[pos] != ','
+		if !fieldsEnd {
+			pos++
+		}
+	}
+
+	pos = skipSpaces(line, pos)
+	if pos < len(line) {
+		timestamp, err := strconv.ParseInt(string(line[pos:]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse timestamp: '%s' (%s)", line, err)
+		}
+		point.timestamp = timestamp
+		point.hasTime = true
+	}
+	if len(point.fields) == 0 {
+		return nil, fmt.Errorf("no numeric fields: '%s'", line)
+	}
+	return point, nil
+}
+
+// parseInfluxFieldValue parses float, integer ("1i"), unsigned ("1u") or boolean field value
+func parseInfluxFieldValue(rawValue string) (float64, error) {
+	switch rawValue {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, nil
+	}
+	if strings.HasSuffix(rawValue, "i") {
+		value, err := strconv.ParseInt(rawValue[:len(rawValue)-1], 10, 64)
+		return float64(value), err
+	}
+	if strings.HasSuffix(rawValue, "u") {
+		value, err := strconv.ParseUint(rawValue[:len(rawValue)-1], 10, 64)
+		return float64(value), err
+	}
+	return strconv.ParseFloat(rawValue, 64)
+}
+
+// scanInfluxToken reads unescaped token until one of stop characters and returns it with position of stop character
+func scanInfluxToken(line []byte, pos int, stops string) (string, int) {
+	token := make([]byte, 0, 32)
+	for ; pos < len(line); pos++ {
+		c := line[pos]
+		if c == '\\' && pos+1 < len(line) && strings.IndexByte(`,= \`, line[pos+1]) >= 0 {
+			pos++
+			token = append(token, line[pos])
+			continue
+		}
+		if strings.IndexByte(stops, c) >= 0 {
+			break
+		}
+		token = append(token, c)
+	}
+	return string(token), pos
+}
+
+// skipInfluxString returns position after closing quote of string started at pos or -1 if string is unterminated
+func skipInfluxString(line []byte, pos int) int {
+	for pos++; pos < len(line); pos++ {
+		switch line[pos] {
+		case '\\':
+			pos++
+		case '"':
+			return pos + 1
+		}
+	}
+	return -1
+}
+
+func skipSpaces(line []byte, pos int) int {
+	for pos < len(line) && line[pos] == ' ' {
+		pos++
+	}
+	return pos
+}
+
+// parseInfluxPrecision parses precision of influx HTTP API, empty precision means nanoseconds
+func parseInfluxPrecision(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	}
+	return 0, fmt.Errorf("unsupported precision '%s'", precision)
+}
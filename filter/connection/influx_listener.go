@@ -0,0 +1,244 @@
+package connection
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite"
+)
+
+// InfluxWritePath is a path of influx HTTP write endpoint
+const InfluxWritePath = "/write"
+
+// maxInfluxRequestSize limits size of influx HTTP write request body
+const maxInfluxRequestSize = 32 * 1024 * 1024
+
+// InfluxConfig is a configuration of influx line protocol listener, empty uri disables corresponding transport
+type InfluxConfig struct {
+	ListenTCP        string
+	ListenUDP        string
+	ListenHTTP       string
+	MaxUDPPacketSize int
+	Template         string
+}
+
+// InfluxMetricsListener accepts influx line protocol over TCP, UDP and HTTP
+// and converts it to graphite plaintext lines using template
+type InfluxMetricsListener struct {
+	tcpListener   *net.TCPListener
+	udpConn       *net.UDPConn
+	httpListener  net.Listener
+	httpServer    *http.Server
+	maxPacketSize int
+	converter     *influxConverter
+	handler       *Handler
+	logger        moira.Logger
+	metrics       *graphite.FilterMetrics
+	tomb          tomb.Tomb
+	rawLineChan   chan []byte
+	converterDone chan struct{}
+	lineChan      chan<- []byte
+}
+
+// NewInfluxListener creates new influx line protocol listener
+func NewInfluxListener(config InfluxConfig, logger moira.Logger, metrics *graphite.FilterMetrics) (*InfluxMetricsListener, error) {
+	if config.ListenTCP == "" && config.ListenUDP == "" && config.ListenHTTP == "" {
+		return nil, fmt.Errorf("no influx listener uri is configured")
+	}
+	converter, err := newInfluxConverter(config.Template, metrics)
+	if err != nil {
+		return nil, err
+	}
+	listener := &InfluxMetricsListener{
+		maxPacketSize: config.MaxUDPPacketSize,
+		converter:     converter,
+		handler:       NewConnectionsHandler(logger),
+		logger:        logger,
+		metrics:       metrics,
+		rawLineChan:   make(chan []byte, 1024),
+		converterDone: make(chan struct{}),
+	}
+	if listener.maxPacketSize <= 0 {
+		listener.maxPacketSize = DefaultMaxUDPPacketSize
+	}
+	if config.ListenTCP != "" {
+		address, err := net.ResolveTCPAddr("tcp", config.ListenTCP)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve tcp address [%s]: %s", config.ListenTCP, err.Error())
+		}
+		if listener.tcpListener, err = net.ListenTCP("tcp", address); err != nil {
+			return nil, fmt.Errorf("failed to listen on [%s]: %s", config.ListenTCP, err.Error())
+		}
+	}
+	if config.ListenUDP != "" {
+		address, err := net.ResolveUDPAddr("udp", config.ListenUDP)
+		if err != nil {
+			listener.closeListeners()
+			return nil, fmt.Errorf("failed to resolve udp address [%s]: %s", config.ListenUDP, err.Error())
+		}
+		if listener.udpConn, err = net.ListenUDP("udp", address); err != nil {
+			listener.closeListeners()
+			return nil, fmt.Errorf("failed to listen on udp [%s]: %s", config.ListenUDP, err.Error())
+		}
+	}
+	if config.ListenHTTP != "" {
+		if listener.httpListener, err = net.Listen("tcp", config.ListenHTTP); err != nil {
+			listener.closeListeners()
+			return nil, fmt.Errorf("failed to listen on [%s]: %s", config.ListenHTTP, err.Error())
+		}
+	}
+	return listener, nil
+}
+
+// Listen starts all configured transports, converted lines are sent to lineChan,
+// lineChan is not closed on stop, it is owned by MetricsListener
+func (listener *InfluxMetricsListener) Listen(lineChan chan<- []byte) {
+	listener.lineChan = lineChan
+	go listener.convertRawLines()
+	if listener.tcpListener != nil {
+		listener.tomb.Go(listener.listenTCP)
+	}
+	if listener.udpConn != nil {
+		listener.tomb.Go(listener.listenUDP)
+	}
+	if listener.httpListener != nil {
+		mux := http.NewServeMux()
+		mux.HandleFunc(InfluxWritePath, listener.handleWrite)
+		listener.httpServer = &http.Server{Handler: mux}
+		listener.tomb.Go(func() error {
+			if err := listener.httpServer.Serve(listener.httpListener); err != nil && err != http.ErrServerClosed {
+				listener.logger.Errorf("Influx HTTP listener failed: %s", err.Error())
+			}
+			return nil
+		})
+	}
+	listener.logger.Info("Moira Filter Influx Listener Started")
+}
+
+// Stop stops all transports and waits for converting of already received lines
+func (listener *InfluxMetricsListener) Stop() error {
+	listener.logger.Info("Stopping influx listener...")
+	listener.tomb.Kill(nil)
+	if listener.httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := listener.httpServer.Shutdown(ctx); err != nil {
+			listener.logger.Errorf("Failed to stop influx HTTP listener: %s", err.Error())
+		}
+	}
+	err := listener.tomb.Wait()
+	close(listener.rawLineChan)
+	<-listener.converterDone
+	listener.logger.Info("Moira Filter Influx Listener stopped")
+	return err
+}
+
+func (listener *InfluxMetricsListener) closeListeners() {
+	if listener.tcpListener != nil {
+		listener.tcpListener.Close()
+	}
+	if listener.udpConn != nil {
+		listener.udpConn.Close()
+	}
+}
+
+// convertRawLines converts lines received over TCP and UDP until all of them are stopped,
+// these lines are always in nanosecond precision
+func (listener *InfluxMetricsListener) convertRawLines() {
+	defer close(listener.converterDone)
+	for rawLine := range listener.rawLineChan {
+		listener.sendConverted(rawLine, time.Nanosecond)
+	}
+}
+
+func (listener *InfluxMetricsListener) sendConverted(rawLine []byte, precision time.Duration) {
+	lines, err := listener.converter.convert(rawLine, precision, time.Now())
+	if err != nil {
+		listener.logger.Infof("cannot parse influx line: %s", err.Error())
+		return
+	}
+	for _, line := range lines {
+		listener.lineChan <- line
+	}
+}
+
+func (listener *InfluxMetricsListener) listenTCP() error {
+	for {
+		select {
+		case <-listener.tomb.Dying():
+			{
+				listener.tcpListener.Close()
+				listener.handler.StopHandlingConnections()
+				return nil
+			}
+		default:
+		}
+		listener.tcpListener.SetDeadline(time.Now().Add(1e9))
+		conn, err := listener.tcpListener.Accept()
+		if nil != err {
+			if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+				continue
+			}
+			listener.logger.Infof("Failed to accept influx connection: %s", err.Error())
+			continue
+		}
+		listener.logger.Infof("%s connected using influx line protocol", conn.RemoteAddr())
+		listener.handler.HandleConnection(conn, listener.rawLineChan)
+	}
+}
+
+func (listener *InfluxMetricsListener) listenUDP() error {
+	// One extra byte lets to recognize datagrams exceeding maxPacketSize
+	buffer := make([]byte, listener.maxPacketSize+1)
+	for {
+		select {
+		case <-listener.tomb.Dying():
+			listener.udpConn.Close()
+			return nil
+		default:
+		}
+		listener.udpConn.SetReadDeadline(time.Now().Add(1e9))
+		n, _, err := listener.udpConn.ReadFromUDP(buffer)
+		if err != nil {
+			if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+				continue
+			}
+			listener.logger.Infof("Failed to read influx udp packet: %s", err.Error())
+			continue
+		}
+		lines, _ := splitPacket(buffer[:n], listener.maxPacketSize)
+		for _, line := range lines {
+			listener.rawLineChan <- line
+		}
+	}
+}
+
+func (listener *InfluxMetricsListener) handleWrite(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	precision, err := parseInfluxPrecision(request.URL.Query().Get("precision"))
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	scanner := bufio.NewScanner(io.LimitReader(request.Body, maxInfluxRequestSize))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxInfluxRequestSize)
+	for scanner.Scan() {
+		listener.sendConverted(scanner.Bytes(), precision)
+	}
+	if err := scanner.Err(); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,117 @@
+package connection
+
+import (
+	"testing"
+	"time"
+
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseInfluxLine(t *testing.T) {
+	Convey("Given valid lines, should parse points", t, func() {
+		point, err := parseInfluxLine([]byte("cpu,host=server01,region=us-west usage_idle=91.5,usage_user=2i,up=t,name=\"a, b\" 1234567890000000000"))
+		So(err, ShouldBeNil)
+		So(point, ShouldResemble, &influxPoint{
+			measurement: "cpu",
+			tags:        []influxTag{{"host", "server01"}, {"region", "us-west"}},
+			fields:      []influxField{{"usage_idle", 91.5}, {"usage_user", 2}, {"up", 1}},
+			timestamp:   1234567890000000000,
+			hasTime:     true,
+		})
+
+		point, err = parseInfluxLine([]byte(`disk\ io,path=C:\,\ D: value=-1e3,free=10u`))
+		So(err, ShouldBeNil)
+		So(point, ShouldResemble, &influxPoint{
+			measurement: "disk io",
+			tags:        []influxTag{{"path", "C:, D:"}},
+			fields:      []influxField{{"value", -1000}, {"free", 10}},
+		})
+	})
+
+	Convey("Given invalid lines, should return errors", t, func() {
+		invalidLines := []string{
+			",host=a value=1",
+			"cpu",
+			"cpu,host value=1",
+			"cpu,host= value=1",
+			"cpu value",
+			"cpu value=abc",
+			"cpu value=1 12a",
+			"cpu name=\"unterminated",
+			"cpu name=\"string\"",
+		}
+		for _, line := range invalidLines {
+			_, err := parseInfluxLine([]byte(line))
+			So(err, ShouldBeError)
+		}
+	})
+}
+
+func TestInfluxConverter(t *testing.T) {
+	filterMetrics := metrics.ConfigureFilterMetrics("test")
+	now := time.Unix(1234567999, 0)
+
+	Convey("Given invalid template, should return error", t, func() {
+		_, err := newInfluxConverter("host..measurement", filterMetrics)
+		So(err, ShouldBeError)
+		_, err = newInfluxConverter("host.field", filterMetrics)
+		So(err, ShouldBeError)
+	})
+
+	Convey("Given default template, should convert line to plaintext lines", t, func() {
+		converter, err := newInfluxConverter("", filterMetrics)
+		So(err, ShouldBeNil)
+		lines, err := converter.convert([]byte("cpu.load,host=server.01,region=us-west,dc=x value=1.5,short=2i 1234567890000000000"), time.Nanosecond, now)
+		So(err, ShouldBeNil)
+		So(lines, ShouldResemble, [][]byte{
+			[]byte("server_01.x.us-west.cpu.load 1.5 1234567890"),
+			[]byte("server_01.x.us-west.cpu.load.short 2 1234567890"),
+		})
+	})
+
+	Convey("Given custom template, should skip absent tags", t, func() {
+		converter, err := newInfluxConverter("region.measurement.field.host", filterMetrics)
+		So(err, ShouldBeNil)
+		lines, err := converter.convert([]byte("mem,host=a used=3 1234567890"), time.Second, now)
+		So(err, ShouldBeNil)
+		So(lines, ShouldResemble, [][]byte{[]byte("mem.used.a 3 1234567890")})
+	})
+
+	Convey("Given line without timestamp, should use current time", t, func() {
+		converter, _ := newInfluxConverter("measurement.field", filterMetrics)
+		lines, err := converter.convert([]byte("mem used=3"), time.Nanosecond, now)
+		So(err, ShouldBeNil)
+		So(lines, ShouldResemble, [][]byte{[]byte("mem.used 3 1234567999")})
+	})
+
+	Convey("Empty lines and comments should be skipped, malformed lines should be counted", t, func() {
+		converter, _ := newInfluxConverter("measurement.field", filterMetrics)
+		received := filterMetrics.InfluxLinesReceived.Count()
+		malformed := filterMetrics.InfluxLinesMalformed.Count()
+
+		lines, err := converter.convert([]byte("  "), time.Nanosecond, now)
+		So(err, ShouldBeNil)
+		So(lines, ShouldBeEmpty)
+		lines, err = converter.convert([]byte("# comment"), time.Nanosecond, now)
+		So(err, ShouldBeNil)
+		So(lines, ShouldBeEmpty)
+		_, err = converter.convert([]byte("mem used"), time.Nanosecond, now)
+		So(err, ShouldBeError)
+
+		So(filterMetrics.InfluxLinesReceived.Count(), ShouldEqual, received+1)
+		So(filterMetrics.InfluxLinesMalformed.Count(), ShouldEqual, malformed+1)
+	})
+}
+
+func TestParseInfluxPrecision(t *testing.T) {
+	Convey("Should parse supported precisions", t, func() {
+		for precision, expected := range map[string]time.Duration{"": time.Nanosecond, "ns": time.Nanosecond, "u": time.Microsecond, "ms": time.Millisecond, "s": time.Second} {
+			actual, err := parseInfluxPrecision(precision)
+			So(err, ShouldBeNil)
+			So(actual, ShouldEqual, expected)
+		}
+		_, err := parseInfluxPrecision("h")
+		So(err, ShouldBeError)
+	})
+}
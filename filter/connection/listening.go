@@ -20,8 +20,12 @@ type MetricsListener struct {
 	metrics  *graphite.FilterMetrics
 }
 
-// NewListener creates new listener
-func NewListener(port string, logger moira.Logger, metrics *graphite.FilterMetrics) (*MetricsListener, error) {
+// NewListener creates new listener, stats of its connections are kept in stats if it is not nil
+func NewListener(port string, limits ConnectionLimits, stats *ConnectionsStats, logger moira.Logger, metrics *graphite.FilterMetrics) (*MetricsListener, error) {
+	handler, err := newPlaintextHandler(logger, limits, stats)
+	if err != nil {
+		return nil, err
+	}
 	address, err := net.ResolveTCPAddr("tcp", port)
 	if nil != err {
 		return nil, fmt.Errorf("failed to resolve tcp address [%s]: %s", port, err.Error())
@@ -33,7 +37,7 @@ func NewListener(port string, logger moira.Logger, metrics *graphite.FilterMetri
 	listener := MetricsListener{
 		listener: newListener,
 		logger:   logger,
-		handler:  NewConnectionsHandler(logger),
+		handler:  handler,
 		metrics:  metrics,
 	}
 	return &listener, nil
@@ -0,0 +1,520 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Pickle opcodes supported by decoder. Opcodes able to import or call python objects
+// (GLOBAL, REDUCE, BUILD, INST, OBJ, NEWOBJ, etc.) are deliberately not supported
+const (
+	opMark            = '('
+	opStop            = '.'
+	opPop             = '0'
+	opPopMark         = '1'
+	opDup             = '2'
+	opFloat           = 'F'
+	opInt             = 'I'
+	opBinInt          = 'J'
+	opBinInt1         = 'K'
+	opLong            = 'L'
+	opBinInt2         = 'M'
+	opNone            = 'N'
+	opString          = 'S'
+	opBinString       = 'T'
+	opShortBinString  = 'U'
+	opUnicode         = 'V'
+	opBinUnicode      = 'X'
+	opAppend          = 'a'
+	opAppends         = 'e'
+	opGet             = 'g'
+	opBinGet          = 'h'
+	opLongBinGet      = 'j'
+	opList            = 'l'
+	opEmptyList       = ']'
+	opPut             = 'p'
+	opBinPut          = 'q'
+	opLongBinPut      = 'r'
+	opTuple           = 't'
+	opEmptyTuple      = ')'
+	opBinFloat        = 'G'
+	opBinBytes        = 'B'
+	opShortBinBytes   = 'C'
+	opProto           = 0x80
+	opTuple1          = 0x85
+	opTuple2          = 0x86
+	opTuple3          = 0x87
+	opNewTrue         = 0x88
+	opNewFalse        = 0x89
+	opLong1           = 0x8a
+	opShortBinUnicode = 0x8c
+	opMemoize         = 0x94
+	opFrame           = 0x95
+)
+
+// maxPickleMemoSize limits memo of a single message to protect filter from memory exhaustion
+const maxPickleMemoSize = 1 << 20
+
+// pickleMark is a stack marker pushed by MARK opcode
+type pickleMark struct{}
+
+// pickleList is a mutable python list, it is shared between stack and memo
+type pickleList struct {
+	items []interface{}
+}
+
+// pickleMetric is a single datapoint of graphite pickle message
+type pickleMetric struct {
+	name      string
+	timestamp int64
+	value     float64
+}
+
+// line formats datapoint as graphite plaintext protocol line
+func (metric *pickleMetric) line() []byte {
+	line := make([]byte, 0, len(metric.name)+32)
+	line = append(line, metric.name...)
+	line = append(line, ' ')
+	line = strconv.AppendFloat(line, metric.value, 'f', -1, 64)
+	line = append(line, ' ')
+	line = strconv.AppendInt(line, metric.timestamp, 10)
+	return line
+}
+
+// pickleDecoder is a restricted pickle virtual machine, it supports only opcodes required to build
+// lists, tuples, strings and numbers, so decoding never executes any code
+type pickleDecoder struct {
+	data  []byte
+	pos   int
+	stack []interface{}
+	memo  map[int64]interface{}
+}
+
+// unpickleMetrics decodes pickled list of (metric, (timestamp, value)) tuples sent by carbon relays
+func unpickleMetrics(data []byte) ([]*pickleMetric, error) {
+	decoder := &pickleDecoder{data: data, memo: make(map[int64]interface{})}
+	result, err := decoder.decode()
+	if err != nil {
+		return nil, err
+	}
+	var items []interface{}
+	switch typed := result.(type) {
+	case *pickleList:
+		items = typed.items
+	case []interface{}:
+		items = typed
+	default:
+		return nil, fmt.Errorf("pickled message is not a list")
+	}
+	metrics := make([]*pickleMetric, 0, len(items))
+	for _, item := range items {
+		metric, err := toPickleMetric(item)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, nil
+}
+
+func toPickleMetric(item interface{}) (*pickleMetric, error) {
+	metricTuple, ok := item.([]interface{})
+	if !ok || len(metricTuple) != 2 {
+		return nil, fmt.Errorf("datapoint is not a (metric, (timestamp, value)) tuple")
+	}
+	name, ok := metricTuple[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("metric name is not a string")
+	}
+	pointTuple, ok := metricTuple[1].([]interface{})
+	if !ok || len(pointTuple) != 2 {
+		return nil, fmt.Errorf("datapoint of '%s' is not a (timestamp, value) tuple", name)
+	}
+	timestamp, err := toFloat64(pointTuple[0])
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse timestamp of '%s': %s", name, err.Error())
+	}
+	value, err := toFloat64(pointTuple[1])
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse value of '%s': %s", name, err.Error())
+	}
+	return &pickleMetric{
+		name:      name,
+		timestamp: int64(timestamp),
+		value:     value,
+	}, nil
+}
+
+func toFloat64(value interface{}) (float64, error) {
+	switch typed := value.(type) {
+	case int64:
+		return float64(typed), nil
+	case float64:
+		return typed, nil
+	case string:
+		return strconv.ParseFloat(typed, 64)
+	default:
+		return 0, fmt.Errorf("unsupported type %T", value)
+	}
+}
+
+func (decoder *pickleDecoder) decode() (interface{}, error) {
+	for {
+		op, err := decoder.readByte()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case opStop:
+			return decoder.pop()
+		case opProto:
+			_, err = decoder.read(1)
+		case opFrame:
+			_, err = decoder.read(8)
+		case opMark:
+			decoder.push(pickleMark{})
+		case opPop:
+			_, err = decoder.pop()
+		case opPopMark:
+			_, err = decoder.popMark()
+		case opDup:
+			var top interface{}
+			if top, err = decoder.top(); err == nil {
+				decoder.push(top)
+			}
+		case opNone:
+			decoder.push(nil)
+		case opNewTrue:
+			decoder.push(int64(1))
+		case opNewFalse:
+			decoder.push(int64(0))
+		case opInt, opLong:
+			err = decoder.loadTextInt()
+		case opBinInt:
+			var b []byte
+			if b, err = decoder.read(4); err == nil {
+				decoder.push(int64(int32(binary.LittleEndian.Uint32(b))))
+			}
+		case opBinInt1:
+			var b []byte
+			if b, err = decoder.read(1); err == nil {
+				decoder.push(int64(b[0]))
+			}
+		case opBinInt2:
+			var b []byte
+			if b, err = decoder.read(2); err == nil {
+				decoder.push(int64(binary.LittleEndian.Uint16(b)))
+			}
+		case opLong1:
+			err = decoder.loadLong1()
+		case opFloat:
+			var line []byte
+			if line, err = decoder.readLine(); err == nil {
+				var value float64
+				if value, err = strconv.ParseFloat(string(line), 64); err == nil {
+					decoder.push(value)
+				}
+			}
+		case opBinFloat:
+			var b []byte
+			if b, err = decoder.read(8); err == nil {
+				decoder.push(math.Float64frombits(binary.BigEndian.Uint64(b)))
+			}
+		case opString:
+			err = decoder.loadQuotedString()
+		case opUnicode:
+			var line []byte
+			if line, err = decoder.readLine(); err == nil {
+				decoder.push(string(line))
+			}
+		case opShortBinString, opShortBinBytes, opShortBinUnicode:
+			err = decoder.loadSizedString(1)
+		case opBinString, opBinBytes, opBinUnicode:
+			err = decoder.loadSizedString(4)
+		case opEmptyList:
+			decoder.push(&pickleList{})
+		case opList:
+			var items []interface{}
+			if items, err = decoder.popMark(); err == nil {
+				decoder.push(&pickleList{items: items})
+			}
+		case opAppend:
+			err = decoder.appendItems(1)
+		case opAppends:
+			err = decoder.appendMarkedItems()
+		case opEmptyTuple:
+			decoder.push([]interface{}{})
+		case opTuple:
+			var items []interface{}
+			if items, err = decoder.popMark(); err == nil {
+				decoder.push(items)
+			}
+		case opTuple1, opTuple2, opTuple3:
+			err = decoder.loadTuple(int(op-opTuple1) + 1)
+		case opPut:
+			var line []byte
+			if line, err = decoder.readLine(); err == nil {
+				var index int64
+				if index, err = strconv.ParseInt(string(line), 10, 64); err == nil {
+					err = decoder.memoize(index)
+				}
+			}
+		case opBinPut:
+			var b []byte
+			if b, err = decoder.read(1); err == nil {
+				err = decoder.memoize(int64(b[0]))
+			}
+		case opLongBinPut:
+			var b []byte
+			if b, err = decoder.read(4); err == nil {
+				err = decoder.memoize(int64(binary.LittleEndian.Uint32(b)))
+			}
+		case opMemoize:
+			err = decoder.memoize(int64(len(decoder.memo)))
+		case opGet:
+			var line []byte
+			if line, err = decoder.readLine(); err == nil {
+				var index int64
+				if index, err = strconv.ParseInt(string(line), 10, 64); err == nil {
+					err = decoder.loadMemo(index)
+				}
+			}
+		case opBinGet:
+			var b []byte
+			if b, err = decoder.read(1); err == nil {
+				err = decoder.loadMemo(int64(b[0]))
+			}
+		case opLongBinGet:
+			var b []byte
+			if b, err = decoder.read(4); err == nil {
+				err = decoder.loadMemo(int64(binary.LittleEndian.Uint32(b)))
+			}
+		default:
+			return nil, fmt.Errorf("unsupported pickle opcode 0x%02x at position %d", op, decoder.pos-1)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (decoder *pickleDecoder) readByte() (byte, error) {
+	b, err := decoder.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (decoder *pickleDecoder) read(n int) ([]byte, error) {
+	if n < 0 || decoder.pos+n > len(decoder.data) {
+		return nil, fmt.Errorf("unexpected end of pickled message")
+	}
+	b := decoder.data[decoder.pos : decoder.pos+n]
+	decoder.pos += n
+	return b, nil
+}
+
+func (decoder *pickleDecoder) readLine() ([]byte, error) {
+	end := bytes.IndexByte(decoder.data[decoder.pos:], '\n')
+	if end < 0 {
+		return nil, fmt.Errorf("unexpected end of pickled message")
+	}
+	line := decoder.data[decoder.pos : decoder.pos+end]
+	decoder.pos += end + 1
+	return line, nil
+}
+
+func (decoder *pickleDecoder) push(value interface{}) {
+	decoder.stack = append(decoder.stack, value)
+}
+
+func (decoder *pickleDecoder) top() (interface{}, error) {
+	if len(decoder.stack) == 0 {
+		return nil, fmt.Errorf("pickle stack underflow")
+	}
+	return decoder.stack[len(decoder.stack)-1], nil
+}
+
+func (decoder *pickleDecoder) pop() (interface{}, error) {
+	value, err := decoder.top()
+	if err != nil {
+		return nil, err
+	}
+	decoder.stack = decoder.stack[:len(decoder.stack)-1]
+	return value, nil
+}
+
+// popMark pops all items pushed after the last MARK and the MARK itself
+func (decoder *pickleDecoder) popMark() ([]interface{}, error) {
+	for i := len(decoder.stack) - 1; i >= 0; i-- {
+		if _, ok := decoder.stack[i].(pickleMark); ok {
+			items := make([]interface{}, len(decoder.stack)-i-1)
+			copy(items, decoder.stack[i+1:])
+			decoder.stack = decoder.stack[:i]
+			return items, nil
+		}
+	}
+	return nil, fmt.Errorf("pickle mark not found")
+}
+
+func (decoder *pickleDecoder) loadTextInt() error {
+	line, err := decoder.readLine()
+	if err != nil {
+		return err
+	}
+	line = bytes.TrimSuffix(line, []byte("L"))
+	value, err := strconv.ParseInt(string(line), 10, 64)
+	if err != nil {
+		return err
+	}
+	decoder.push(value)
+	return nil
+}
+
+func (decoder *pickleDecoder) loadLong1() error {
+	size, err := decoder.readByte()
+	if err != nil {
+		return err
+	}
+	if size > 8 {
+		return fmt.Errorf("pickled long is too big: %d bytes", size)
+	}
+	b, err := decoder.read(int(size))
+	if err != nil {
+		return err
+	}
+	var value int64
+	for i := len(b) - 1; i >= 0; i-- {
+		value = value<<8 | int64(b[i])
+	}
+	if size > 0 && size < 8 && b[size-1]&0x80 != 0 {
+		value -= int64(1) << (8 * uint(size))
+	}
+	decoder.push(value)
+	return nil
+}
+
+func (decoder *pickleDecoder) loadQuotedString() error {
+	line, err := decoder.readLine()
+	if err != nil {
+		return err
+	}
+	if len(line) < 2 || line[0] != line[len(line)-1] || (line[0] != '\'' && line[0] != '"') {
+		return fmt.Errorf("invalid pickled string")
+	}
+	value, err := unquotePickledString(line[1 : len(line)-1])
+	if err != nil {
+		return fmt.Errorf("invalid pickled string: %s", err.Error())
+	}
+	decoder.push(value)
+	return nil
+}
+
+// unquotePickledString unescapes body of python string literal quoted with single or double quotes,
+// it is converted to go double quoted literal, as python and go escape sequences used by pickle are the same except \'
+func unquotePickledString(body []byte) (string, error) {
+	var builder strings.Builder
+	builder.Grow(len(body) + 2)
+	builder.WriteByte('"')
+	for i := 0; i < len(body); i++ {
+		switch {
+		case body[i] == '\\' && i+1 < len(body):
+			if body[i+1] != '\'' {
+				builder.WriteByte('\\')
+			}
+			builder.WriteByte(body[i+1])
+			i++
+		case body[i] == '"':
+			builder.WriteString(`\"`)
+		default:
+			builder.WriteByte(body[i])
+		}
+	}
+	builder.WriteByte('"')
+	return strconv.Unquote(builder.String())
+}
+
+func (decoder *pickleDecoder) loadSizedString(sizeLen int) error {
+	b, err := decoder.read(sizeLen)
+	if err != nil {
+		return err
+	}
+	size := int(b[0])
+	if sizeLen == 4 {
+		size = int(binary.LittleEndian.Uint32(b))
+	}
+	value, err := decoder.read(size)
+	if err != nil {
+		return err
+	}
+	decoder.push(string(value))
+	return nil
+}
+
+func (decoder *pickleDecoder) loadTuple(size int) error {
+	if len(decoder.stack) < size {
+		return fmt.Errorf("pickle stack underflow")
+	}
+	items := make([]interface{}, size)
+	copy(items, decoder.stack[len(decoder.stack)-size:])
+	decoder.stack = decoder.stack[:len(decoder.stack)-size]
+	decoder.push(items)
+	return nil
+}
+
+func (decoder *pickleDecoder) appendItems(count int) error {
+	if len(decoder.stack) < count+1 {
+		return fmt.Errorf("pickle stack underflow")
+	}
+	items := decoder.stack[len(decoder.stack)-count:]
+	list, ok := decoder.stack[len(decoder.stack)-count-1].(*pickleList)
+	if !ok {
+		return fmt.Errorf("append to non-list object")
+	}
+	list.items = append(list.items, items...)
+	decoder.stack = decoder.stack[:len(decoder.stack)-count]
+	return nil
+}
+
+func (decoder *pickleDecoder) appendMarkedItems() error {
+	items, err := decoder.popMark()
+	if err != nil {
+		return err
+	}
+	top, err := decoder.top()
+	if err != nil {
+		return err
+	}
+	list, ok := top.(*pickleList)
+	if !ok {
+		return fmt.Errorf("append to non-list object")
+	}
+	list.items = append(list.items, items...)
+	return nil
+}
+
+func (decoder *pickleDecoder) memoize(index int64) error {
+	if len(decoder.memo) >= maxPickleMemoSize {
+		return fmt.Errorf("pickle memo is too big")
+	}
+	top, err := decoder.top()
+	if err != nil {
+		return err
+	}
+	decoder.memo[index] = top
+	return nil
+}
+
+func (decoder *pickleDecoder) loadMemo(index int64) error {
+	value, ok := decoder.memo[index]
+	if !ok {
+		return fmt.Errorf("pickle memo key %d not found", index)
+	}
+	decoder.push(value)
+	return nil
+}
@@ -0,0 +1,79 @@
+package connection
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite"
+)
+
+// PickleMetricsListener accepts connections of carbon relays sending metrics using graphite pickle protocol
+type PickleMetricsListener struct {
+	listener *net.TCPListener
+	handler  *Handler
+	logger   moira.Logger
+	tomb     tomb.Tomb
+	metrics  *graphite.FilterMetrics
+}
+
+// NewPickleListener creates new pickle protocol listener
+func NewPickleListener(port string, logger moira.Logger, metrics *graphite.FilterMetrics) (*PickleMetricsListener, error) {
+	address, err := net.ResolveTCPAddr("tcp", port)
+	if nil != err {
+		return nil, fmt.Errorf("failed to resolve tcp address [%s]: %s", port, err.Error())
+	}
+	newListener, err := net.ListenTCP("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on [%s]: %s", port, err.Error())
+	}
+	listener := PickleMetricsListener{
+		listener: newListener,
+		logger:   logger,
+		handler:  NewConnectionsHandler(logger),
+		metrics:  metrics,
+	}
+	return &listener, nil
+}
+
+// Listen waits for new connections and handles them in ConnectionHandler
+// All decoded datapoints are sent to lineChan as plaintext lines,
+// lineChan is not closed on stop, it is owned by MetricsListener
+func (listener *PickleMetricsListener) Listen(lineChan chan<- []byte) {
+	listener.tomb.Go(func() error {
+		for {
+			select {
+			case <-listener.tomb.Dying():
+				{
+					listener.logger.Info("Stopping pickle listener...")
+					listener.listener.Close()
+					listener.handler.StopHandlingConnections()
+					listener.logger.Info("Moira Filter Pickle Listener stopped")
+					return nil
+				}
+			default:
+			}
+			listener.listener.SetDeadline(time.Now().Add(1e9))
+			conn, err := listener.listener.Accept()
+			if nil != err {
+				if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+					continue
+				}
+				listener.logger.Infof("Failed to accept pickle connection: %s", err.Error())
+				continue
+			}
+			listener.logger.Infof("%s connected using pickle protocol", conn.RemoteAddr())
+			listener.handler.HandlePickleConnection(conn, lineChan, listener.metrics)
+		}
+	})
+	listener.logger.Info("Moira Filter Pickle Listener Started")
+}
+
+// Stop stops listening connections
+func (listener *PickleMetricsListener) Stop() error {
+	listener.tomb.Kill(nil)
+	return listener.tomb.Wait()
+}
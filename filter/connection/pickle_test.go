@@ -0,0 +1,91 @@
+package connection
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnpickleMetrics(t *testing.T) {
+	expected := []*pickleMetric{
+		{name: "One.two.three", timestamp: 1234567890, value: 123.5},
+		{name: "Four.five", timestamp: 1234567891, value: -2},
+		{name: "Six", timestamp: 1234567892, value: 7},
+	}
+
+	Convey("Given messages pickled with different protocols, should decode metrics", t, func() {
+		messages := map[string]string{
+			"protocol 0": "(lp0\n(VOne.two.three\np1\n(I1234567890\nF123.5\ntp2\ntp3\na(VFour.five\np4\n(F1234567891.0\nI-2\ntp5\ntp6\na(VSix\np7\n(I1234567892\nI7\ntp8\ntp9\na.",
+			"protocol 1": "]q\x00((X\r\x00\x00\x00One.two.threeq\x01(J\xd2\x02\x96IG@^\xe0\x00\x00\x00\x00\x00tq\x02tq\x03(X\t\x00\x00\x00Four.fiveq\x04(GA\xd2e\x80\xb4\xc0\x00\x00J\xfe\xff\xff\xfftq\x05tq\x06(X\x03\x00\x00\x00Sixq\x07(J\xd4\x02\x96IK\x07tq\x08tq\te.",
+			"protocol 2": "\x80\x02]q\x00(X\r\x00\x00\x00One.two.threeq\x01J\xd2\x02\x96IG@^\xe0\x00\x00\x00\x00\x00\x86q\x02\x86q\x03X\t\x00\x00\x00Four.fiveq\x04GA\xd2e\x80\xb4\xc0\x00\x00J\xfe\xff\xff\xff\x86q\x05\x86q\x06X\x03\x00\x00\x00Sixq\x07J\xd4\x02\x96IK\x07\x86q\x08\x86q\te.",
+			"protocol 4": "\x80\x04\x95V\x00\x00\x00\x00\x00\x00\x00]\x94(\x8c\rOne.two.three\x94J\xd2\x02\x96IG@^\xe0\x00\x00\x00\x00\x00\x86\x94\x86\x94\x8c\tFour.five\x94GA\xd2e\x80\xb4\xc0\x00\x00J\xfe\xff\xff\xff\x86\x94\x86\x94\x8c\x03Six\x94J\xd4\x02\x96IK\x07\x86\x94\x86\x94e.",
+		}
+		for protocol, message := range messages {
+			Convey(protocol, func() {
+				metrics, err := unpickleMetrics([]byte(message))
+				So(err, ShouldBeNil)
+				So(metrics, ShouldResemble, expected)
+			})
+		}
+	})
+
+	Convey("Given python 2 pickle with short binary strings, should decode metrics", t, func() {
+		message := "\x80\x02]q\x00U\rOne.two.threeq\x01J\xd2\x02\x96IG@^\xe0\x00\x00\x00\x00\x00\x86q\x02\x86q\x03a."
+		metrics, err := unpickleMetrics([]byte(message))
+		So(err, ShouldBeNil)
+		So(metrics, ShouldResemble, expected[:1])
+	})
+
+	Convey("Given python 2 protocol 0 pickle with quoted strings, should unescape them", t, func() {
+		messages := map[string]string{
+			"One.two.three":  "(lp0\n(S'One.two.three'\np1\n(I1234567890\nF123.5\ntp2\ntp3\na.",
+			"It's.one":       "(lp0\n(S\"It's.one\"\np1\n(I1234567890\nF123.5\ntp2\ntp3\na.",
+			`It's."one"`:     "(lp0\n(S'It\\'s.\"one\"'\np1\n(I1234567890\nF123.5\ntp2\ntp3\na.",
+			"One\\two.\x01":  "(lp0\n(S'One\\\\two.\\x01'\np1\n(I1234567890\nF123.5\ntp2\ntp3\na.",
+			"Tab\tseparated": "(lp0\n(S'Tab\\tseparated'\np1\n(I1234567890\nF123.5\ntp2\ntp3\na.",
+		}
+		for name, message := range messages {
+			metrics, err := unpickleMetrics([]byte(message))
+			So(err, ShouldBeNil)
+			So(metrics, ShouldResemble, []*pickleMetric{{name: name, timestamp: 1234567890, value: 123.5}})
+		}
+
+		_, err := unpickleMetrics([]byte("(lp0\n(S'One\\qtwo'\np1\n(I1234567890\nF123.5\ntp2\ntp3\na."))
+		So(err, ShouldBeError)
+	})
+
+	Convey("Given pickle calling python function, should not execute it", t, func() {
+		message := "\x80\x02]q\x00cposix\nsystem\nq\x01X\n\x00\x00\x00echo pwnedq\x02\x85q\x03Rq\x04a."
+		metrics, err := unpickleMetrics([]byte(message))
+		So(err, ShouldBeError)
+		So(metrics, ShouldBeNil)
+	})
+
+	Convey("Given truncated message, should return error", t, func() {
+		message := "\x80\x02]q\x00X\r\x00\x00\x00One.two"
+		_, err := unpickleMetrics([]byte(message))
+		So(err, ShouldBeError)
+	})
+
+	Convey("Given message with unexpected structure, should return error", t, func() {
+		messages := []string{
+			// (1234567890, 1)
+			"\x80\x02J\xd2\x02\x96IK\x01\x86q\x00.",
+			// [('One.two.three', 1)]
+			"\x80\x02]q\x00X\r\x00\x00\x00One.two.threeq\x01K\x01\x86q\x02a.",
+			// [(1, (1234567890, 1))]
+			"\x80\x02]q\x00K\x01J\xd2\x02\x96IK\x01\x86q\x01\x86q\x02a.",
+		}
+		for _, message := range messages {
+			_, err := unpickleMetrics([]byte(message))
+			So(err, ShouldBeError)
+		}
+	})
+}
+
+func TestPickleMetricLine(t *testing.T) {
+	Convey("Pickled metric should be formatted as plaintext line", t, func() {
+		metric := &pickleMetric{name: "One.two.three", timestamp: 1234567890, value: 0.5}
+		So(string(metric.line()), ShouldEqual, "One.two.three 0.5 1234567890")
+	})
+}
@@ -0,0 +1,299 @@
+package connection
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Protobuf wire types used by prometheus remote-write messages
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// prometheusNameLabel is a label containing prometheus metric name
+const prometheusNameLabel = "__name__"
+
+// PrometheusMapping describes how labels of prometheus series are flattened into moira metric names
+type PrometheusMapping struct {
+	// Tagged makes graphite tagged series "name;label1=value1;label2=value2" instead of dotted path
+	Tagged bool
+	// Prefix is prepended to every metric name
+	Prefix string
+	// Labels is an ordered list of labels whose values make up dotted path after metric name.
+	// If empty, all labels sorted by name are added to the path as "label.value" pairs
+	Labels []string
+}
+
+// prometheusLabel is a single label of prometheus series
+type prometheusLabel struct {
+	name  string
+	value string
+}
+
+// prometheusSample is a single sample of prometheus series, timestamp is in milliseconds
+type prometheusSample struct {
+	value     float64
+	timestamp int64
+}
+
+// prometheusSeries is a time series of prometheus remote-write request
+type prometheusSeries struct {
+	labels  []prometheusLabel
+	samples []prometheusSample
+}
+
+// decodeWriteRequest decodes protobuf prometheus.WriteRequest message
+func decodeWriteRequest(data []byte) ([]*prometheusSeries, error) {
+	series := make([]*prometheusSeries, 0)
+	err := decodeMessage(data, func(field, wireType uint64, value []byte) error {
+		if field != 1 {
+			return nil
+		}
+		if err := checkWireType(field, wireType, wireBytes); err != nil {
+			return err
+		}
+		timeSeries, err := decodeTimeSeries(value)
+		if err != nil {
+			return err
+		}
+		series = append(series, timeSeries)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// decodeTimeSeries decodes protobuf prometheus.TimeSeries message
+func decodeTimeSeries(data []byte) (*prometheusSeries, error) {
+	series := &prometheusSeries{}
+	err := decodeMessage(data, func(field, wireType uint64, value []byte) error {
+		switch field {
+		case 1:
+			if err := checkWireType(field, wireType, wireBytes); err != nil {
+				return err
+			}
+			label, err := decodeLabel(value)
+			if err != nil {
+				return fmt.Errorf("invalid label: %s", err.Error())
+			}
+			series.labels = append(series.labels, label)
+		case 2:
+			if err := checkWireType(field, wireType, wireBytes); err != nil {
+				return err
+			}
+			sample, err := decodeSample(value)
+			if err != nil {
+				return fmt.Errorf("invalid sample: %s", err.Error())
+			}
+			series.samples = append(series.samples, sample)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// decodeLabel decodes protobuf prometheus.Label message
+func decodeLabel(data []byte) (prometheusLabel, error) {
+	label := prometheusLabel{}
+	err := decodeMessage(data, func(field, wireType uint64, value []byte) error {
+		switch field {
+		case 1:
+			if err := checkWireType(field, wireType, wireBytes); err != nil {
+				return err
+			}
+			label.name = string(value)
+		case 2:
+			if err := checkWireType(field, wireType, wireBytes); err != nil {
+				return err
+			}
+			label.value = string(value)
+		}
+		return nil
+	})
+	return label, err
+}
+
+// decodeSample decodes protobuf prometheus.Sample message
+func decodeSample(data []byte) (prometheusSample, error) {
+	sample := prometheusSample{}
+	err := decodeMessage(data, func(field, wireType uint64, value []byte) error {
+		switch field {
+		case 1:
+			if err := checkWireType(field, wireType, wireFixed64); err != nil {
+				return err
+			}
+			sample.value = math.Float64frombits(binary.LittleEndian.Uint64(value))
+		case 2:
+			if err := checkWireType(field, wireType, wireVarint); err != nil {
+				return err
+			}
+			timestamp, n := binary.Uvarint(value)
+			if n <= 0 {
+				return fmt.Errorf("invalid timestamp")
+			}
+			sample.timestamp = int64(timestamp)
+		}
+		return nil
+	})
+	return sample, err
+}
+
+// checkWireType returns error if field has wire type other than expected one
+func checkWireType(field, wireType, expected uint64) error {
+	if wireType != expected {
+		return fmt.Errorf("field %d has wire type %d instead of %d", field, wireType, expected)
+	}
+	return nil
+}
+
+// decodeMessage walks through fields of protobuf message and calls handleField for every field with its wire type.
+// Value of varint field is passed as its raw encoding, fixed fields are passed as little endian bytes of their size
+func decodeMessage(data []byte, handleField func(field, wireType uint64, value []byte) error) error {
+	for pos := 0; pos < len(data); {
+		key, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return fmt.Errorf("invalid field key at position %d", pos)
+		}
+		pos += n
+		field, wireType := key>>3, key&7
+		var value []byte
+		switch wireType {
+		case wireVarint:
+			_, n = binary.Uvarint(data[pos:])
+			if n <= 0 {
+				return fmt.Errorf("invalid varint at position %d", pos)
+			}
+			value = data[pos : pos+n]
+			pos += n
+		case wireFixed64:
+			if len(data)-pos < 8 {
+				return fmt.Errorf("unexpected end of message at position %d", pos)
+			}
+			value = data[pos : pos+8]
+			pos += 8
+		case wireFixed32:
+			if len(data)-pos < 4 {
+				return fmt.Errorf("unexpected end of message at position %d", pos)
+			}
+			value = data[pos : pos+4]
+			pos += 4
+		case wireBytes:
+			length, n := binary.Uvarint(data[pos:])
+			if n <= 0 {
+				return fmt.Errorf("invalid length at position %d", pos)
+			}
+			pos += n
+			if uint64(len(data)-pos) < length {
+				return fmt.Errorf("unexpected end of message at position %d", pos)
+			}
+			value = data[pos : pos+int(length)]
+			pos += int(length)
+		default:
+			return fmt.Errorf("unsupported wire type %d at position %d", wireType, pos)
+		}
+		if err := handleField(field, wireType, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metricName flattens series labels into moira metric name, returns empty string if series has no name
+func (mapping *PrometheusMapping) metricName(labels []prometheusLabel) string {
+	labelValues := make(map[string]string, len(labels))
+	for _, label := range labels {
+		if label.value != "" {
+			labelValues[label.name] = label.value
+		}
+	}
+	name := sanitizeNamePart(labelValues[prometheusNameLabel], !mapping.Tagged)
+	if name == "" {
+		return ""
+	}
+	delete(labelValues, prometheusNameLabel)
+	if mapping.Prefix != "" {
+		name = mapping.Prefix + "." + name
+	}
+
+	labelNames := mapping.Labels
+	if len(labelNames) == 0 {
+		labelNames = make([]string, 0, len(labelValues))
+		for labelName := range labelValues {
+			labelNames = append(labelNames, labelName)
+		}
+		sort.Strings(labelNames)
+	}
+
+	metric := make([]byte, 0, 128)
+	metric = append(metric, name...)
+	for _, labelName := range labelNames {
+		value, ok := labelValues[labelName]
+		if !ok {
+			continue
+		}
+		switch {
+		case mapping.Tagged:
+			metric = append(metric, ';')
+			metric = append(metric, sanitizeNamePart(labelName, true)...)
+			metric = append(metric, '=')
+			metric = append(metric, sanitizeNamePart(value, false)...)
+		case len(mapping.Labels) == 0:
+			metric = append(metric, '.')
+			metric = append(metric, sanitizeNamePart(labelName, true)...)
+			metric = append(metric, '.')
+			metric = append(metric, sanitizeNamePart(value, true)...)
+		default:
+			metric = append(metric, '.')
+			metric = append(metric, sanitizeNamePart(value, true)...)
+		}
+	}
+	return string(metric)
+}
+
+// lines formats samples of series as graphite plaintext protocol lines, NaN samples (including stale markers) are skipped
+func (mapping *PrometheusMapping) lines(series *prometheusSeries) [][]byte {
+	name := mapping.metricName(series.labels)
+	if name == "" {
+		return nil
+	}
+	lines := make([][]byte, 0, len(series.samples))
+	for _, sample := range series.samples {
+		if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+			continue
+		}
+		line := make([]byte, 0, len(name)+32)
+		line = append(line, name...)
+		line = append(line, ' ')
+		line = strconv.AppendFloat(line, sample.value, 'f', -1, 64)
+		line = append(line, ' ')
+		line = strconv.AppendInt(line, sample.timestamp/1000, 10)
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// sanitizeNamePart replaces characters not allowed in metric name part with underscore,
+// dots are replaced too if name is used as a single part of dotted path
+func sanitizeNamePart(name string, replaceDots bool) string {
+	sanitized := []byte(name)
+	for i, c := range sanitized {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '-', c == ':':
+		case c == '.' && !replaceDots:
+		default:
+			sanitized[i] = '_'
+		}
+	}
+	return string(sanitized)
+}
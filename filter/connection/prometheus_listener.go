@@ -0,0 +1,121 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/golang/snappy"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite"
+)
+
+// PrometheusWritePath is a path of prometheus remote-write endpoint
+const PrometheusWritePath = "/api/v1/write"
+
+// maxPrometheusRequestSize limits size of compressed and decompressed remote-write request body
+const maxPrometheusRequestSize = 32 * 1024 * 1024
+
+// PrometheusMetricsListener receives samples sent by prometheus remote-write
+type PrometheusMetricsListener struct {
+	listener net.Listener
+	server   *http.Server
+	mapping  *PrometheusMapping
+	logger   moira.Logger
+	metrics  *graphite.FilterMetrics
+	lineChan chan<- []byte
+	done     chan struct{}
+}
+
+// NewPrometheusListener creates new prometheus remote-write listener
+func NewPrometheusListener(port string, mapping *PrometheusMapping, logger moira.Logger, metrics *graphite.FilterMetrics) (*PrometheusMetricsListener, error) {
+	newListener, err := net.Listen("tcp", port)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on [%s]: %s", port, err.Error())
+	}
+	listener := PrometheusMetricsListener{
+		listener: newListener,
+		mapping:  mapping,
+		logger:   logger,
+		metrics:  metrics,
+		done:     make(chan struct{}),
+	}
+	return &listener, nil
+}
+
+// Listen serves remote-write requests, all received samples are sent to lineChan as plaintext lines,
+// lineChan is not closed on stop, it is owned by MetricsListener
+func (listener *PrometheusMetricsListener) Listen(lineChan chan<- []byte) {
+	listener.lineChan = lineChan
+	mux := http.NewServeMux()
+	mux.HandleFunc(PrometheusWritePath, listener.handleWrite)
+	listener.server = &http.Server{Handler: mux}
+	go func() {
+		defer close(listener.done)
+		if err := listener.server.Serve(listener.listener); err != nil && err != http.ErrServerClosed {
+			listener.logger.Errorf("Prometheus listener failed: %s", err.Error())
+		}
+	}()
+	listener.logger.Info("Moira Filter Prometheus Listener Started")
+}
+
+// Stop stops serving requests and waits for handling of already received ones
+func (listener *PrometheusMetricsListener) Stop() error {
+	listener.logger.Info("Stopping prometheus listener...")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := listener.server.Shutdown(ctx)
+	<-listener.done
+	listener.logger.Info("Moira Filter Prometheus Listener stopped")
+	return err
+}
+
+func (listener *PrometheusMetricsListener) handleWrite(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	listener.metrics.PrometheusRequestsReceived.Inc(1)
+	series, err := readWriteRequest(request.Body)
+	if err != nil {
+		listener.metrics.PrometheusRequestsMalformed.Inc(1)
+		listener.logger.Infof("cannot decode prometheus remote-write request from %s: %s", request.RemoteAddr, err.Error())
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, timeSeries := range series {
+		listener.metrics.PrometheusSamplesReceived.Inc(int64(len(timeSeries.samples)))
+		for _, line := range listener.mapping.lines(timeSeries) {
+			listener.lineChan <- line
+		}
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// readWriteRequest reads and decodes snappy compressed protobuf prometheus.WriteRequest
+func readWriteRequest(body io.Reader) ([]*prometheusSeries, error) {
+	compressed, err := ioutil.ReadAll(io.LimitReader(body, maxPrometheusRequestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %s", err.Error())
+	}
+	if len(compressed) > maxPrometheusRequestSize {
+		return nil, fmt.Errorf("request body is bigger than %d bytes", maxPrometheusRequestSize)
+	}
+	decodedLen, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress request body: %s", err.Error())
+	}
+	if decodedLen > maxPrometheusRequestSize {
+		return nil, fmt.Errorf("decompressed request body is bigger than %d bytes", maxPrometheusRequestSize)
+	}
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress request body: %s", err.Error())
+	}
+	return decodeWriteRequest(data)
+}
@@ -0,0 +1,178 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/golang/snappy"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDecodeWriteRequest(t *testing.T) {
+	Convey("Given valid write request, should decode series", t, func() {
+		request := encodeWriteRequest(
+			encodeTimeSeries(
+				[]prometheusLabel{{"__name__", "http_requests_total"}, {"job", "api"}},
+				[]prometheusSample{{1.5, 1234567890000}, {2, 1234567950000}},
+			),
+			encodeTimeSeries(
+				[]prometheusLabel{{"__name__", "up"}},
+				[]prometheusSample{{-1, -1000}},
+			),
+		)
+		series, err := decodeWriteRequest(request)
+		So(err, ShouldBeNil)
+		So(series, ShouldResemble, []*prometheusSeries{
+			{
+				labels:  []prometheusLabel{{"__name__", "http_requests_total"}, {"job", "api"}},
+				samples: []prometheusSample{{1.5, 1234567890000}, {2, 1234567950000}},
+			},
+			{
+				labels:  []prometheusLabel{{"__name__", "up"}},
+				samples: []prometheusSample{{-1, -1000}},
+			},
+		})
+	})
+
+	Convey("Given truncated write request, should return error", t, func() {
+		request := encodeWriteRequest(encodeTimeSeries([]prometheusLabel{{"__name__", "up"}}, []prometheusSample{{1, 1000}}))
+		_, err := decodeWriteRequest(request[:len(request)-3])
+		So(err, ShouldBeError)
+	})
+
+	Convey("Given write request truncated at any position, should not panic", t, func() {
+		request := encodeWriteRequest(encodeTimeSeries([]prometheusLabel{{"__name__", "up"}}, []prometheusSample{{1, 1000}, {2, 2000}}))
+		for length := 0; length < len(request); length++ {
+			So(func() { decodeWriteRequest(request[:length]) }, ShouldNotPanic)
+		}
+	})
+
+	Convey("Given fields of unexpected wire types, should return error", t, func() {
+		sampleWithTimestamp := func(sample []byte) []byte {
+			return appendBytesField(nil, 2, sample)
+		}
+		invalidSeries := map[string][]byte{
+			"series as varint":           appendVarint(appendVarint(nil, 1<<3|wireVarint), 1),
+			"label as varint":            appendVarint(appendVarint(nil, 1<<3|wireVarint), 1),
+			"label name as fixed32":      appendBytesField(nil, 1, append(appendVarint(nil, 1<<3|wireFixed32), 0, 0, 0, 0)),
+			"sample value as varint":     sampleWithTimestamp(appendVarint(appendVarint(nil, 1<<3|wireVarint), 1)),
+			"sample value as fixed32":    sampleWithTimestamp(append(appendVarint(nil, 1<<3|wireFixed32), 0, 0, 0, 0)),
+			"sample value as bytes":      sampleWithTimestamp(appendBytesField(nil, 1, []byte{1, 2})),
+			"timestamp as fixed64":       sampleWithTimestamp(append(appendVarint(nil, 2<<3|wireFixed64), 0, 0, 0, 0, 0, 0, 0, 0)),
+			"timestamp as bytes":         sampleWithTimestamp(appendBytesField(nil, 2, []byte{1})),
+			"sample with short value":    sampleWithTimestamp(append(appendVarint(nil, 1<<3|wireFixed64), 0, 0, 0)),
+			"sample with unended varint": sampleWithTimestamp(append(appendVarint(nil, 2<<3|wireVarint), 0x80, 0x80)),
+		}
+		for name, series := range invalidSeries {
+			request := series
+			if name != "series as varint" {
+				request = encodeWriteRequest(series)
+			}
+			Convey(name, func() {
+				var err error
+				So(func() { _, err = decodeWriteRequest(request) }, ShouldNotPanic)
+				So(err, ShouldBeError)
+			})
+		}
+	})
+
+	Convey("Given random bytes, should not panic", t, func() {
+		random := rand.New(rand.NewSource(1))
+		request := encodeWriteRequest(encodeTimeSeries([]prometheusLabel{{"__name__", "up"}}, []prometheusSample{{1, 1000}}))
+		So(func() {
+			for i := 0; i < 10000; i++ {
+				data := append([]byte{}, request...)
+				for j := 0; j < 3; j++ {
+					data[random.Intn(len(data))] = byte(random.Intn(256))
+				}
+				decodeWriteRequest(data)
+			}
+		}, ShouldNotPanic)
+	})
+
+	Convey("Given snappy compressed write request, should decompress and decode it", t, func() {
+		request := encodeWriteRequest(encodeTimeSeries([]prometheusLabel{{"__name__", "up"}}, []prometheusSample{{1, 1000}}))
+		series, err := readWriteRequest(bytes.NewReader(snappy.Encode(nil, request)))
+		So(err, ShouldBeNil)
+		So(series, ShouldHaveLength, 1)
+
+		_, err = readWriteRequest(bytes.NewReader(request))
+		So(err, ShouldBeError)
+	})
+}
+
+func TestPrometheusMapping(t *testing.T) {
+	labels := []prometheusLabel{{"instance", "host-1.example.com:9100"}, {"__name__", "node_load1"}, {"job", "node"}, {"empty", ""}}
+
+	Convey("Without labels list, should add all labels sorted by name", t, func() {
+		mapping := &PrometheusMapping{}
+		So(mapping.metricName(labels), ShouldEqual, "node_load1.instance.host-1_example_com:9100.job.node")
+	})
+
+	Convey("With labels list, should add values of given labels in given order", t, func() {
+		mapping := &PrometheusMapping{Prefix: "prometheus", Labels: []string{"job", "dc", "instance"}}
+		So(mapping.metricName(labels), ShouldEqual, "prometheus.node_load1.node.host-1_example_com:9100")
+	})
+
+	Convey("Tagged mapping should make tagged series", t, func() {
+		mapping := &PrometheusMapping{Tagged: true}
+		So(mapping.metricName(labels), ShouldEqual, "node_load1;instance=host-1.example.com:9100;job=node")
+	})
+
+	Convey("Series without name should be skipped", t, func() {
+		mapping := &PrometheusMapping{}
+		So(mapping.metricName([]prometheusLabel{{"job", "node"}}), ShouldBeEmpty)
+		So(mapping.lines(&prometheusSeries{labels: []prometheusLabel{{"job", "node"}}, samples: []prometheusSample{{1, 1000}}}), ShouldBeEmpty)
+	})
+
+	Convey("Samples should be formatted as plaintext lines without NaN values", t, func() {
+		mapping := &PrometheusMapping{}
+		series := &prometheusSeries{
+			labels:  []prometheusLabel{{"__name__", "up"}},
+			samples: []prometheusSample{{1, 1234567890123}, {math.NaN(), 1234567950000}, {0.25, 1234568010000}},
+		}
+		So(mapping.lines(series), ShouldResemble, [][]byte{[]byte("up 1 1234567890"), []byte("up 0.25 1234568010")})
+	})
+}
+
+func encodeWriteRequest(series ...[]byte) []byte {
+	request := make([]byte, 0)
+	for _, timeSeries := range series {
+		request = appendBytesField(request, 1, timeSeries)
+	}
+	return request
+}
+
+func encodeTimeSeries(labels []prometheusLabel, samples []prometheusSample) []byte {
+	series := make([]byte, 0)
+	for _, label := range labels {
+		encodedLabel := appendBytesField(nil, 1, []byte(label.name))
+		encodedLabel = appendBytesField(encodedLabel, 2, []byte(label.value))
+		series = appendBytesField(series, 1, encodedLabel)
+	}
+	for _, sample := range samples {
+		encodedSample := appendVarint(nil, 1<<3|wireFixed64)
+		value := make([]byte, 8)
+		binary.LittleEndian.PutUint64(value, math.Float64bits(sample.value))
+		encodedSample = append(encodedSample, value...)
+		encodedSample = appendVarint(encodedSample, 2<<3|wireVarint)
+		encodedSample = appendVarint(encodedSample, uint64(sample.timestamp))
+		series = appendBytesField(series, 2, encodedSample)
+	}
+	return series
+}
+
+func appendBytesField(message []byte, field uint64, value []byte) []byte {
+	message = appendVarint(message, field<<3|wireBytes)
+	message = appendVarint(message, uint64(len(value)))
+	return append(message, value...)
+}
+
+func appendVarint(message []byte, value uint64) []byte {
+	buffer := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buffer, value)
+	return append(message, buffer[:n]...)
+}
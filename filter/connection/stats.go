@@ -0,0 +1,197 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/moira-alert/moira/tags"
+)
+
+// RateLimitPolicy is an action applied to lines exceeding max lines per second of connection
+type RateLimitPolicy string
+
+const (
+	// RateLimitStall stops reading from connection until next second, so client is slowed down by TCP backpressure
+	RateLimitStall RateLimitPolicy = "stall"
+	// RateLimitDrop drops lines exceeding limit
+	RateLimitDrop RateLimitPolicy = "drop"
+)
+
+// ConnectionLimits is a configuration of per connection rate limiter
+type ConnectionLimits struct {
+	// MaxLinesPerSecond is a max number of lines read from single connection per second, 0 disables limiter
+	MaxLinesPerSecond int
+	Policy            RateLimitPolicy
+}
+
+func (limits ConnectionLimits) validate() error {
+	if limits.MaxLinesPerSecond < 0 {
+		return fmt.Errorf("max lines per second should not be negative, got %d", limits.MaxLinesPerSecond)
+	}
+	switch limits.Policy {
+	case RateLimitStall, RateLimitDrop:
+		return nil
+	case "":
+		if limits.MaxLinesPerSecond == 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown rate limit policy '%s'", limits.Policy)
+}
+
+// ConnectionStats is a snapshot of ingestion stats of single connection
+type ConnectionStats struct {
+	RemoteAddr   string `json:"remote_addr"`
+	Client       string `json:"client,omitempty"`
+	ConnectedAt  int64  `json:"connected_at"`
+	Lines        int64  `json:"lines"`
+	Bytes        int64  `json:"bytes"`
+	ParseErrors  int64  `json:"parse_errors"`
+	DroppedLines int64  `json:"dropped_lines"`
+	StalledMs    int64  `json:"stalled_ms"`
+	BlockedMs    int64  `json:"blocked_ms"`
+}
+
+// ConnectionsStats keeps ingestion stats of open plaintext connections, it is safe for concurrent use
+type ConnectionsStats struct {
+	mu          sync.Mutex
+	connections map[*connectionStats]struct{}
+}
+
+// connectionStats are counters of single connection, they are updated atomically by connection handler
+type connectionStats struct {
+	remoteAddr   string
+	client       string
+	connectedAt  time.Time
+	lines        int64
+	bytes        int64
+	parseErrors  int64
+	droppedLines int64
+	stalled      int64
+	blocked      int64
+}
+
+// NewConnectionsStats creates empty connections stats
+func NewConnectionsStats() *ConnectionsStats {
+	return &ConnectionsStats{connections: make(map[*connectionStats]struct{})}
+}
+
+// add registers new connection, counters of connection are not registered if stats is nil
+func (stats *ConnectionsStats) add(remoteAddr, client string) *connectionStats {
+	connection := &connectionStats{remoteAddr: remoteAddr, client: client, connectedAt: time.Now()}
+	if stats == nil {
+		return connection
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.connections[connection] = struct{}{}
+	return connection
+}
+
+// remove unregisters closed connection
+func (stats *ConnectionsStats) remove(connection *connectionStats) {
+	if stats == nil {
+		return
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	delete(stats.connections, connection)
+}
+
+// Snapshot returns stats of open connections sorted by number of received lines in descending order
+func (stats *ConnectionsStats) Snapshot() []ConnectionStats {
+	stats.mu.Lock()
+	snapshot := make([]ConnectionStats, 0, len(stats.connections))
+	for connection := range stats.connections {
+		snapshot = append(snapshot, connection.snapshot())
+	}
+	stats.mu.Unlock()
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].Lines != snapshot[j].Lines {
+			return snapshot[i].Lines > snapshot[j].Lines
+		}
+		return snapshot[i].RemoteAddr < snapshot[j].RemoteAddr
+	})
+	return snapshot
+}
+
+// ServeHTTP writes stats of open connections as JSON
+func (stats *ConnectionsStats) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(stats.Snapshot())
+}
+
+func (connection *connectionStats) snapshot() ConnectionStats {
+	return ConnectionStats{
+		RemoteAddr:   connection.remoteAddr,
+		Client:       connection.client,
+		ConnectedAt:  connection.connectedAt.Unix(),
+		Lines:        atomic.LoadInt64(&connection.lines),
+		Bytes:        atomic.LoadInt64(&connection.bytes),
+		ParseErrors:  atomic.LoadInt64(&connection.parseErrors),
+		DroppedLines: atomic.LoadInt64(&connection.droppedLines),
+		StalledMs:    time.Duration(atomic.LoadInt64(&connection.stalled)).Nanoseconds() / int64(time.Millisecond),
+		BlockedMs:    time.Duration(atomic.LoadInt64(&connection.blocked)).Nanoseconds() / int64(time.Millisecond),
+	}
+}
+
+// rateLimiter counts lines read in current second
+type rateLimiter struct {
+	maxLines    int
+	windowStart time.Time
+	lines       int
+}
+
+func newRateLimiter(limits ConnectionLimits) *rateLimiter {
+	if limits.MaxLinesPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{maxLines: limits.MaxLinesPerSecond}
+}
+
+// take returns zero if line is within limit, otherwise it returns time left until limit is reset
+func (limiter *rateLimiter) take(now time.Time) time.Duration {
+	if now.Sub(limiter.windowStart) >= time.Second {
+		limiter.windowStart = now
+		limiter.lines = 0
+	}
+	if limiter.lines < limiter.maxLines {
+		limiter.lines++
+		return 0
+	}
+	return limiter.windowStart.Add(time.Second).Sub(now)
+}
+
+// isValidPlaintextLine checks that line "<metric> <value> <timestamp>" can be parsed by filter:
+// items are separated by single spaces, only printable ascii chars are used, metric name is not empty,
+// tagged metric name is valid, value is a number and timestamp is a non-zero number
+func isValidPlaintextLine(line []byte) bool {
+	for _, b := range line {
+		r := rune(b)
+		if r > unicode.MaxASCII || !strconv.IsPrint(r) {
+			return false
+		}
+	}
+	fields := bytes.Split(line, []byte{' '})
+	if len(fields) != 3 || len(fields[0]) == 0 {
+		return false
+	}
+	if bytes.IndexByte(fields[0], ';') >= 0 {
+		if _, _, err := tags.ParseTaggedMetric(string(fields[0])); err != nil {
+			return false
+		}
+	}
+	if _, err := strconv.ParseFloat(string(fields[1]), 64); err != nil {
+		return false
+	}
+	timestamp, err := strconv.ParseFloat(string(fields[2]), 64)
+	return err == nil && int64(timestamp) != 0
+}
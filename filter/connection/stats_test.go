@@ -0,0 +1,110 @@
+package connection
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConnectionLimits(t *testing.T) {
+	Convey("Given valid limits, should not return error", t, func() {
+		So(ConnectionLimits{}.validate(), ShouldBeNil)
+		So(ConnectionLimits{MaxLinesPerSecond: 10, Policy: RateLimitStall}.validate(), ShouldBeNil)
+		So(ConnectionLimits{MaxLinesPerSecond: 10, Policy: RateLimitDrop}.validate(), ShouldBeNil)
+	})
+
+	Convey("Given invalid limits, should return error", t, func() {
+		So(ConnectionLimits{MaxLinesPerSecond: -1, Policy: RateLimitDrop}.validate(), ShouldBeError)
+		So(ConnectionLimits{MaxLinesPerSecond: 10}.validate(), ShouldBeError)
+		So(ConnectionLimits{MaxLinesPerSecond: 10, Policy: "block"}.validate(), ShouldBeError)
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	Convey("Given no limit, should not create limiter", t, func() {
+		So(newRateLimiter(ConnectionLimits{}), ShouldBeNil)
+	})
+
+	Convey("Given limit, should allow lines within current second", t, func() {
+		limiter := newRateLimiter(ConnectionLimits{MaxLinesPerSecond: 2, Policy: RateLimitDrop})
+		now := time.Unix(1234567890, 0)
+		So(limiter.take(now), ShouldEqual, 0)
+		So(limiter.take(now.Add(100*time.Millisecond)), ShouldEqual, 0)
+		So(limiter.take(now.Add(400*time.Millisecond)), ShouldEqual, 600*time.Millisecond)
+		So(limiter.take(now.Add(time.Second)), ShouldEqual, 0)
+	})
+}
+
+func TestIsValidPlaintextLine(t *testing.T) {
+	Convey("Should check format of plaintext line", t, func() {
+		So(isValidPlaintextLine([]byte("One.two 1 1234567890")), ShouldBeTrue)
+		So(isValidPlaintextLine([]byte("One.two;tag=value 1.5 1234567890.5")), ShouldBeTrue)
+		So(isValidPlaintextLine([]byte("One.two 1")), ShouldBeFalse)
+		So(isValidPlaintextLine([]byte("One.two one 1234567890")), ShouldBeFalse)
+		So(isValidPlaintextLine([]byte("One.two 1 now")), ShouldBeFalse)
+		So(isValidPlaintextLine([]byte("")), ShouldBeFalse)
+		So(isValidPlaintextLine([]byte("One.two  1 1234567890")), ShouldBeFalse)
+		So(isValidPlaintextLine([]byte("One.two 1 1234567890 ")), ShouldBeFalse)
+		So(isValidPlaintextLine([]byte(" 1 1234567890")), ShouldBeFalse)
+		So(isValidPlaintextLine([]byte("One.two\t1 1234567890")), ShouldBeFalse)
+		So(isValidPlaintextLine([]byte("One.two;tag 1 1234567890")), ShouldBeFalse)
+		So(isValidPlaintextLine([]byte("One.two 1 0")), ShouldBeFalse)
+	})
+}
+
+func TestHandlerStats(t *testing.T) {
+	logger, _ := logging.GetLogger("Handler")
+
+	Convey("Given handler with stats, should count lines, bytes and parse errors of connection", t, func() {
+		stats := NewConnectionsStats()
+		handler, err := newPlaintextHandler(logger, ConnectionLimits{}, stats)
+		So(err, ShouldBeNil)
+		lineChan := make(chan []byte, 10)
+		server, client := net.Pipe()
+		handler.HandleConnection(server, lineChan)
+
+		client.Write([]byte("One.two 1 1234567890\nMalformed\n"))
+		So(string(receiveLine(lineChan)), ShouldEqual, "One.two 1 1234567890")
+		So(string(receiveLine(lineChan)), ShouldEqual, "Malformed")
+
+		snapshot := stats.Snapshot()
+		So(snapshot, ShouldHaveLength, 1)
+		So(snapshot[0].Lines, ShouldEqual, 2)
+		So(snapshot[0].Bytes, ShouldEqual, 31)
+		So(snapshot[0].ParseErrors, ShouldEqual, 1)
+
+		recorder := httptest.NewRecorder()
+		stats.ServeHTTP(recorder, httptest.NewRequest("GET", "/connections", nil))
+		So(recorder.Body.String(), ShouldContainSubstring, `"lines":2`)
+
+		client.Close()
+		handler.StopHandlingConnections()
+		So(stats.Snapshot(), ShouldBeEmpty)
+	})
+
+	Convey("Given handler with drop policy, should drop lines exceeding limit", t, func() {
+		stats := NewConnectionsStats()
+		handler, err := newPlaintextHandler(logger, ConnectionLimits{MaxLinesPerSecond: 2, Policy: RateLimitDrop}, stats)
+		So(err, ShouldBeNil)
+		lineChan := make(chan []byte, 10)
+		server, client := net.Pipe()
+		handler.HandleConnection(server, lineChan)
+
+		client.Write([]byte(strings.Repeat("One.two 1 1234567890\n", 5)))
+		for i := 0; i < 50 && stats.Snapshot()[0].Lines < 5; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		snapshot := stats.Snapshot()
+		So(snapshot[0].Lines, ShouldEqual, 5)
+		So(snapshot[0].DroppedLines, ShouldEqual, 3)
+		So(len(lineChan), ShouldEqual, 2)
+
+		client.Close()
+		handler.StopHandlingConnections()
+	})
+}
@@ -0,0 +1,186 @@
+package connection
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite"
+)
+
+const (
+	tlsHandshakeTimeout = 10 * time.Second
+	anonymousClientName = "anonymous"
+)
+
+var unsafeClientNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// TLSConfig is a configuration of graphite plaintext over TLS listener
+type TLSConfig struct {
+	// Listen is a listener uri
+	Listen string
+	// CertFile and KeyFile are paths of PEM encoded server certificate and its private key
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a path of PEM encoded certificates of CAs verifying client certificates, leave empty to disable verification
+	ClientCAFile string
+	// RequireClientCert makes listener reject clients without valid certificate
+	RequireClientCert bool
+}
+
+// TLSMetricsListener accepts TLS connections of clients sending metrics in graphite plaintext protocol,
+// connections and lines are counted per common name of client certificate
+type TLSMetricsListener struct {
+	listener  *net.TCPListener
+	tlsConfig *tls.Config
+	handler   *Handler
+	logger    moira.Logger
+	tomb      tomb.Tomb
+	metrics   *graphite.FilterMetrics
+	clientsMu sync.Mutex
+}
+
+// NewTLSListener creates new TLS listener, stats of its connections are kept in stats if it is not nil
+func NewTLSListener(config TLSConfig, limits ConnectionLimits, stats *ConnectionsStats, logger moira.Logger, metrics *graphite.FilterMetrics) (*TLSMetricsListener, error) {
+	tlsConfig, err := config.build()
+	if err != nil {
+		return nil, err
+	}
+	handler, err := newPlaintextHandler(logger, limits, stats)
+	if err != nil {
+		return nil, err
+	}
+	address, err := net.ResolveTCPAddr("tcp", config.Listen)
+	if nil != err {
+		return nil, fmt.Errorf("failed to resolve tcp address [%s]: %s", config.Listen, err.Error())
+	}
+	newListener, err := net.ListenTCP("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on [%s]: %s", config.Listen, err.Error())
+	}
+	listener := TLSMetricsListener{
+		listener:  newListener,
+		tlsConfig: tlsConfig,
+		logger:    logger,
+		handler:   handler,
+		metrics:   metrics,
+	}
+	return &listener, nil
+}
+
+func (config TLSConfig) build() (*tls.Config, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, fmt.Errorf("tls certificate and key files are required")
+	}
+	certificate, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tls certificate [%s] and key [%s]: %s", config.CertFile, config.KeyFile, err.Error())
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+		ClientAuth:   tls.NoClientCert,
+	}
+	if config.ClientCAFile == "" {
+		if config.RequireClientCert {
+			return nil, fmt.Errorf("client CA file is required to verify client certificates")
+		}
+		return tlsConfig, nil
+	}
+	caCerts, err := ioutil.ReadFile(config.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file [%s]: %s", config.ClientCAFile, err.Error())
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(caCerts) {
+		return nil, fmt.Errorf("no certificates found in client CA file [%s]", config.ClientCAFile)
+	}
+	if config.RequireClientCert {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	} else {
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// Listen waits for new connections and handles them in ConnectionHandler after TLS handshake
+// All handled lines are sent to lineChan, lineChan is not closed on stop, it is owned by MetricsListener
+func (listener *TLSMetricsListener) Listen(lineChan chan<- []byte) {
+	listener.tomb.Go(func() error {
+		for {
+			select {
+			case <-listener.tomb.Dying():
+				{
+					listener.logger.Info("Stopping tls listener...")
+					listener.listener.Close()
+					listener.handler.StopHandlingConnections()
+					listener.logger.Info("Moira Filter TLS Listener stopped")
+					return nil
+				}
+			default:
+			}
+			listener.listener.SetDeadline(time.Now().Add(1e9))
+			conn, err := listener.listener.Accept()
+			if nil != err {
+				if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+					continue
+				}
+				listener.logger.Infof("Failed to accept tls connection: %s", err.Error())
+				continue
+			}
+			listener.handler.HandleTLSConnection(tls.Server(conn, listener.tlsConfig), lineChan, listener.handshake)
+		}
+	})
+	listener.logger.Info("Moira Filter TLS Listener Started")
+}
+
+// handshake completes TLS handshake and returns name of client and meter of lines received from it
+func (listener *TLSMetricsListener) handshake(conn *tls.Conn) (string, graphite.Meter, error) {
+	conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := conn.Handshake(); err != nil {
+		listener.metrics.TLSHandshakesFailed.Inc(1)
+		return "", nil, fmt.Errorf("tls handshake with %s failed: %s", conn.RemoteAddr(), err.Error())
+	}
+	conn.SetDeadline(time.Time{})
+
+	clientName := getClientName(conn.ConnectionState())
+	listener.logger.Infof("%s connected using tls as %s", conn.RemoteAddr(), clientName)
+
+	listener.clientsMu.Lock()
+	defer listener.clientsMu.Unlock()
+	connections, found := listener.metrics.TLSClientConnections.GetMetric(clientName)
+	if !found {
+		name := unsafeClientNameChars.ReplaceAllString(clientName, "_")
+		listener.metrics.TLSClientConnections.AddMetric(clientName, fmt.Sprintf("tls.clients.%s.connections", name))
+		listener.metrics.TLSClientLines.AddMetric(clientName, fmt.Sprintf("tls.clients.%s.lines", name))
+		connections, _ = listener.metrics.TLSClientConnections.GetMetric(clientName)
+	}
+	connections.Mark(1)
+	lines, _ := listener.metrics.TLSClientLines.GetMetric(clientName)
+	return clientName, lines, nil
+}
+
+// getClientName returns common name of verified client certificate
+func getClientName(state tls.ConnectionState) string {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return anonymousClientName
+	}
+	if commonName := state.VerifiedChains[0][0].Subject.CommonName; commonName != "" {
+		return commonName
+	}
+	return anonymousClientName
+}
+
+// Stop stops listening connections
+func (listener *TLSMetricsListener) Stop() error {
+	listener.tomb.Kill(nil)
+	return listener.tomb.Wait()
+}
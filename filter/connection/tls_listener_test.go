@@ -0,0 +1,172 @@
+package connection
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+)
+
+func TestTLSListener(t *testing.T) {
+	logger, _ := logging.GetLogger("TLSListener")
+	filterMetrics := metrics.ConfigureFilterMetrics("test")
+
+	dir, err := ioutil.TempDir("", "moira-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, caKey := generateCertificate(t, "Moira CA", nil, nil)
+	server, serverKey := generateCertificate(t, "localhost", ca, caKey)
+	client, clientKey := generateCertificate(t, "collector.example.com", ca, caKey)
+	writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", ca.Raw)
+	writePEM(t, filepath.Join(dir, "server.pem"), "CERTIFICATE", server.Raw)
+	writePEM(t, filepath.Join(dir, "server.key"), "EC PRIVATE KEY", marshalKey(t, serverKey))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	clientCert := tls.Certificate{Certificate: [][]byte{client.Raw}, PrivateKey: clientKey}
+
+	config := TLSConfig{
+		Listen:            "127.0.0.1:0",
+		CertFile:          filepath.Join(dir, "server.pem"),
+		KeyFile:           filepath.Join(dir, "server.key"),
+		ClientCAFile:      filepath.Join(dir, "ca.pem"),
+		RequireClientCert: true,
+	}
+
+	Convey("Given invalid config, should return error", t, func() {
+		_, err := NewTLSListener(TLSConfig{Listen: "127.0.0.1:0"}, ConnectionLimits{}, nil, logger, filterMetrics)
+		So(err, ShouldBeError)
+		_, err = NewTLSListener(TLSConfig{Listen: "127.0.0.1:0", CertFile: config.CertFile, KeyFile: config.KeyFile, RequireClientCert: true}, ConnectionLimits{}, nil, logger, filterMetrics)
+		So(err, ShouldBeError)
+		_, err = NewTLSListener(TLSConfig{Listen: "127.0.0.1:0", CertFile: config.CertFile, KeyFile: config.CertFile}, ConnectionLimits{}, nil, logger, filterMetrics)
+		So(err, ShouldBeError)
+	})
+
+	Convey("Given listener requiring client certificate", t, func() {
+		listener, err := NewTLSListener(config, ConnectionLimits{}, nil, logger, filterMetrics)
+		So(err, ShouldBeNil)
+		lineChan := make(chan []byte, 10)
+		listener.Listen(lineChan)
+		defer listener.Stop()
+		address := listener.listener.Addr().String()
+
+		Convey("Client with valid certificate should send lines", func() {
+			conn, err := tls.Dial("tcp", address, &tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: []tls.Certificate{clientCert}})
+			So(err, ShouldBeNil)
+			_, err = conn.Write([]byte("One.two 1 1234567890\nThree.four 2 1234567890\n"))
+			So(err, ShouldBeNil)
+			conn.Close()
+
+			So(string(receiveLine(lineChan)), ShouldEqual, "One.two 1 1234567890")
+			So(string(receiveLine(lineChan)), ShouldEqual, "Three.four 2 1234567890")
+			connections, found := filterMetrics.TLSClientConnections.GetMetric("collector.example.com")
+			So(found, ShouldBeTrue)
+			So(connections.Count(), ShouldEqual, 1)
+			lines, _ := filterMetrics.TLSClientLines.GetMetric("collector.example.com")
+			So(lines.Count(), ShouldEqual, 2)
+		})
+
+		Convey("Client without certificate should be rejected", func() {
+			failedBefore := filterMetrics.TLSHandshakesFailed.Count()
+			conn, err := tls.Dial("tcp", address, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+			if err == nil {
+				conn.Write([]byte("One.two 1 1234567890\n"))
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				_, err = conn.Read(make([]byte, 1))
+				conn.Close()
+			}
+			So(err, ShouldNotBeNil)
+			So(receiveLine(lineChan), ShouldBeNil)
+			// Server fails handshake asynchronously to client
+			for i := 0; i < 50 && filterMetrics.TLSHandshakesFailed.Count() == failedBefore; i++ {
+				time.Sleep(20 * time.Millisecond)
+			}
+			So(filterMetrics.TLSHandshakesFailed.Count()-failedBefore, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestGetClientName(t *testing.T) {
+	Convey("Client without verified certificate should be anonymous", t, func() {
+		So(getClientName(tls.ConnectionState{}), ShouldEqual, anonymousClientName)
+	})
+
+	Convey("Client with verified certificate should be named by its common name", t, func() {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: "collector"}}
+		So(getClientName(tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}), ShouldEqual, "collector")
+	})
+}
+
+func receiveLine(lineChan chan []byte) []byte {
+	select {
+	case line := <-lineChan:
+		return line
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+// generateCertificate creates certificate signed by given parent, self-signed CA is created if parent is nil
+func generateCertificate(t *testing.T, commonName string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{commonName},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func marshalKey(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
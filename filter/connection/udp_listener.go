@@ -0,0 +1,135 @@
+package connection
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite"
+)
+
+// DefaultMaxUDPPacketSize is the largest payload of a single IPv4 UDP datagram
+const DefaultMaxUDPPacketSize = 65507
+
+// UDPMetricsListener is facade for standard net.UDPConn, it reads graphite plaintext datagrams
+// and splits them into lines
+type UDPMetricsListener struct {
+	conn          *net.UDPConn
+	maxPacketSize int
+	logger        moira.Logger
+	tomb          tomb.Tomb
+	metrics       *graphite.FilterMetrics
+}
+
+// NewUDPListener creates new UDP listener, datagrams larger than maxPacketSize are truncated
+func NewUDPListener(port string, maxPacketSize int, logger moira.Logger, metrics *graphite.FilterMetrics) (*UDPMetricsListener, error) {
+	address, err := net.ResolveUDPAddr("udp", port)
+	if nil != err {
+		return nil, fmt.Errorf("failed to resolve udp address [%s]: %s", port, err.Error())
+	}
+	conn, err := net.ListenUDP("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on udp [%s]: %s", port, err.Error())
+	}
+	if maxPacketSize <= 0 {
+		maxPacketSize = DefaultMaxUDPPacketSize
+	}
+	listener := UDPMetricsListener{
+		conn:          conn,
+		maxPacketSize: maxPacketSize,
+		logger:        logger,
+		metrics:       metrics,
+	}
+	return &listener, nil
+}
+
+// Listen reads datagrams and sends every line of them to lineChan
+// lineChan is not closed on stop, it is owned by MetricsListener
+func (listener *UDPMetricsListener) Listen(lineChan chan<- []byte) {
+	listener.tomb.Go(func() error {
+		// One extra byte lets to recognize datagrams exceeding maxPacketSize
+		buffer := make([]byte, listener.maxPacketSize+1)
+		for {
+			select {
+			case <-listener.tomb.Dying():
+				{
+					listener.logger.Info("Stopping UDP listener...")
+					listener.conn.Close()
+					listener.logger.Info("Moira Filter UDP Listener stopped")
+					return nil
+				}
+			default:
+			}
+			listener.conn.SetReadDeadline(time.Now().Add(1e9))
+			n, _, err := listener.conn.ReadFromUDP(buffer)
+			if err != nil {
+				if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+					continue
+				}
+				listener.logger.Infof("Failed to read udp packet: %s", err.Error())
+				continue
+			}
+			listener.metrics.UDPPacketsReceived.Inc(1)
+			listener.handlePacket(buffer[:n], lineChan)
+		}
+	})
+	listener.logger.Info("Moira Filter UDP Listener Started")
+}
+
+func (listener *UDPMetricsListener) handlePacket(packet []byte, lineChan chan<- []byte) {
+	lines, truncated := splitPacket(packet, listener.maxPacketSize)
+	if truncated {
+		listener.metrics.UDPPacketsTruncated.Inc(1)
+	}
+	for _, line := range lines {
+		if !isValidPlaintextLine(line) {
+			listener.metrics.UDPLinesMalformed.Inc(1)
+			continue
+		}
+		lineChan <- line
+	}
+}
+
+// splitPacket copies datagram and splits it to non-empty lines
+// If datagram is longer than maxPacketSize, its last incomplete line is dropped and truncated flag is returned
+func splitPacket(packet []byte, maxPacketSize int) ([][]byte, bool) {
+	truncated := len(packet) > maxPacketSize
+	if truncated {
+		packet = packet[:maxPacketSize]
+		lastLineEnd := -1
+		for i := len(packet) - 1; i >= 0; i-- {
+			if packet[i] == '\n' {
+				lastLineEnd = i
+				break
+			}
+		}
+		packet = packet[:lastLineEnd+1]
+	}
+
+	data := make([]byte, len(packet))
+	copy(data, packet)
+
+	lines := make([][]byte, 0)
+	lineStart := 0
+	for i, b := range data {
+		if b == '\n' {
+			if i > lineStart {
+				lines = append(lines, data[lineStart:i])
+			}
+			lineStart = i + 1
+		}
+	}
+	if lineStart < len(data) {
+		lines = append(lines, data[lineStart:])
+	}
+	return lines, truncated
+}
+
+// Stop stops listening udp datagrams
+func (listener *UDPMetricsListener) Stop() error {
+	listener.tomb.Kill(nil)
+	return listener.tomb.Wait()
+}
@@ -0,0 +1,87 @@
+package connection
+
+import (
+	"testing"
+
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSplitPacket(t *testing.T) {
+	Convey("Given datagram with several lines, should split it", t, func() {
+		lines, truncated := splitPacket([]byte("One.two 1 1234567890\nThree.four 2 1234567890\n"), 100)
+		So(truncated, ShouldBeFalse)
+		So(lines, ShouldResemble, [][]byte{[]byte("One.two 1 1234567890"), []byte("Three.four 2 1234567890")})
+	})
+
+	Convey("Given datagram without trailing newline, should keep last line", t, func() {
+		lines, truncated := splitPacket([]byte("One.two 1 1234567890\nThree.four 2 1234567890"), 100)
+		So(truncated, ShouldBeFalse)
+		So(lines, ShouldResemble, [][]byte{[]byte("One.two 1 1234567890"), []byte("Three.four 2 1234567890")})
+	})
+
+	Convey("Given datagram with empty lines, should skip them", t, func() {
+		lines, truncated := splitPacket([]byte("\n\nOne.two 1 1234567890\n\n"), 100)
+		So(truncated, ShouldBeFalse)
+		So(lines, ShouldResemble, [][]byte{[]byte("One.two 1 1234567890")})
+	})
+
+	Convey("Given empty datagram, should return no lines", t, func() {
+		lines, truncated := splitPacket([]byte("\n"), 100)
+		So(truncated, ShouldBeFalse)
+		So(lines, ShouldBeEmpty)
+	})
+
+	Convey("Given datagram longer than max size, should drop incomplete line", t, func() {
+		lines, truncated := splitPacket([]byte("One.two 1 1234567890\nThree.four 2 1234567890\n"), 30)
+		So(truncated, ShouldBeTrue)
+		So(lines, ShouldResemble, [][]byte{[]byte("One.two 1 1234567890")})
+	})
+
+	Convey("Given datagram longer than max size without complete lines, should return no lines", t, func() {
+		lines, truncated := splitPacket([]byte("One.two 1 1234567890\n"), 10)
+		So(truncated, ShouldBeTrue)
+		So(lines, ShouldBeEmpty)
+	})
+
+	Convey("Lines should not share memory with given datagram", t, func() {
+		packet := []byte("One.two 1 1234567890")
+		lines, _ := splitPacket(packet, 100)
+		packet[0] = 'X'
+		So(lines, ShouldResemble, [][]byte{[]byte("One.two 1 1234567890")})
+	})
+}
+
+func TestHandlePacket(t *testing.T) {
+	listener := &UDPMetricsListener{maxPacketSize: 110, metrics: metrics.ConfigureFilterMetrics("test")}
+
+	Convey("Given datagram with malformed lines, should count and skip every malformed line", t, func() {
+		malformed := listener.metrics.UDPLinesMalformed.Count()
+		truncated := listener.metrics.UDPPacketsTruncated.Count()
+		lineChan := make(chan []byte, 10)
+
+		listener.handlePacket([]byte("One.two 1 1234567890\nmalformed\nThree.four  1234567890\nFive.six 3 1234567890 extra\nSeven.eight 4 1234567890"), lineChan)
+		close(lineChan)
+
+		lines := make([][]byte, 0)
+		for line := range lineChan {
+			lines = append(lines, line)
+		}
+		So(lines, ShouldResemble, [][]byte{[]byte("One.two 1 1234567890"), []byte("Seven.eight 4 1234567890")})
+		So(listener.metrics.UDPLinesMalformed.Count(), ShouldEqual, malformed+3)
+		So(listener.metrics.UDPPacketsTruncated.Count(), ShouldEqual, truncated)
+	})
+
+	Convey("Given truncated datagram, should count it as truncated, not malformed", t, func() {
+		malformed := listener.metrics.UDPLinesMalformed.Count()
+		truncated := listener.metrics.UDPPacketsTruncated.Count()
+		lineChan := make(chan []byte, 10)
+
+		listener.handlePacket([]byte("One.two 1 1234567890\nThree.four 2 1234567890\nFive.six 3 1234567890\nSeven.eight 4 1234567890\nNine.ten 5 1234567890\n"), lineChan)
+		close(lineChan)
+
+		So(len(lineChan), ShouldEqual, 4)
+		So(listener.metrics.UDPLinesMalformed.Count(), ShouldEqual, malformed)
+		So(listener.metrics.UDPPacketsTruncated.Count(), ShouldEqual, truncated+1)
+	})
+}
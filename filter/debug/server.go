@@ -0,0 +1,72 @@
+package debug
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/moira-alert/moira"
+)
+
+// Paths of debug server handlers
+const (
+	// ConnectionsPath is a path of stats of open metrics connections
+	ConnectionsPath = "/connections"
+	// MatchPath is a path of explanation of patterns, triggers and retention of metric given in "metric" query parameter
+	MatchPath = "/match"
+)
+
+const shutdownTimeout = 10 * time.Second
+
+// Server is an HTTP server exposing internal state of filter for debugging
+type Server struct {
+	listener net.Listener
+	server   *http.Server
+	mux      *http.ServeMux
+	logger   moira.Logger
+	done     chan struct{}
+}
+
+// NewServer creates new debug server listening on given uri
+func NewServer(listen string, logger moira.Logger) (*Server, error) {
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on [%s]: %s", listen, err.Error())
+	}
+	mux := http.NewServeMux()
+	return &Server{
+		listener: listener,
+		server:   &http.Server{Handler: mux},
+		mux:      mux,
+		logger:   logger,
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Handle registers handler of given path, all handlers should be registered before start
+func (server *Server) Handle(path string, handler http.Handler) {
+	server.mux.Handle(path, handler)
+}
+
+// Start starts serving requests
+func (server *Server) Start() {
+	go func() {
+		defer close(server.done)
+		if err := server.server.Serve(server.listener); err != nil && err != http.ErrServerClosed {
+			server.logger.Errorf("Debug HTTP server failed: %s", err.Error())
+		}
+	}()
+	server.logger.Infof("Moira Filter Debug Server started at [%s]", server.listener.Addr().String())
+}
+
+// Stop stops serving requests and waits for completion of active ones
+func (server *Server) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := server.server.Shutdown(ctx)
+	<-server.done
+	server.logger.Info("Moira Filter Debug Server stopped")
+	return err
+}
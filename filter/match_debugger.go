@@ -0,0 +1,120 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/tags"
+)
+
+// MetricExplanation describes how filter handles metric with given name
+type MetricExplanation struct {
+	Metric string `json:"metric"`
+	// Name is a metric name matched with patterns, it differs from Metric if metric is rewritten by rules or is tagged
+	Name string `json:"name"`
+	// Rules are names of matched rules in order of applying
+	Rules []string `json:"rules"`
+	// Dropped is true if metric is dropped by rules, it is not matched with patterns then
+	Dropped           bool                 `json:"dropped"`
+	Patterns          []PatternExplanation `json:"patterns"`
+	Retention         int                  `json:"retention"`
+	TimestampPolicy   TimestampPolicy      `json:"timestamp_policy"`
+	AggregationMethod AggregationMethod    `json:"aggregation_method"`
+}
+
+// PatternExplanation is a pattern matched by metric and triggers owning it
+type PatternExplanation struct {
+	Pattern    string   `json:"pattern"`
+	TriggerIDs []string `json:"trigger_ids"`
+}
+
+// MatchDebugger explains which patterns and triggers metric belongs to and what retention it gets.
+// It uses the same rules, pattern tree and retentions as filter, but does not update filter metrics and caches
+type MatchDebugger struct {
+	database       moira.Database
+	patternStorage *PatternStorage
+	cacheStorage   *Storage
+}
+
+// NewMatchDebugger creates new MatchDebugger
+func NewMatchDebugger(database moira.Database, patternStorage *PatternStorage, cacheStorage *Storage) *MatchDebugger {
+	return &MatchDebugger{
+		database:       database,
+		patternStorage: patternStorage,
+		cacheStorage:   cacheStorage,
+	}
+}
+
+// Explain returns explanation of handling of metric with given name
+func (debugger *MatchDebugger) Explain(metric string) (*MetricExplanation, error) {
+	name, err := normalizeMetricName(metric)
+	if err != nil {
+		return nil, err
+	}
+
+	explanation := &MetricExplanation{
+		Metric:   metric,
+		Rules:    make([]string, 0),
+		Patterns: make([]PatternExplanation, 0),
+	}
+	if debugger.patternStorage.rules != nil {
+		rewritten, ok, matchedRules := debugger.patternStorage.rules.explain(name)
+		explanation.Rules = matchedRules
+		if !ok {
+			explanation.Dropped = true
+			return explanation, nil
+		}
+		if name, err = normalizeRewritten(name, rewritten); err != nil {
+			return nil, err
+		}
+	}
+	explanation.Name = string(name)
+
+	for _, pattern := range debugger.patternStorage.matchPattern(name) {
+		triggerIDs, err := debugger.database.GetPatternTriggerIDs(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get triggers of pattern '%s': %s", pattern, err.Error())
+		}
+		explanation.Patterns = append(explanation.Patterns, PatternExplanation{Pattern: pattern, TriggerIDs: triggerIDs})
+	}
+
+	retention, _ := debugger.cacheStorage.matchRetention(explanation.Name)
+	explanation.Retention = retention.value
+	explanation.TimestampPolicy = retention.timestampPolicy
+	explanation.AggregationMethod = retention.aggregationMethod
+	return explanation, nil
+}
+
+// ServeHTTP writes explanation of metric given in "metric" query parameter as JSON
+func (debugger *MatchDebugger) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	metric := request.URL.Query().Get("metric")
+	if _, err := normalizeMetricName(metric); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	explanation, err := debugger.Explain(metric)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(explanation)
+}
+
+// normalizeMetricName checks metric name and sorts tags of tagged metric in the same way as received metrics are handled
+func normalizeMetricName(metric string) ([]byte, error) {
+	if metric == "" || strings.ContainsAny(metric, " \t\n") {
+		return nil, fmt.Errorf("invalid metric name '%s'", metric)
+	}
+	if !strings.Contains(metric, ";") {
+		return []byte(metric), nil
+	}
+	name, seriesTags, err := tags.ParseTaggedMetric(metric)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse tagged metric '%s': %s", metric, err.Error())
+	}
+	return []byte(tags.FormatTaggedMetric(name, seriesTags)), nil
+}
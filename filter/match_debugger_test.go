@@ -0,0 +1,116 @@
+package filter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+	"github.com/moira-alert/moira/mock/moira-alert"
+)
+
+func TestMatchDebugger(t *testing.T) {
+	filterMetrics := metrics.ConfigureFilterMetrics("test")
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	database := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("MatchDebugger")
+
+	rules, err := NewRules(logger, filterMetrics, strings.NewReader(`
+		[drop_tmp]
+		action = drop
+		glob = *.tmp.*
+
+		[rename]
+		action = rewrite
+		regex = ^Old\.
+		replacement = Simple.
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
+	database.EXPECT().GetPatterns().Return([]string{"Simple.*.pattern", "Simple.matching.*", "Other.pattern"}, nil)
+	patternStorage, err := NewPatternStorage(database, filterMetrics, logger, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheStorage, err := NewCacheStorage(logger, filterMetrics, strings.NewReader(testRetentions), strings.NewReader(testAggregations), TimestampWindow{}, CacheLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	debugger := NewMatchDebugger(database, patternStorage, cacheStorage)
+
+	Convey("Given metric matched by patterns, should return patterns, triggers and retention", t, func() {
+		database.EXPECT().GetPatternTriggerIDs("Simple.*.pattern").Return([]string{"trigger1"}, nil)
+		database.EXPECT().GetPatternTriggerIDs("Simple.matching.*").Return([]string{"trigger2", "trigger3"}, nil)
+		explanation, err := debugger.Explain("Old.matching.pattern")
+		So(err, ShouldBeNil)
+		So(explanation.Name, ShouldEqual, "Simple.matching.pattern")
+		So(explanation.Rules, ShouldResemble, []string{"rename"})
+		So(explanation.Dropped, ShouldBeFalse)
+		So(explanation.Patterns, ShouldHaveLength, 2)
+		So(explanation.Patterns, ShouldContain, PatternExplanation{Pattern: "Simple.*.pattern", TriggerIDs: []string{"trigger1"}})
+		So(explanation.Patterns, ShouldContain, PatternExplanation{Pattern: "Simple.matching.*", TriggerIDs: []string{"trigger2", "trigger3"}})
+		So(explanation.Retention, ShouldEqual, 60)
+		So(explanation.TimestampPolicy, ShouldEqual, TimestampDrop)
+		So(explanation.AggregationMethod, ShouldEqual, AggregationLast)
+	})
+
+	Convey("Given metric dropped by rules, should not match it with patterns", t, func() {
+		explanation, err := debugger.Explain("Simple.tmp.pattern")
+		So(err, ShouldBeNil)
+		So(explanation.Dropped, ShouldBeTrue)
+		So(explanation.Rules, ShouldResemble, []string{"drop_tmp"})
+		So(explanation.Patterns, ShouldBeEmpty)
+	})
+
+	Convey("Given metric not matched by patterns, should return its retention only", t, func() {
+		explanation, err := debugger.Explain("Unknown.metric.daily")
+		So(err, ShouldBeNil)
+		So(explanation.Patterns, ShouldBeEmpty)
+		So(explanation.Retention, ShouldEqual, 86400)
+	})
+
+	Convey("Should not count explained metrics", t, func() {
+		dropped := filterMetrics.DroppedMetricsReceived.Count()
+		debugger.Explain("Simple.tmp.pattern")
+		So(filterMetrics.DroppedMetricsReceived.Count(), ShouldEqual, dropped)
+	})
+
+	Convey("Given invalid metric name, should return error", t, func() {
+		_, err := debugger.Explain("")
+		So(err, ShouldBeError)
+		_, err = debugger.Explain("Simple.matching.pattern 1 1234567890")
+		So(err, ShouldBeError)
+	})
+
+	Convey("Given HTTP request", t, func() {
+		Convey("With valid metric, should return explanation", func() {
+			database.EXPECT().GetPatternTriggerIDs("Other.pattern").Return([]string{}, nil)
+			recorder := httptest.NewRecorder()
+			debugger.ServeHTTP(recorder, httptest.NewRequest("GET", "/match?metric=Other.pattern", nil))
+			So(recorder.Code, ShouldEqual, http.StatusOK)
+			So(recorder.Body.String(), ShouldContainSubstring, `"pattern":"Other.pattern"`)
+		})
+
+		Convey("Without metric, should return bad request", func() {
+			recorder := httptest.NewRecorder()
+			debugger.ServeHTTP(recorder, httptest.NewRequest("GET", "/match", nil))
+			So(recorder.Code, ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("With database error, should return internal server error", func() {
+			database.EXPECT().GetPatternTriggerIDs("Other.pattern").Return(nil, fmt.Errorf("connection refused"))
+			recorder := httptest.NewRecorder()
+			debugger.ServeHTTP(recorder, httptest.NewRequest("GET", "/match?metric=Other.pattern", nil))
+			So(recorder.Code, ShouldEqual, http.StatusInternalServerError)
+		})
+	})
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/moira-alert/moira"
 	"github.com/moira-alert/moira/filter"
+	"github.com/moira-alert/moira/filter/spool"
 	"github.com/moira-alert/moira/metrics/graphite"
 )
 
@@ -16,17 +17,22 @@ type MetricsMatcher struct {
 	database      moira.Database
 	cacheStorage  *filter.Storage
 	cacheCapacity int
+	spool         *spool.Spool
 	waitGroup     *sync.WaitGroup
 }
 
-// NewMetricsMatcher creates new MetricsMatcher
-func NewMetricsMatcher(metrics *graphite.FilterMetrics, logger moira.Logger, database moira.Database, cacheStorage *filter.Storage, cacheCapacity int) *MetricsMatcher {
+// maxReplayedBatches is a max number of spooled batches saved at once, so replaying does not block saving of new metrics for long
+const maxReplayedBatches = 10
+
+// NewMetricsMatcher creates new MetricsMatcher, batches failed to save are kept in metricsSpool if it is not nil
+func NewMetricsMatcher(metrics *graphite.FilterMetrics, logger moira.Logger, database moira.Database, cacheStorage *filter.Storage, cacheCapacity int, metricsSpool *spool.Spool) *MetricsMatcher {
 	return &MetricsMatcher{
 		metrics:       metrics,
 		logger:        logger,
 		database:      database,
 		cacheStorage:  cacheStorage,
 		cacheCapacity: cacheCapacity,
+		spool:         metricsSpool,
 		waitGroup:     &sync.WaitGroup{},
 	}
 }
@@ -52,6 +58,7 @@ func (matcher *MetricsMatcher) Start(matchedMetricsChan chan *moira.MatchedMetri
 			case <-time.After(flushInterval):
 			}
 			if len(buffer) == 0 {
+				matcher.replay()
 				continue
 			}
 			timer := time.Now()
@@ -69,7 +76,45 @@ func (matcher *MetricsMatcher) Wait() {
 }
 
 func (matcher *MetricsMatcher) save(buffer map[string]*moira.MatchedMetric) {
+	if matcher.spool != nil && matcher.spool.Len() > 0 {
+		// Older batches are still in spool, new batch is saved after them to keep order of points
+		matcher.push(buffer)
+		matcher.replay()
+		return
+	}
 	if err := matcher.database.SaveMetrics(buffer); err != nil {
 		matcher.logger.Errorf("Failed to save value in cache storage: %s", err.Error())
+		if matcher.spool != nil {
+			matcher.push(buffer)
+		}
+	}
+}
+
+func (matcher *MetricsMatcher) push(buffer map[string]*moira.MatchedMetric) {
+	if err := matcher.spool.Push(buffer); err != nil {
+		matcher.logger.Errorf("Failed to spool metrics: %s", err.Error())
+	}
+}
+
+// replay saves spooled batches in order of spooling until saving fails
+func (matcher *MetricsMatcher) replay() {
+	if matcher.spool == nil {
+		return
+	}
+	for i := 0; i < maxReplayedBatches && matcher.spool.Len() > 0; i++ {
+		batch, err := matcher.spool.Peek()
+		if err != nil {
+			matcher.logger.Errorf("Failed to read spooled metrics, batch is dropped: %s", err.Error())
+			matcher.spool.Pop()
+			continue
+		}
+		if err := matcher.database.SaveMetrics(batch); err != nil {
+			return
+		}
+		if err := matcher.spool.Pop(); err != nil {
+			matcher.logger.Errorf("Failed to remove replayed metrics from spool: %s", err.Error())
+			return
+		}
+		matcher.metrics.SpoolReplayedMetrics.Inc(int64(len(batch)))
 	}
 }
@@ -0,0 +1,69 @@
+package matchedmetrics
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/filter/spool"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+	"github.com/moira-alert/moira/mock/moira-alert"
+)
+
+func TestSaveWithSpool(t *testing.T) {
+	logger, _ := logging.GetLogger("MetricsMatcher")
+	filterMetrics := metrics.ConfigureFilterMetrics("test")
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	database := mock_moira_alert.NewMockDatabase(mockCtrl)
+
+	dir, err := ioutil.TempDir("", "moira-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	batch := func(value float64) map[string]*moira.MatchedMetric {
+		return map[string]*moira.MatchedMetric{
+			"Metric.one": {Metric: "Metric.one", Patterns: []string{"Metric.*"}, Value: value, Timestamp: 1234567890, RetentionTimestamp: 1234567860, Retention: 60},
+		}
+	}
+
+	Convey("Given unavailable database, should spool batches and replay them in order", t, func() {
+		metricsSpool, err := spool.NewSpool(dir, 1024*1024, logger, filterMetrics)
+		So(err, ShouldBeNil)
+		matcher := NewMetricsMatcher(filterMetrics, logger, database, nil, 10, metricsSpool)
+
+		database.EXPECT().SaveMetrics(batch(1)).Return(fmt.Errorf("connection refused"))
+		matcher.save(batch(1))
+		So(metricsSpool.Len(), ShouldEqual, 1)
+
+		database.EXPECT().SaveMetrics(batch(1)).Return(fmt.Errorf("connection refused"))
+		matcher.save(batch(2))
+		So(metricsSpool.Len(), ShouldEqual, 2)
+
+		gomock.InOrder(
+			database.EXPECT().SaveMetrics(batch(1)).Return(nil),
+			database.EXPECT().SaveMetrics(batch(2)).Return(nil),
+		)
+		matcher.replay()
+		So(metricsSpool.Len(), ShouldEqual, 0)
+
+		database.EXPECT().SaveMetrics(batch(3)).Return(nil)
+		matcher.save(batch(3))
+		So(metricsSpool.Len(), ShouldEqual, 0)
+	})
+
+	Convey("Given no spool, should drop batch failed to save", t, func() {
+		matcher := NewMetricsMatcher(filterMetrics, logger, database, nil, 10, nil)
+		database.EXPECT().SaveMetrics(batch(1)).Return(fmt.Errorf("connection refused"))
+		matcher.save(batch(1))
+		matcher.replay()
+	})
+}
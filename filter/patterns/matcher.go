@@ -5,6 +5,7 @@ import (
 
 	"github.com/moira-alert/moira"
 	"github.com/moira-alert/moira/filter"
+	"github.com/moira-alert/moira/filter/relay"
 	"github.com/moira-alert/moira/metrics/graphite"
 	"gopkg.in/tomb.v2"
 )
@@ -15,14 +16,16 @@ type Matcher struct {
 	tomb           tomb.Tomb
 	metrics        *graphite.FilterMetrics
 	patternStorage *filter.PatternStorage
+	relay          *relay.Relay
 }
 
-// NewMatcher creates pattern matcher
-func NewMatcher(logger moira.Logger, metrics *graphite.FilterMetrics, patternsStorage *filter.PatternStorage) *Matcher {
+// NewMatcher creates pattern matcher, received lines are forwarded to relay if it is not nil
+func NewMatcher(logger moira.Logger, metrics *graphite.FilterMetrics, patternsStorage *filter.PatternStorage, relay *relay.Relay) *Matcher {
 	return &Matcher{
 		logger:         logger,
 		metrics:        metrics,
 		patternStorage: patternsStorage,
+		relay:          relay,
 	}
 }
 
@@ -48,7 +51,11 @@ func (m *Matcher) Start(matchersCount int, lineChan <-chan []byte) chan *moira.M
 
 func (m *Matcher) worker(metricsChan <-chan []byte, matchedMetricsChan chan<- *moira.MatchedMetric) error {
 	for line := range metricsChan {
-		if metric := m.patternStorage.ProcessIncomingMetric(line); metric != nil {
+		metric := m.patternStorage.ProcessIncomingMetric(line)
+		if m.relay != nil {
+			m.relay.Forward(line, metric != nil)
+		}
+		if metric != nil {
 			matchedMetricsChan <- metric
 		}
 	}
@@ -1,15 +1,20 @@
 package filter
 
 import (
+	"bytes"
 	"fmt"
 	"path"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
 	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/database"
 	"github.com/moira-alert/moira/metrics/graphite"
+	"github.com/moira-alert/moira/tags"
 	"github.com/vova616/xxhash"
 )
 
@@ -17,27 +22,42 @@ var asteriskHash = xxhash.Checksum32([]byte("*"))
 
 // PatternStorage contains pattern tree
 type PatternStorage struct {
-	database    moira.Database
-	metrics     *graphite.FilterMetrics
-	logger      moira.Logger
-	PatternTree *patternNode
+	database moira.Database
+	metrics  *graphite.FilterMetrics
+	logger   moira.Logger
+	rules    *Rules
+
+	// patternsMutex guards pattern tree and seriesByTag patterns, which are replaced while metrics are matched
+	patternsMutex       sync.RWMutex
+	PatternTree         *patternNode
+	seriesByTagPatterns []seriesByTagPattern
+	// version is a version of patterns list the tree is built from
+	version int64
 }
 
-// patternNode contains pattern node
+// seriesByTagPattern contains seriesByTag pattern and its parsed tag specs
+type seriesByTagPattern struct {
+	pattern string
+	specs   []tags.Spec
+}
+
+// patternNode contains pattern node, Terminal node is the last part of some pattern
 type patternNode struct {
 	Children   []*patternNode
 	Part       string
 	Hash       uint32
 	Prefix     string
 	InnerParts []string
+	Terminal   bool
 }
 
-// NewPatternStorage creates new PatternStorage struct
-func NewPatternStorage(database moira.Database, metrics *graphite.FilterMetrics, logger moira.Logger) (*PatternStorage, error) {
+// NewPatternStorage creates new PatternStorage struct, rules are applied to metric names before matching, nil rules are ignored
+func NewPatternStorage(database moira.Database, metrics *graphite.FilterMetrics, logger moira.Logger, rules *Rules) (*PatternStorage, error) {
 	storage := &PatternStorage{
 		database: database,
 		metrics:  metrics,
 		logger:   logger,
+		rules:    rules,
 	}
 	err := storage.RefreshTree()
 	return storage, err
@@ -45,11 +65,93 @@ func NewPatternStorage(database moira.Database, metrics *graphite.FilterMetrics,
 
 // RefreshTree builds pattern tree from redis data
 func (storage *PatternStorage) RefreshTree() error {
+	// Version is got before patterns, so changes made in between are applied once again by UpdateTree
+	version, err := storage.database.GetPatternsVersion()
+	if err != nil {
+		return err
+	}
 	patterns, err := storage.database.GetPatterns()
 	if err != nil {
 		return err
 	}
-	return storage.buildTree(patterns)
+	if err := storage.buildTree(patterns); err != nil {
+		return err
+	}
+	storage.version = version
+	return nil
+}
+
+// UpdateTree applies changes of patterns list made since the tree was built or updated last time.
+// Changed nodes are copied, so metrics matching concurrently with update use consistent tree.
+// If some of changes are lost, the whole tree is rebuilt
+func (storage *PatternStorage) UpdateTree() error {
+	changes, version, err := storage.database.GetPatternChanges(storage.version)
+	if err != nil {
+		if err == database.ErrPatternChangesLost {
+			storage.logger.Infof("Pattern changes after version %d are lost, rebuild pattern tree", storage.version)
+			return storage.RefreshTree()
+		}
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	newTree, seriesByTagPatterns := storage.getPatterns()
+	for _, change := range changes {
+		if tags.IsSeriesByTag(change.Pattern) {
+			seriesByTagPatterns = storage.updateSeriesByTagPatterns(seriesByTagPatterns, change)
+			continue
+		}
+		parts := strings.Split(change.Pattern, ".")
+		if hasEmptyParts(parts) {
+			continue
+		}
+		if change.Removed {
+			newTree = newTree.withoutPattern(parts)
+		} else {
+			newTree = newTree.withPattern(parts)
+		}
+	}
+
+	storage.setPatterns(newTree, seriesByTagPatterns)
+	storage.version = version
+	return nil
+}
+
+// getPatterns returns pattern tree and seriesByTag patterns which are consistent with each other.
+// They are never modified after being set, so they can be used without lock
+func (storage *PatternStorage) getPatterns() (*patternNode, []seriesByTagPattern) {
+	storage.patternsMutex.RLock()
+	defer storage.patternsMutex.RUnlock()
+	return storage.PatternTree, storage.seriesByTagPatterns
+}
+
+// setPatterns replaces pattern tree and seriesByTag patterns used to match metrics
+func (storage *PatternStorage) setPatterns(tree *patternNode, seriesByTagPatterns []seriesByTagPattern) {
+	storage.patternsMutex.Lock()
+	defer storage.patternsMutex.Unlock()
+	storage.PatternTree = tree
+	storage.seriesByTagPatterns = seriesByTagPatterns
+}
+
+// updateSeriesByTagPatterns returns new list of seriesByTag patterns with given change applied
+func (storage *PatternStorage) updateSeriesByTagPatterns(patterns []seriesByTagPattern, change *moira.PatternChange) []seriesByTagPattern {
+	newPatterns := make([]seriesByTagPattern, 0, len(patterns)+1)
+	for _, seriesByTag := range patterns {
+		if seriesByTag.pattern != change.Pattern {
+			newPatterns = append(newPatterns, seriesByTag)
+		}
+	}
+	if change.Removed {
+		return newPatterns
+	}
+	specs, err := tags.ParseSeriesByTag(change.Pattern)
+	if err != nil {
+		storage.logger.Warningf("Skip invalid seriesByTag pattern: %s", err.Error())
+		return newPatterns
+	}
+	return append(newPatterns, seriesByTagPattern{pattern: change.Pattern, specs: specs})
 }
 
 // ProcessIncomingMetric validates, parses and matches incoming raw string
@@ -65,6 +167,17 @@ func (storage *PatternStorage) ProcessIncomingMetric(lineBytes []byte) *moira.Ma
 
 	storage.metrics.ValidMetricsReceived.Inc(1)
 
+	if storage.rules != nil {
+		metric, err = storage.applyRules(metric)
+		if err != nil {
+			storage.logger.Infof("cannot apply rules: %v", err)
+			return nil
+		}
+		if metric == nil {
+			return nil
+		}
+	}
+
 	matchingStart := time.Now()
 	matched := storage.matchPattern(metric)
 	if count%10 == 0 {
@@ -84,9 +197,35 @@ func (storage *PatternStorage) ProcessIncomingMetric(lineBytes []byte) *moira.Ma
 	return nil
 }
 
+// applyRules applies rules to metric name, returns nil if metric is dropped
+func (storage *PatternStorage) applyRules(metric []byte) ([]byte, error) {
+	rewritten, ok := storage.rules.Apply(metric)
+	if !ok {
+		return nil, nil
+	}
+	return normalizeRewritten(metric, rewritten)
+}
+
+// normalizeRewritten normalizes again tagged metric rewritten by rules
+func normalizeRewritten(metric, rewritten []byte) ([]byte, error) {
+	if bytes.IndexByte(rewritten, ';') >= 0 && !bytes.Equal(rewritten, metric) {
+		name, seriesTags, err := tags.ParseTaggedMetric(string(rewritten))
+		if err != nil {
+			return nil, fmt.Errorf("invalid tagged metric after rewrite: '%s' (%s)", rewritten, err)
+		}
+		rewritten = []byte(tags.FormatTaggedMetric(name, seriesTags))
+	}
+	return rewritten, nil
+}
+
 // matchPattern returns array of matched patterns
 func (storage *PatternStorage) matchPattern(metric []byte) []string {
-	currentLevel := []*patternNode{storage.PatternTree}
+	tree, seriesByTagPatterns := storage.getPatterns()
+	if bytes.IndexByte(metric, ';') >= 0 {
+		return matchSeriesByTagPatterns(seriesByTagPatterns, string(metric))
+	}
+
+	currentLevel := []*patternNode{tree}
 	var found, index int
 	for i, c := range metric {
 		if c == '.' {
@@ -113,7 +252,7 @@ func (storage *PatternStorage) matchPattern(metric []byte) []string {
 
 	matched := make([]string, 0, found)
 	for _, node := range currentLevel {
-		if len(node.Children) == 0 {
+		if node.Terminal {
 			matched = append(matched, node.Prefix)
 		}
 	}
@@ -121,8 +260,24 @@ func (storage *PatternStorage) matchPattern(metric []byte) []string {
 	return matched
 }
 
+// matchSeriesByTagPatterns returns array of given seriesByTag patterns matched by given tagged metric
+func matchSeriesByTagPatterns(seriesByTagPatterns []seriesByTagPattern, metric string) []string {
+	name, seriesTags, err := tags.ParseTaggedMetric(metric)
+	if err != nil {
+		return []string{}
+	}
+	matched := make([]string, 0)
+	for _, seriesByTag := range seriesByTagPatterns {
+		if tags.MatchSpecs(seriesByTag.specs, name, seriesTags) {
+			matched = append(matched, seriesByTag.pattern)
+		}
+	}
+	return matched
+}
+
 // parseMetricFromString parses metric from string
 // supported format: "<metricString> <valueFloat64> <timestampInt64>"
+// tagged metric string "<name>;<tag>=<value>..." is returned with tags sorted by name
 func (*PatternStorage) parseMetricFromString(line []byte) ([]byte, float64, int64, error) {
 	var parts [3][]byte
 	partIndex := 0
@@ -153,6 +308,14 @@ func (*PatternStorage) parseMetricFromString(line []byte) ([]byte, float64, int6
 		return nil, 0, 0, fmt.Errorf("metric name is empty: '%s'", line)
 	}
 
+	if bytes.IndexByte(metric, ';') >= 0 {
+		name, seriesTags, err := tags.ParseTaggedMetric(string(metric))
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("cannot parse tagged metric: '%s' (%s)", line, err)
+		}
+		metric = []byte(tags.FormatTaggedMetric(name, seriesTags))
+	}
+
 	value, err := strconv.ParseFloat(string(parts[1]), 64)
 	if err != nil {
 		return nil, 0, 0, fmt.Errorf("cannot parse value: '%s' (%s)", line, err)
@@ -168,8 +331,18 @@ func (*PatternStorage) parseMetricFromString(line []byte) ([]byte, float64, int6
 
 func (storage *PatternStorage) buildTree(patterns []string) error {
 	newTree := &patternNode{}
+	seriesByTagPatterns := make([]seriesByTagPattern, 0)
 
 	for _, pattern := range patterns {
+		if tags.IsSeriesByTag(pattern) {
+			specs, err := tags.ParseSeriesByTag(pattern)
+			if err != nil {
+				storage.logger.Warningf("Skip invalid seriesByTag pattern: %s", err.Error())
+				continue
+			}
+			seriesByTagPatterns = append(seriesByTagPatterns, seriesByTagPattern{pattern: pattern, specs: specs})
+			continue
+		}
 		currentNode := newTree
 		parts := strings.Split(pattern, ".")
 		if hasEmptyParts(parts) {
@@ -185,39 +358,186 @@ func (storage *PatternStorage) buildTree(patterns []string) error {
 				}
 			}
 			if !found {
-				newNode := &patternNode{Part: part}
+				newNode := newPatternNode(currentNode, part)
+				currentNode.Children = append(currentNode.Children, newNode)
+				currentNode = newNode
+			}
+		}
+		currentNode.Terminal = true
+	}
 
-				if currentNode.Prefix == "" {
-					newNode.Prefix = part
-				} else {
-					newNode.Prefix = fmt.Sprintf("%s.%s", currentNode.Prefix, part)
-				}
+	storage.setPatterns(newTree, seriesByTagPatterns)
+	return nil
+}
 
-				if part == "*" || !strings.ContainsAny(part, "{*?") {
-					newNode.Hash = xxhash.Checksum32([]byte(part))
-				} else {
-					if strings.Contains(part, "{") && strings.Contains(part, "}") {
-						prefix, bigSuffix := split2(part, "{")
-						inner, suffix := split2(bigSuffix, "}")
-						innerParts := strings.Split(inner, ",")
-
-						newNode.InnerParts = make([]string, 0, len(innerParts))
-						for _, innerPart := range innerParts {
-							newNode.InnerParts = append(newNode.InnerParts, fmt.Sprintf("%s%s%s", prefix, innerPart, suffix))
-						}
-					} else {
-						newNode.InnerParts = []string{part}
-					}
+// newPatternNode creates child node of given parent for given pattern part
+func newPatternNode(parent *patternNode, part string) *patternNode {
+	newNode := &patternNode{Part: part}
 
+	if parent.Prefix == "" {
+		newNode.Prefix = part
+	} else {
+		newNode.Prefix = fmt.Sprintf("%s.%s", parent.Prefix, part)
+	}
+
+	if part == "*" || !strings.ContainsAny(part, "{*?[") {
+		newNode.Hash = xxhash.Checksum32([]byte(part))
+	} else {
+		newNode.InnerParts = expandGlob(part)
+	}
+	return newNode
+}
+
+// expandGlob converts graphite glob of single pattern part to list of path.Match patterns,
+// all {a,b} alternatives including nested ones are expanded and [!a-z] character classes are converted to [^a-z]
+func expandGlob(part string) []string {
+	expanded := expandBraces(part)
+	globs := make([]string, 0, len(expanded))
+	seen := make(map[string]bool, len(expanded))
+	for _, glob := range expanded {
+		glob = strings.Replace(glob, "[!", "[^", -1)
+		if !seen[glob] {
+			seen[glob] = true
+			globs = append(globs, glob)
+		}
+	}
+	return globs
+}
+
+// expandBraces expands the first {a,b} alternative of glob and then alternatives of every result recursively,
+// so nested and multiple alternatives are supported. Glob with unbalanced braces is returned as is
+func expandBraces(glob string) []string {
+	open := strings.IndexByte(glob, '{')
+	if open < 0 {
+		return []string{glob}
+	}
+	depth := 0
+	start := open + 1
+	alternatives := make([]string, 0)
+	for i := open; i < len(glob); i++ {
+		switch glob[i] {
+		case '{':
+			depth++
+		case ',':
+			if depth == 1 {
+				alternatives = append(alternatives, glob[start:i])
+				start = i + 1
+			}
+		case '}':
+			depth--
+			if depth == 0 {
+				alternatives = append(alternatives, glob[start:i])
+				prefix, suffix := glob[:open], glob[i+1:]
+				result := make([]string, 0, len(alternatives))
+				for _, alternative := range alternatives {
+					result = append(result, expandBraces(prefix+alternative+suffix)...)
 				}
-				currentNode.Children = append(currentNode.Children, newNode)
-				currentNode = newNode
+				return result
+			}
+		}
+	}
+	return []string{glob}
+}
+
+// globToRegexp converts graphite glob matching the whole metric name to regexp.
+// Glob is expanded by expandGlob like trigger patterns are, so both match the same metrics.
+// Wildcards '*', '?' and character classes do not match dots
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	expanded := expandGlob(glob)
+	alternatives := make([]string, 0, len(expanded))
+	for _, expandedGlob := range expanded {
+		alternative, err := expandedGlobToRegexp(expandedGlob)
+		if err != nil {
+			return nil, fmt.Errorf("%s in glob '%s'", err.Error(), glob)
+		}
+		alternatives = append(alternatives, alternative)
+	}
+	return regexp.Compile("^(?:" + strings.Join(alternatives, "|") + ")$")
+}
+
+// expandedGlobToRegexp converts glob without alternatives returned by expandGlob to regexp source
+func expandedGlobToRegexp(glob string) (string, error) {
+	var builder strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			builder.WriteString(`[^.]*`)
+		case '?':
+			builder.WriteString(`[^.]`)
+		case '{', '}':
+			return "", fmt.Errorf("unbalanced '%c'", c)
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unclosed '['")
 			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "^") {
+				class = "^." + class[1:]
+			}
+			builder.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+			}
+			builder.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(c)))
 		}
 	}
+	return builder.String(), nil
+}
 
-	storage.PatternTree = newTree
-	return nil
+// withPattern returns copy of node with pattern of given parts added to its subtree,
+// only nodes on the path of pattern are copied, given node is not modified
+func (node *patternNode) withPattern(parts []string) *patternNode {
+	newNode := *node
+	if len(parts) == 0 {
+		newNode.Terminal = true
+		return &newNode
+	}
+	newNode.Children = make([]*patternNode, len(node.Children), len(node.Children)+1)
+	copy(newNode.Children, node.Children)
+	for i, child := range node.Children {
+		if child.Part == parts[0] {
+			newNode.Children[i] = child.withPattern(parts[1:])
+			return &newNode
+		}
+	}
+	newNode.Children = append(newNode.Children, newPatternNode(node, parts[0]).withPattern(parts[1:]))
+	return &newNode
+}
+
+// withoutPattern returns copy of node with pattern of given parts removed from its subtree,
+// nodes which are not terminal and have no children anymore are removed too.
+// Root node is never removed, given node is not modified
+func (node *patternNode) withoutPattern(parts []string) *patternNode {
+	newNode := node.copyWithoutPattern(parts)
+	if newNode == nil {
+		return &patternNode{}
+	}
+	return newNode
+}
+
+func (node *patternNode) copyWithoutPattern(parts []string) *patternNode {
+	newNode := *node
+	if len(parts) == 0 {
+		newNode.Terminal = false
+	} else {
+		newNode.Children = make([]*patternNode, 0, len(node.Children))
+		for _, child := range node.Children {
+			if child.Part != parts[0] {
+				newNode.Children = append(newNode.Children, child)
+			} else if newChild := child.copyWithoutPattern(parts[1:]); newChild != nil {
+				newNode.Children = append(newNode.Children, newChild)
+			}
+		}
+	}
+	if !newNode.Terminal && len(newNode.Children) == 0 {
+		return nil
+	}
+	return &newNode
 }
 
 func parseTimestamp(unixTimestamp string) (int64, error) {
@@ -260,11 +580,3 @@ func findPart(part []byte, currentLevel []*patternNode) ([]*patternNode, int) {
 	}
 	return nextLevel, len(nextLevel)
 }
-
-func split2(s, sep string) (string, string) {
-	splitResult := strings.SplitN(s, sep, 2)
-	if len(splitResult) < 2 {
-		return splitResult[0], ""
-	}
-	return splitResult[0], splitResult[1]
-}
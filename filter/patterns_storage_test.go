@@ -4,9 +4,13 @@ import (
 	"fmt"
 	"math/rand"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/golang/mock/gomock"
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/database"
 	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
 	"github.com/moira-alert/moira/mock/moira-alert"
 	"github.com/op/go-logging"
@@ -42,6 +46,8 @@ func TestParseMetricFromString(t *testing.T) {
 			"Newline.in.the.end 12 1234567890\n",
 			"Newline.in.the.end 12 1234567890\r",
 			"Newline.in.the.end 12 1234567890\r\n",
+			"Tagged.without.value;tag 12 1234567890",
+			"Tagged.with.empty.value;tag= 12 1234567890",
 		}
 
 		for _, invalidMetric := range invalidMetrics {
@@ -59,6 +65,8 @@ func TestParseMetricFromString(t *testing.T) {
 			{"One.two.three 123. 1234567890", "One.two.three", 123, 1234567890},
 			{"One.two.three 123.0 1234567890", "One.two.three", 123, 1234567890},
 			{"One.two.three .123 1234567890", "One.two.three", 0.123, 1234567890},
+			{"One.two.three;tag=value 123 1234567890", "One.two.three;tag=value", 123, 1234567890},
+			{"One.two.three;tag2=b;tag1=a 123 1234567890", "One.two.three;tag1=a;tag2=b", 123, 1234567890},
 		}
 
 		for _, validMetric := range validMetrics {
@@ -110,6 +118,7 @@ func TestProcessIncomingMetric(t *testing.T) {
 		"Complex.*{one,two,three}suf*.pattern",
 		"Question.?at_begin",
 		"Question.at_the_end?",
+		"seriesByTag('name=Tagged.metric', 'dc=~x')",
 	}
 
 	nonMatchingMetrics := []string{
@@ -118,6 +127,8 @@ func TestProcessIncomingMetric(t *testing.T) {
 		"Bracket.one.nothing",
 		"Bracket.nothing.pattern",
 		"Complex.prefixonesuffix",
+		"Tagged.metric;dc=y",
+		"Tagged.metric",
 	}
 
 	matchingMetrics := []string{
@@ -137,6 +148,8 @@ func TestProcessIncomingMetric(t *testing.T) {
 		"Complex.anything.pattern",
 		"Question.1at_begin",
 		"Question.at_the_end2",
+		"Tagged.metric;dc=x1",
+		"Tagged.metric;host=a;dc=x",
 	}
 
 	metrics2 := metrics.ConfigureFilterMetrics("test")
@@ -146,13 +159,15 @@ func TestProcessIncomingMetric(t *testing.T) {
 	logger, _ := logging.GetLogger("Scheduler")
 
 	Convey("Create new pattern storage, GetPatterns returns error, should error", t, func() {
+		database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
 		database.EXPECT().GetPatterns().Return(nil, fmt.Errorf("Some error here"))
-		_, err := NewPatternStorage(database, metrics2, logger)
+		_, err := NewPatternStorage(database, metrics2, logger, nil)
 		So(err, ShouldBeError, fmt.Errorf("Some error here"))
 	})
 
+	database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
 	database.EXPECT().GetPatterns().Return(testPatterns, nil)
-	patternsStorage, err := NewPatternStorage(database, metrics2, logger)
+	patternsStorage, err := NewPatternStorage(database, metrics2, logger, nil)
 
 	Convey("Create new pattern storage, should no error", t, func() {
 		So(err, ShouldBeEmpty)
@@ -225,5 +240,275 @@ func TestProcessIncomingMetric(t *testing.T) {
 		})
 	})
 
+	Convey("When rules are configured, should match rewritten metric names", t, func() {
+		patternsStorage.metrics = metrics.ConfigureFilterMetrics("test")
+		rules, err := NewRules(logger, patternsStorage.metrics, strings.NewReader(`
+			[drop_star]
+			action = drop
+			glob = Star.*.*
+			[strip_prefix]
+			action = rewrite
+			regex = ^prefix\.
+			replacement =
+			[retag]
+			action = rewrite
+			regex = ;zone=
+			replacement = ;dc=`))
+		So(err, ShouldBeNil)
+		patternsStorage.rules = rules
+		defer func() { patternsStorage.rules = nil }()
+
+		matchedMetric := patternsStorage.ProcessIncomingMetric([]byte("prefix.Simple.matching.pattern 12 1234567890"))
+		So(matchedMetric, ShouldNotBeNil)
+		So(matchedMetric.Metric, ShouldEqual, "Simple.matching.pattern")
+
+		matchedMetric = patternsStorage.ProcessIncomingMetric([]byte("Tagged.metric;zone=x;host=h 12 1234567890"))
+		So(matchedMetric, ShouldNotBeNil)
+		So(matchedMetric.Metric, ShouldEqual, "Tagged.metric;dc=x;host=h")
+
+		matchedMetric = patternsStorage.ProcessIncomingMetric([]byte("Star.single.anything 12 1234567890"))
+		So(matchedMetric, ShouldBeNil)
+		So(patternsStorage.metrics.ValidMetricsReceived.Count(), ShouldEqual, 3)
+		So(patternsStorage.metrics.DroppedMetricsReceived.Count(), ShouldEqual, 1)
+		So(patternsStorage.metrics.MatchingMetricsReceived.Count(), ShouldEqual, 2)
+	})
+
+	mockCtrl.Finish()
+}
+
+func TestUpdateTree(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	dataBase := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("Scheduler")
+	metrics2 := metrics.ConfigureFilterMetrics("test")
+
+	initialPatterns := []string{"One.two.three", "One.two.*", "One.{two,three}.four", "seriesByTag('name=Tagged.one')"}
+	dataBase.EXPECT().GetPatternsVersion().Return(int64(10), nil)
+	dataBase.EXPECT().GetPatterns().Return(initialPatterns, nil)
+	patternsStorage, err := NewPatternStorage(dataBase, metrics2, logger, nil)
+
+	Convey("Create new pattern storage, should no error", t, func() {
+		So(err, ShouldBeNil)
+		So(patternsStorage.version, ShouldEqual, 10)
+	})
+
+	Convey("When there are no changes, should keep tree", t, func() {
+		tree := patternsStorage.PatternTree
+		dataBase.EXPECT().GetPatternChanges(int64(10)).Return([]*moira.PatternChange{}, int64(10), nil)
+		So(patternsStorage.UpdateTree(), ShouldBeNil)
+		So(patternsStorage.PatternTree, ShouldEqual, tree)
+	})
+
+	Convey("When patterns are changed, should build the same tree as full rebuild", t, func() {
+		oldTree := patternsStorage.PatternTree
+		changes := []*moira.PatternChange{
+			{Version: 11, Pattern: "One.two.three.four"},
+			{Version: 12, Pattern: "One.two.*", Removed: true},
+			{Version: 13, Pattern: "One.{two,three}.four", Removed: true},
+			{Version: 14, Pattern: "Five.six"},
+			{Version: 15, Pattern: "Seven..eight"},
+			{Version: 16, Pattern: "seriesByTag('name=Tagged.one')", Removed: true},
+			{Version: 17, Pattern: "seriesByTag('name=Tagged.two')"},
+		}
+		dataBase.EXPECT().GetPatternChanges(int64(10)).Return(changes, int64(17), nil)
+		So(patternsStorage.UpdateTree(), ShouldBeNil)
+		So(patternsStorage.version, ShouldEqual, 17)
+
+		expectedStorage := PatternStorage{}
+		expectedStorage.buildTree([]string{"One.two.three", "One.two.three.four", "Five.six", "seriesByTag('name=Tagged.two')"})
+		So(patternsStorage.PatternTree, ShouldResemble, expectedStorage.PatternTree)
+		So(patternsStorage.seriesByTagPatterns, ShouldResemble, expectedStorage.seriesByTagPatterns)
+
+		So(patternsStorage.matchPattern([]byte("One.two.three")), ShouldResemble, []string{"One.two.three"})
+		So(patternsStorage.matchPattern([]byte("One.two.three.four")), ShouldResemble, []string{"One.two.three.four"})
+		So(patternsStorage.matchPattern([]byte("One.two.five")), ShouldBeEmpty)
+		So(patternsStorage.matchPattern([]byte("Five.six")), ShouldResemble, []string{"Five.six"})
+		So(patternsStorage.matchPattern([]byte("Tagged.one;tag=value")), ShouldBeEmpty)
+		So(patternsStorage.matchPattern([]byte("Tagged.two;tag=value")), ShouldResemble, []string{"seriesByTag('name=Tagged.two')"})
+
+		Convey("Old tree should not be modified", func() {
+			oldStorage := PatternStorage{PatternTree: oldTree}
+			So(oldStorage.matchPattern([]byte("One.two.five")), ShouldResemble, []string{"One.two.*"})
+			So(oldStorage.matchPattern([]byte("Five.six")), ShouldBeEmpty)
+		})
+	})
+
+	Convey("When all patterns are removed, should have empty tree", t, func() {
+		changes := []*moira.PatternChange{
+			{Version: 18, Pattern: "One.two.three", Removed: true},
+			{Version: 19, Pattern: "One.two.three.four", Removed: true},
+			{Version: 20, Pattern: "Five.six", Removed: true},
+		}
+		dataBase.EXPECT().GetPatternChanges(int64(17)).Return(changes, int64(20), nil)
+		So(patternsStorage.UpdateTree(), ShouldBeNil)
+		So(patternsStorage.PatternTree, ShouldResemble, &patternNode{})
+	})
+
+	Convey("When pattern changes are lost, should rebuild tree", t, func() {
+		dataBase.EXPECT().GetPatternChanges(int64(20)).Return(nil, int64(30000), database.ErrPatternChangesLost)
+		dataBase.EXPECT().GetPatternsVersion().Return(int64(30000), nil)
+		dataBase.EXPECT().GetPatterns().Return([]string{"One.two"}, nil)
+		So(patternsStorage.UpdateTree(), ShouldBeNil)
+		So(patternsStorage.version, ShouldEqual, 30000)
+		So(patternsStorage.matchPattern([]byte("One.two")), ShouldResemble, []string{"One.two"})
+	})
+
+	Convey("When getting pattern changes fails, should return error", t, func() {
+		dataBase.EXPECT().GetPatternChanges(int64(30000)).Return(nil, int64(0), fmt.Errorf("Some error here"))
+		So(patternsStorage.UpdateTree(), ShouldBeError, fmt.Errorf("Some error here"))
+		So(patternsStorage.version, ShouldEqual, 30000)
+	})
+
 	mockCtrl.Finish()
 }
+
+// TestUpdateTreeConcurrently should be run with -race flag to check that patterns are replaced safely
+func TestUpdateTreeConcurrently(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dataBase := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("Scheduler")
+
+	dataBase.EXPECT().GetPatternsVersion().Return(int64(1), nil)
+	dataBase.EXPECT().GetPatterns().Return([]string{"One.two.three", "seriesByTag('name=Tagged.one')"}, nil)
+	patternsStorage, err := NewPatternStorage(dataBase, metrics.ConfigureFilterMetrics("test"), logger, nil)
+
+	changes := []*moira.PatternChange{
+		{Version: 2, Pattern: "Five.six"},
+		{Version: 3, Pattern: "seriesByTag('name=Tagged.two')"},
+		{Version: 4, Pattern: "Five.six", Removed: true},
+		{Version: 5, Pattern: "seriesByTag('name=Tagged.two')", Removed: true},
+	}
+	dataBase.EXPECT().GetPatternChanges(gomock.Any()).Return(changes, int64(5), nil).AnyTimes()
+
+	Convey("Metrics matched while tree is updated should be matched with consistent patterns", t, func() {
+		So(err, ShouldBeNil)
+
+		const updates = 200
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < updates; i++ {
+				patternsStorage.UpdateTree()
+				patternsStorage.buildTree([]string{"One.two.three", "Five.six", "seriesByTag('name=Tagged.one')"})
+			}
+		}()
+
+		matched := make(chan []string, 4*updates)
+		for worker := 0; worker < 4; worker++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < updates; i++ {
+					matched <- patternsStorage.matchPattern([]byte("One.two.three"))
+					matched <- patternsStorage.matchPattern([]byte("Tagged.one;tag=value"))
+				}
+			}()
+		}
+		go func() {
+			wg.Wait()
+			close(matched)
+		}()
+
+		for patterns := range matched {
+			So(patterns, ShouldHaveLength, 1)
+		}
+	})
+}
+
+func TestExpandGlob(t *testing.T) {
+	Convey("Given glob without alternatives, should return it", t, func() {
+		So(expandGlob("server-[0-9]*"), ShouldResemble, []string{"server-[0-9]*"})
+	})
+
+	Convey("Given glob with alternatives, should expand all of them", t, func() {
+		So(expandGlob("pr{one,two}suf"), ShouldResemble, []string{"pronesuf", "prtwosuf"})
+		So(expandGlob("{a,b}-{c,d}"), ShouldResemble, []string{"a-c", "a-d", "b-c", "b-d"})
+		So(expandGlob("{db{1,2},web}"), ShouldResemble, []string{"db1", "db2", "web"})
+		So(expandGlob("{a,a,b}"), ShouldResemble, []string{"a", "b"})
+		So(expandGlob("x{}y"), ShouldResemble, []string{"xy"})
+	})
+
+	Convey("Given glob with negated character class, should convert it to path.Match syntax", t, func() {
+		So(expandGlob("server-[!0-9]"), ShouldResemble, []string{"server-[^0-9]"})
+	})
+
+	Convey("Given glob with unbalanced braces, should return it as is", t, func() {
+		So(expandGlob("a{b,c"), ShouldResemble, []string{"a{b,c"})
+	})
+}
+
+func TestGraphiteGlobs(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		metric   string
+		expected bool
+	}{
+		{"server-[0-9].cpu", "server-1.cpu", true},
+		{"server-[0-9].cpu", "server-9.cpu", true},
+		{"server-[0-9].cpu", "server-10.cpu", false},
+		{"server-[0-9].cpu", "server-a.cpu", false},
+		{"server-[0-9]*.cpu", "server-10.cpu", true},
+		{"server-[0-9]*.cpu", "server-.cpu", false},
+		{"server-[ac-e].cpu", "server-a.cpu", true},
+		{"server-[ac-e].cpu", "server-d.cpu", true},
+		{"server-[ac-e].cpu", "server-b.cpu", false},
+		{"server-[a-c0-9].cpu", "server-b.cpu", true},
+		{"server-[a-c0-9].cpu", "server-5.cpu", true},
+		{"server-[a-c0-9].cpu", "server-x.cpu", false},
+		{"server-[!0-9].cpu", "server-a.cpu", true},
+		{"server-[!0-9].cpu", "server-1.cpu", false},
+		{"server-[!0-9].cpu", "server-ab.cpu", false},
+		{"server-[!a-c].cpu", "server-d.cpu", true},
+		{"server-[!a-c].cpu", "server-b.cpu", false},
+		{"disk.{sd[a-b],nvme*}", "disk.sdb", true},
+		{"disk.{sd[a-b],nvme*}", "disk.nvme0", true},
+		{"disk.{sd[a-b],nvme*}", "disk.sdc", false},
+		{"{db{1,2},web}.prod", "db1.prod", true},
+		{"{db{1,2},web}.prod", "db2.prod", true},
+		{"{db{1,2},web}.prod", "web.prod", true},
+		{"{db{1,2},web}.prod", "db3.prod", false},
+		{"{db{1,2},web}.prod", "db.prod", false},
+		{"nested.{a,{b,c}}", "nested.a", true},
+		{"nested.{a,{b,c}}", "nested.c", true},
+		{"nested.{a,{b,c}}", "nested.d", false},
+		{"{a,b}-{c,d}.x", "b-d.x", true},
+		{"{a,b}-{c,d}.x", "a-b.x", false},
+		{"host?.{cpu,mem}", "host1.mem", true},
+		{"host?.{cpu,mem}", "host10.mem", false},
+		{"prefix.pattern", "prefix.pattern", true},
+		{"prefix.pattern", "prefix", false},
+		{"prefix.pattern", "prefix.pattern.longer.x", false},
+		{"prefix.pattern.longer", "prefix.pattern.longer", true},
+		{"prefix.pattern.longer", "prefix.pattern.longer.x", false},
+	}
+	patterns := make([]string, 0, len(testCases))
+	for _, testCase := range testCases {
+		patterns = append(patterns, testCase.pattern)
+	}
+	storage := PatternStorage{}
+	storage.buildTree(patterns)
+
+	Convey("Metrics should match graphite globs", t, func() {
+		for _, testCase := range testCases {
+			Convey(fmt.Sprintf("%s should match %s: %v", testCase.metric, testCase.pattern, testCase.expected), func() {
+				if testCase.expected {
+					So(storage.matchPattern([]byte(testCase.metric)), ShouldContain, testCase.pattern)
+				} else {
+					So(storage.matchPattern([]byte(testCase.metric)), ShouldNotContain, testCase.pattern)
+				}
+			})
+		}
+	})
+
+	Convey("Rules globs should match the same metrics as patterns", t, func() {
+		for _, testCase := range testCases {
+			Convey(fmt.Sprintf("%s should match rule glob %s: %v", testCase.metric, testCase.pattern, testCase.expected), func() {
+				pattern, err := globToRegexp(testCase.pattern)
+				So(err, ShouldBeNil)
+				So(pattern.MatchString(testCase.metric), ShouldEqual, testCase.expected)
+			})
+		}
+	})
+}
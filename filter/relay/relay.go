@@ -0,0 +1,238 @@
+package relay
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite"
+)
+
+const (
+	flushInterval = 100 * time.Millisecond
+	writeTimeout  = 10 * time.Second
+	dialTimeout   = 5 * time.Second
+
+	defaultReconnectInterval = 5 * time.Second
+)
+
+var unsafeNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// Config is a configuration of relay
+type Config struct {
+	// Destinations are addresses of downstream carbon plaintext listeners
+	Destinations []string
+	// OnlyMatched makes relay forward only lines matched any pattern
+	OnlyMatched bool
+	// QueueSize is a max number of lines waiting for sending to each destination, new lines are dropped if queue is full
+	QueueSize int
+	// ReconnectInterval is a delay between attempts to connect to destination
+	ReconnectInterval time.Duration
+}
+
+// Relay forwards received lines to downstream carbon destinations
+type Relay struct {
+	destinations []*destination
+	onlyMatched  bool
+	logger       moira.Logger
+}
+
+// destination is a downstream carbon with its own queue and connection
+type destination struct {
+	address           string
+	queue             chan []byte
+	reconnectInterval time.Duration
+	conn              net.Conn
+	writer            *bufio.Writer
+	logger            moira.Logger
+	queueLen          graphite.Histogram
+	sent              graphite.Meter
+	dropped           graphite.Meter
+	tomb              tomb.Tomb
+
+	// pending is a number of lines in writer buffer which are not flushed to connection yet
+	pending int64
+}
+
+// NewRelay creates new relay and registers queue length, sent and dropped lines metrics of every destination
+func NewRelay(config Config, logger moira.Logger, metrics *graphite.FilterMetrics) (*Relay, error) {
+	if len(config.Destinations) == 0 {
+		return nil, fmt.Errorf("no relay destinations are configured")
+	}
+	if config.QueueSize <= 0 {
+		return nil, fmt.Errorf("relay queue size should be positive, got %d", config.QueueSize)
+	}
+	if config.ReconnectInterval <= 0 {
+		config.ReconnectInterval = defaultReconnectInterval
+	}
+	relay := &Relay{
+		destinations: make([]*destination, 0, len(config.Destinations)),
+		onlyMatched:  config.OnlyMatched,
+		logger:       logger,
+	}
+	for _, address := range config.Destinations {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return nil, fmt.Errorf("invalid relay destination [%s]: %s", address, err.Error())
+		}
+		name := unsafeNameChars.ReplaceAllString(address, "_")
+		metrics.RelayQueueLen.AddMetric(address, fmt.Sprintf("relay.%s.queue", name))
+		metrics.RelaySentMetrics.AddMetric(address, fmt.Sprintf("relay.%s.sent", name))
+		metrics.RelayDroppedMetrics.AddMetric(address, fmt.Sprintf("relay.%s.dropped", name))
+		dest := &destination{
+			address:           address,
+			queue:             make(chan []byte, config.QueueSize),
+			reconnectInterval: config.ReconnectInterval,
+			logger:            logger,
+		}
+		dest.queueLen, _ = metrics.RelayQueueLen.GetMetric(address)
+		dest.sent, _ = metrics.RelaySentMetrics.GetMetric(address)
+		dest.dropped, _ = metrics.RelayDroppedMetrics.GetMetric(address)
+		relay.destinations = append(relay.destinations, dest)
+	}
+	return relay, nil
+}
+
+// Start starts sending of queued lines to destinations, connections are reestablished on failures
+func (relay *Relay) Start() {
+	for _, dest := range relay.destinations {
+		dest.tomb.Go(dest.run)
+	}
+	relay.logger.Infof("Moira Filter Relay started to forward metrics to %d destinations", len(relay.destinations))
+}
+
+// Forward queues line for sending to all destinations, matched is true if line matched any pattern.
+// It never blocks, line is dropped for destination whose queue is full
+func (relay *Relay) Forward(line []byte, matched bool) {
+	if relay.onlyMatched && !matched {
+		return
+	}
+	for _, dest := range relay.destinations {
+		select {
+		case dest.queue <- line:
+		default:
+			dest.dropped.Mark(1)
+		}
+	}
+}
+
+// Stop sends lines already queued to connected destinations and closes connections
+func (relay *Relay) Stop() error {
+	for _, dest := range relay.destinations {
+		dest.tomb.Kill(nil)
+	}
+	for _, dest := range relay.destinations {
+		if err := dest.tomb.Wait(); err != nil {
+			return err
+		}
+	}
+	relay.logger.Info("Moira Filter Relay stopped")
+	return nil
+}
+
+func (dest *destination) run() error {
+	flushTicker := time.NewTicker(flushInterval)
+	defer flushTicker.Stop()
+	for {
+		if dest.conn == nil {
+			if err := dest.connect(); err != nil {
+				dest.logger.Errorf("Failed to connect to relay destination [%s]: %s", dest.address, err.Error())
+				dest.queueLen.Update(int64(len(dest.queue)))
+				select {
+				case <-dest.tomb.Dying():
+					return nil
+				case <-time.After(dest.reconnectInterval):
+					continue
+				}
+			}
+		}
+		select {
+		case <-dest.tomb.Dying():
+			dest.drain()
+			dest.close()
+			return nil
+		case line := <-dest.queue:
+			dest.write(line)
+		case <-flushTicker.C:
+			dest.queueLen.Update(int64(len(dest.queue)))
+			dest.flush()
+		}
+	}
+}
+
+func (dest *destination) connect() error {
+	conn, err := net.DialTimeout("tcp", dest.address, dialTimeout)
+	if err != nil {
+		return err
+	}
+	dest.logger.Infof("Connected to relay destination [%s]", dest.address)
+	dest.conn = conn
+	dest.writer = bufio.NewWriter(conn)
+	return nil
+}
+
+// drain sends lines remaining in queue
+func (dest *destination) drain() {
+	for len(dest.queue) > 0 && dest.conn != nil {
+		dest.write(<-dest.queue)
+	}
+	dest.flush()
+}
+
+// write puts line to writer buffer, buffer is flushed before it overflows, so lines are counted as sent only after flush
+func (dest *destination) write(line []byte) {
+	if dest.writer.Available() < len(line)+1 && !dest.flush() {
+		dest.dropped.Mark(1)
+		return
+	}
+	dest.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := dest.writer.Write(line); err != nil {
+		dest.dropped.Mark(1)
+		dest.fail(err)
+		return
+	}
+	if err := dest.writer.WriteByte('\n'); err != nil {
+		dest.dropped.Mark(1)
+		dest.fail(err)
+		return
+	}
+	dest.pending++
+}
+
+// flush sends buffered lines to connection, returns false if connection is broken
+func (dest *destination) flush() bool {
+	if dest.conn == nil {
+		return false
+	}
+	if dest.writer.Buffered() == 0 {
+		return true
+	}
+	dest.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := dest.writer.Flush(); err != nil {
+		dest.fail(err)
+		return false
+	}
+	dest.sent.Mark(dest.pending)
+	dest.pending = 0
+	return true
+}
+
+// fail closes broken connection, lines buffered in writer are lost and counted as dropped
+func (dest *destination) fail(err error) {
+	dest.logger.Errorf("Failed to send metrics to relay destination [%s]: %s", dest.address, err.Error())
+	dest.dropped.Mark(dest.pending)
+	dest.pending = 0
+	dest.close()
+}
+
+func (dest *destination) close() {
+	if dest.conn != nil {
+		dest.conn.Close()
+		dest.conn = nil
+		dest.writer = nil
+	}
+}
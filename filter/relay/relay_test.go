@@ -0,0 +1,104 @@
+package relay
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+)
+
+func TestRelay(t *testing.T) {
+	logger, _ := logging.GetLogger("Relay")
+	filterMetrics := metrics.ConfigureFilterMetrics("test")
+
+	Convey("Given invalid config, should return error", t, func() {
+		_, err := NewRelay(Config{QueueSize: 10}, logger, filterMetrics)
+		So(err, ShouldBeError)
+		_, err = NewRelay(Config{Destinations: []string{"localhost:2003"}}, logger, filterMetrics)
+		So(err, ShouldBeError)
+		_, err = NewRelay(Config{Destinations: []string{"localhost"}, QueueSize: 10}, logger, filterMetrics)
+		So(err, ShouldBeError)
+	})
+
+	Convey("Given running destination, should forward lines", t, func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer listener.Close()
+		address := listener.Addr().String()
+
+		relay, err := NewRelay(Config{Destinations: []string{address}, OnlyMatched: true, QueueSize: 10}, logger, filterMetrics)
+		So(err, ShouldBeNil)
+		relay.Start()
+
+		relay.Forward([]byte("Not.matched 1 1234567890"), false)
+		relay.Forward([]byte("Matched.one 1 1234567890"), true)
+		relay.Forward([]byte("Matched.two 2 1234567890"), true)
+
+		conn, err := listener.Accept()
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		reader := bufio.NewReader(conn)
+		line, err := reader.ReadString('\n')
+		So(err, ShouldBeNil)
+		So(line, ShouldEqual, "Matched.one 1 1234567890\n")
+		line, err = reader.ReadString('\n')
+		So(err, ShouldBeNil)
+		So(line, ShouldEqual, "Matched.two 2 1234567890\n")
+
+		So(relay.Stop(), ShouldBeNil)
+		sent, _ := filterMetrics.RelaySentMetrics.GetMetric(address)
+		So(sent.Count(), ShouldEqual, 2)
+	})
+
+	Convey("Given unavailable destination, should drop lines exceeding queue size", t, func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		address := listener.Addr().String()
+		listener.Close()
+
+		relay, err := NewRelay(Config{Destinations: []string{address}, QueueSize: 2, ReconnectInterval: time.Hour}, logger, filterMetrics)
+		So(err, ShouldBeNil)
+		relay.Start()
+		for i := 0; i < 5; i++ {
+			relay.Forward([]byte("One.two 1 1234567890"), false)
+		}
+		So(relay.Stop(), ShouldBeNil)
+
+		dropped, _ := filterMetrics.RelayDroppedMetrics.GetMetric(address)
+		So(dropped.Count(), ShouldEqual, 3)
+	})
+
+	Convey("Given destination failing to send buffered lines, should count them as dropped, not sent", t, func() {
+		client, server := net.Pipe()
+		dest := &destination{address: "pipe", conn: client, writer: bufio.NewWriter(client), logger: logger}
+		filterMetrics.RelaySentMetrics.AddMetric("pipe", "relay.pipe.sent")
+		filterMetrics.RelayDroppedMetrics.AddMetric("pipe", "relay.pipe.dropped")
+		dest.sent, _ = filterMetrics.RelaySentMetrics.GetMetric("pipe")
+		dest.dropped, _ = filterMetrics.RelayDroppedMetrics.GetMetric("pipe")
+
+		received := make(chan string, 1)
+		go func() {
+			line, _ := bufio.NewReader(server).ReadString('\n')
+			received <- line
+		}()
+		dest.write([]byte("One.two 1 1234567890"))
+		So(dest.sent.Count(), ShouldEqual, 0)
+		So(dest.flush(), ShouldBeTrue)
+		So(<-received, ShouldEqual, "One.two 1 1234567890\n")
+		So(dest.sent.Count(), ShouldEqual, 1)
+
+		server.Close()
+		dest.write([]byte("Three.four 2 1234567890"))
+		dest.write([]byte("Five.six 3 1234567890"))
+		So(dest.flush(), ShouldBeFalse)
+		So(dest.sent.Count(), ShouldEqual, 1)
+		So(dest.dropped.Count(), ShouldEqual, 2)
+		So(dest.conn, ShouldBeNil)
+	})
+}
@@ -0,0 +1,188 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite"
+)
+
+// RuleAction is an action applied to metric matched by rule
+type RuleAction string
+
+// Actions of metric rules
+const (
+	// RuleDrop drops matched metric, no further rules are applied
+	RuleDrop RuleAction = "drop"
+	// RuleAllow accepts matched metric as is, no further rules are applied
+	RuleAllow RuleAction = "allow"
+	// RuleRewrite replaces all regex matches in metric name with replacement and continues with next rule
+	RuleRewrite RuleAction = "rewrite"
+)
+
+var ruleNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// metricRule is a single rule of rules config
+type metricRule struct {
+	name        string
+	action      RuleAction
+	pattern     *regexp.Regexp
+	replacement []byte
+	matched     graphite.Meter
+}
+
+// Rules is an ordered list of drop, allow and rewrite rules applied to metric names before pattern matching
+type Rules struct {
+	rules   []*metricRule
+	metrics *graphite.FilterMetrics
+	logger  moira.Logger
+}
+
+// NewRules parses rules config and registers matched metrics counter for every rule.
+// Config consists of "[name]" sections like storage-schemas.conf with "action", "glob", "regex" and "replacement" keys.
+// Action is one of drop, allow or rewrite, drop and allow rules match metric name by graphite glob or by regex,
+// rewrite rules use regex only
+func NewRules(logger moira.Logger, metrics *graphite.FilterMetrics, reader io.Reader) (*Rules, error) {
+	rules := &Rules{
+		metrics: metrics,
+		logger:  logger,
+	}
+	if err := rules.buildRules(bufio.NewScanner(reader)); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules.rules {
+		metrics.RulesMatchedMetrics.AddMetric(rule.name, fmt.Sprintf("rules.%s.matched", rule.name))
+		rule.matched, _ = metrics.RulesMatchedMetrics.GetMetric(rule.name)
+	}
+	logger.Infof("Loaded %d metric rules", len(rules.rules))
+	return rules, nil
+}
+
+// Apply applies rules to metric name, returns rewritten name and false if metric should be dropped
+func (rules *Rules) Apply(metric []byte) ([]byte, bool) {
+	metric, ok := rules.apply(metric, markRuleMatched)
+	if !ok {
+		rules.metrics.DroppedMetricsReceived.Inc(1)
+	}
+	return metric, ok
+}
+
+// explain applies rules to metric name without counting matches, returns names of matched rules
+func (rules *Rules) explain(metric []byte) ([]byte, bool, []string) {
+	matched := make([]string, 0)
+	metric, ok := rules.apply(metric, func(rule *metricRule) {
+		matched = append(matched, rule.name)
+	})
+	return metric, ok, matched
+}
+
+// apply applies rules to metric name and calls onMatch for every matched rule
+func (rules *Rules) apply(metric []byte, onMatch func(rule *metricRule)) ([]byte, bool) {
+	for _, rule := range rules.rules {
+		if !rule.pattern.Match(metric) {
+			continue
+		}
+		onMatch(rule)
+		switch rule.action {
+		case RuleDrop:
+			return nil, false
+		case RuleAllow:
+			return metric, true
+		case RuleRewrite:
+			metric = rule.pattern.ReplaceAll(metric, rule.replacement)
+			if len(metric) == 0 {
+				return nil, false
+			}
+		}
+	}
+	return metric, true
+}
+
+func markRuleMatched(rule *metricRule) {
+	rule.matched.Mark(1)
+}
+
+func (rules *Rules) buildRules(scanner *bufio.Scanner) error {
+	rules.rules = make([]*metricRule, 0)
+	var section map[string]string
+	var sectionName string
+	names := make(map[string]bool)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			if section != nil {
+				if err := rules.addRule(sectionName, section); err != nil {
+					return err
+				}
+			}
+			sectionName = strings.TrimSpace(line[1 : len(line)-1])
+			if !ruleNameRegexp.MatchString(sectionName) {
+				return fmt.Errorf("invalid rule name '%s', only letters, digits, '_' and '-' are allowed", sectionName)
+			}
+			if names[sectionName] {
+				return fmt.Errorf("duplicated rule name '%s'", sectionName)
+			}
+			names[sectionName] = true
+			section = make(map[string]string)
+			continue
+		}
+		if section == nil {
+			return fmt.Errorf("line '%s' is outside of rule section", line)
+		}
+		separatorIndex := strings.Index(line, "=")
+		if separatorIndex < 0 {
+			return fmt.Errorf("invalid line '%s' in rule '%s'", line, sectionName)
+		}
+		section[strings.TrimSpace(line[:separatorIndex])] = strings.TrimSpace(line[separatorIndex+1:])
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if section != nil {
+		return rules.addRule(sectionName, section)
+	}
+	return nil
+}
+
+func (rules *Rules) addRule(name string, section map[string]string) error {
+	rule := &metricRule{
+		name:   name,
+		action: RuleAction(section["action"]),
+	}
+	glob, hasGlob := section["glob"]
+	regex, hasRegex := section["regex"]
+	if hasGlob == hasRegex {
+		return fmt.Errorf("rule '%s' should have either glob or regex", name)
+	}
+
+	switch rule.action {
+	case RuleDrop, RuleAllow:
+	case RuleRewrite:
+		if hasGlob {
+			return fmt.Errorf("rewrite rule '%s' should use regex", name)
+		}
+		rule.replacement = []byte(section["replacement"])
+	default:
+		return fmt.Errorf("unknown action '%s' of rule '%s'", rule.action, name)
+	}
+
+	var err error
+	if hasGlob {
+		rule.pattern, err = globToRegexp(glob)
+	} else {
+		rule.pattern, err = regexp.Compile(regex)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid pattern of rule '%s': %s", name, err.Error())
+	}
+	rules.rules = append(rules.rules, rule)
+	return nil
+}
@@ -0,0 +1,136 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+)
+
+var testRules = `
+	# comment
+	[strip_prefix]
+	action = rewrite
+	regex = ^relay\.(dc[0-9]+)\.
+	replacement = $1.
+
+	[allow_important]
+	action = allow
+	glob = dc?.important.*
+
+	[drop_junk]
+	action = drop
+	glob = *.*.{tmp,debug}.*
+
+	[replace_colons]
+	action = rewrite
+	regex = [:]
+	replacement = _
+
+	[drop_empty]
+	action = rewrite
+	regex = ^empty$
+	replacement =
+	`
+
+func TestRules(t *testing.T) {
+	logger, _ := logging.GetLogger("Rules")
+	filterMetrics := metrics.ConfigureFilterMetrics("rules")
+
+	Convey("Given valid rules config", t, func() {
+		rules, err := NewRules(logger, filterMetrics, strings.NewReader(testRules))
+		So(err, ShouldBeNil)
+		So(rules.rules, ShouldHaveLength, 5)
+
+		Convey("Metrics should be rewritten, allowed and dropped in order of rules", func() {
+			metric, ok := rules.Apply([]byte("relay.dc1.junk.tmp.cpu"))
+			So(ok, ShouldBeFalse)
+			So(metric, ShouldBeNil)
+
+			metric, ok = rules.Apply([]byte("relay.dc1.important.a:b"))
+			So(ok, ShouldBeTrue)
+			So(string(metric), ShouldEqual, "dc1.important.a:b")
+
+			metric, ok = rules.Apply([]byte("dc1.other.a:b:c"))
+			So(ok, ShouldBeTrue)
+			So(string(metric), ShouldEqual, "dc1.other.a_b_c")
+
+			_, ok = rules.Apply([]byte("empty"))
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Counters of matched rules should be incremented", func() {
+			strip, _ := filterMetrics.RulesMatchedMetrics.GetMetric("strip_prefix")
+			drop, _ := filterMetrics.RulesMatchedMetrics.GetMetric("drop_junk")
+			stripCount, dropCount := strip.Count(), drop.Count()
+			dropped := filterMetrics.DroppedMetricsReceived.Count()
+
+			rules.Apply([]byte("relay.dc2.my.tmp.metric"))
+			rules.Apply([]byte("my.metric"))
+
+			So(strip.Count(), ShouldEqual, stripCount+1)
+			So(drop.Count(), ShouldEqual, dropCount+1)
+			So(filterMetrics.DroppedMetricsReceived.Count(), ShouldEqual, dropped+1)
+		})
+	})
+
+	Convey("Given invalid rules config, should return error", t, func() {
+		invalidConfigs := []string{
+			"action = drop",
+			"[no action]\nglob = *",
+			"[no_pattern]\naction = drop",
+			"[both]\naction = drop\nglob = *\nregex = .*",
+			"[unknown]\naction = keep\nglob = *",
+			"[glob_rewrite]\naction = rewrite\nglob = *",
+			"[bad_regex]\naction = drop\nregex = (",
+			"[bad_glob]\naction = drop\nglob = a.{b,c",
+			"[dup]\naction = drop\nglob = a\n[dup]\naction = drop\nglob = b",
+			"[no_separator]\naction drop",
+		}
+		for _, config := range invalidConfigs {
+			_, err := NewRules(logger, filterMetrics, strings.NewReader(config))
+			So(err, ShouldBeError)
+		}
+	})
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	Convey("Glob should match whole metric name without crossing dots", t, func() {
+		pattern, err := globToRegexp("Simple.*.a?c.{x,y}[0-9].+")
+		So(err, ShouldBeNil)
+		So(pattern.MatchString("Simple.any.abc.x1.+"), ShouldBeTrue)
+		So(pattern.MatchString("Simple.any.abc.y9.+"), ShouldBeTrue)
+		So(pattern.MatchString("Simple.an.y.abc.x1.+"), ShouldBeFalse)
+		So(pattern.MatchString("Simple.any.a.c.x1.+"), ShouldBeFalse)
+		So(pattern.MatchString("Simple.any.abc.z1.+"), ShouldBeFalse)
+		So(pattern.MatchString("Simple.any.abc.x1.++"), ShouldBeFalse)
+		So(pattern.MatchString("prefix.Simple.any.abc.x1.+"), ShouldBeFalse)
+	})
+
+	Convey("Negated character class should not match listed characters and dots", t, func() {
+		pattern, err := globToRegexp("server-[!0-9].cpu")
+		So(err, ShouldBeNil)
+		So(pattern.MatchString("server-a.cpu"), ShouldBeTrue)
+		So(pattern.MatchString("server-1.cpu"), ShouldBeFalse)
+		So(pattern.MatchString("server-..cpu"), ShouldBeFalse)
+	})
+
+	Convey("Nested alternatives should be expanded", t, func() {
+		pattern, err := globToRegexp("nested.{a,{b,c}}.x")
+		So(err, ShouldBeNil)
+		So(pattern.MatchString("nested.a.x"), ShouldBeTrue)
+		So(pattern.MatchString("nested.c.x"), ShouldBeTrue)
+		So(pattern.MatchString("nested.{b,c}.x"), ShouldBeFalse)
+		So(pattern.MatchString("nested.d.x"), ShouldBeFalse)
+	})
+
+	Convey("Invalid globs should return errors", t, func() {
+		for _, glob := range []string{"unclosed.{a,b", "unopened.a}", "unclosed.[a-z"} {
+			_, err := globToRegexp(glob)
+			So(err, ShouldBeError)
+		}
+	})
+}
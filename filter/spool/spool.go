@@ -0,0 +1,171 @@
+package spool
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite"
+)
+
+const (
+	batchFileExtension = ".batch"
+	tmpFileExtension   = ".tmp"
+)
+
+// Spool is an on-disk queue of matched metrics batches failed to save, batches are stored one per file
+// and replayed in order of pushing. It is not safe for concurrent use
+type Spool struct {
+	dir     string
+	maxSize int64
+	size    int64
+	batches []spooledBatch
+	nextID  uint64
+	logger  moira.Logger
+	metrics *graphite.FilterMetrics
+}
+
+type spooledBatch struct {
+	id      uint64
+	size    int64
+	metrics int
+}
+
+// NewSpool opens spool in given directory, batches left in it by previous run are kept for replay.
+// Total size of spooled batches is limited by maxSize bytes, the oldest batches are dropped if it is exceeded
+func NewSpool(dir string, maxSize int64, logger moira.Logger, metrics *graphite.FilterMetrics) (*Spool, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("spool max size should be positive, got %d", maxSize)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create spool dir [%s]: %s", dir, err.Error())
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool dir [%s]: %s", dir, err.Error())
+	}
+	spool := &Spool{
+		dir:     dir,
+		maxSize: maxSize,
+		batches: make([]spooledBatch, 0),
+		logger:  logger,
+		metrics: metrics,
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), batchFileExtension+tmpFileExtension) {
+			// Batch was not completely written by previous run
+			os.Remove(filepath.Join(dir, file.Name()))
+			continue
+		}
+		if file.IsDir() || !strings.HasSuffix(file.Name(), batchFileExtension) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), batchFileExtension), 10, 64)
+		if err != nil {
+			continue
+		}
+		spool.batches = append(spool.batches, spooledBatch{id: id, size: file.Size(), metrics: -1})
+		spool.size += file.Size()
+	}
+	sort.Slice(spool.batches, func(i, j int) bool { return spool.batches[i].id < spool.batches[j].id })
+	if len(spool.batches) > 0 {
+		spool.nextID = spool.batches[len(spool.batches)-1].id + 1
+		logger.Infof("Spool [%s] contains %d batches to replay", dir, len(spool.batches))
+	}
+	spool.updateDepth()
+	return spool, nil
+}
+
+// Len returns number of spooled batches
+func (spool *Spool) Len() int {
+	return len(spool.batches)
+}
+
+// Push writes batch to the end of spool, the oldest batches are dropped to keep spool size within limit
+func (spool *Spool) Push(batch map[string]*moira.MatchedMetric) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metrics batch: %s", err.Error())
+	}
+	if int64(len(data)) > spool.maxSize {
+		spool.metrics.SpoolDroppedMetrics.Inc(int64(len(batch)))
+		return fmt.Errorf("metrics batch of %d bytes exceeds spool max size", len(data))
+	}
+	for spool.size+int64(len(data)) > spool.maxSize {
+		if spool.batches[0].metrics < 0 {
+			// Batch is left by previous run and not read yet, read it to count dropped metrics
+			spool.Peek()
+		}
+		dropped := spool.batches[0]
+		spool.logger.Warningf("Spool [%s] is full, drop the oldest batch", spool.dir)
+		if err := spool.Pop(); err != nil {
+			return err
+		}
+		if dropped.metrics > 0 {
+			spool.metrics.SpoolDroppedMetrics.Inc(int64(dropped.metrics))
+		}
+	}
+
+	batchFile := spool.batchFileName(spool.nextID)
+	tmpFile := batchFile + tmpFileExtension
+	if err := ioutil.WriteFile(tmpFile, data, 0644); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to write spool file [%s]: %s", tmpFile, err.Error())
+	}
+	if err := os.Rename(tmpFile, batchFile); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to rename spool file [%s]: %s", tmpFile, err.Error())
+	}
+	spool.batches = append(spool.batches, spooledBatch{id: spool.nextID, size: int64(len(data)), metrics: len(batch)})
+	spool.size += int64(len(data))
+	spool.nextID++
+	spool.updateDepth()
+	return nil
+}
+
+// Peek reads the oldest spooled batch, it returns nil if spool is empty
+func (spool *Spool) Peek() (map[string]*moira.MatchedMetric, error) {
+	if len(spool.batches) == 0 {
+		return nil, nil
+	}
+	batchFile := spool.batchFileName(spool.batches[0].id)
+	data, err := ioutil.ReadFile(batchFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool file [%s]: %s", batchFile, err.Error())
+	}
+	batch := make(map[string]*moira.MatchedMetric)
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal spool file [%s]: %s", batchFile, err.Error())
+	}
+	spool.batches[0].metrics = len(batch)
+	return batch, nil
+}
+
+// Pop removes the oldest spooled batch
+func (spool *Spool) Pop() error {
+	if len(spool.batches) == 0 {
+		return nil
+	}
+	batch := spool.batches[0]
+	if err := os.Remove(spool.batchFileName(batch.id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove spool file: %s", err.Error())
+	}
+	spool.batches = spool.batches[1:]
+	spool.size -= batch.size
+	spool.updateDepth()
+	return nil
+}
+
+func (spool *Spool) batchFileName(id uint64) string {
+	return filepath.Join(spool.dir, fmt.Sprintf("%020d%s", id, batchFileExtension))
+}
+
+func (spool *Spool) updateDepth() {
+	spool.metrics.SpoolDepth.Update(int64(len(spool.batches)))
+}
@@ -0,0 +1,104 @@
+package spool
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
+)
+
+func TestSpool(t *testing.T) {
+	logger, _ := logging.GetLogger("Spool")
+	filterMetrics := metrics.ConfigureFilterMetrics("test")
+
+	dir, err := ioutil.TempDir("", "moira-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	batch := func(value float64) map[string]*moira.MatchedMetric {
+		return map[string]*moira.MatchedMetric{
+			"Metric.one": {
+				Metric:             "Metric.one",
+				Patterns:           []string{"Metric.*"},
+				Value:              value,
+				Timestamp:          1234567890,
+				RetentionTimestamp: 1234567860,
+				Retention:          60,
+			},
+		}
+	}
+
+	Convey("Given invalid max size, should return error", t, func() {
+		_, err := NewSpool(dir, 0, logger, filterMetrics)
+		So(err, ShouldBeError)
+	})
+
+	Convey("Given pushed batches, should return them in order", t, func() {
+		spool, err := NewSpool(filepath.Join(dir, "order"), 1024*1024, logger, filterMetrics)
+		So(err, ShouldBeNil)
+		So(spool.Len(), ShouldEqual, 0)
+		empty, err := spool.Peek()
+		So(err, ShouldBeNil)
+		So(empty, ShouldBeNil)
+
+		So(spool.Push(batch(1)), ShouldBeNil)
+		So(spool.Push(batch(2)), ShouldBeNil)
+		So(spool.Len(), ShouldEqual, 2)
+
+		first, err := spool.Peek()
+		So(err, ShouldBeNil)
+		So(first, ShouldResemble, batch(1))
+		So(spool.Pop(), ShouldBeNil)
+
+		Convey("Reopened spool should keep not replayed batches", func() {
+			reopened, err := NewSpool(filepath.Join(dir, "order"), 1024*1024, logger, filterMetrics)
+			So(err, ShouldBeNil)
+			So(reopened.Len(), ShouldEqual, 1)
+			second, err := reopened.Peek()
+			So(err, ShouldBeNil)
+			So(second, ShouldResemble, batch(2))
+			So(reopened.Pop(), ShouldBeNil)
+			So(reopened.Len(), ShouldEqual, 0)
+
+			So(reopened.Push(batch(3)), ShouldBeNil)
+			third, err := reopened.Peek()
+			So(err, ShouldBeNil)
+			So(third, ShouldResemble, batch(3))
+		})
+	})
+
+	Convey("Given spool exceeding max size, should drop the oldest batches", t, func() {
+		probe, err := NewSpool(filepath.Join(dir, "probe"), 1024*1024, logger, filterMetrics)
+		So(err, ShouldBeNil)
+		So(probe.Push(batch(1)), ShouldBeNil)
+		batchSize := probe.size
+
+		spool, err := NewSpool(filepath.Join(dir, "full"), batchSize*2, logger, filterMetrics)
+		So(err, ShouldBeNil)
+		droppedBefore := filterMetrics.SpoolDroppedMetrics.Count()
+		So(spool.Push(batch(1)), ShouldBeNil)
+		So(spool.Push(batch(2)), ShouldBeNil)
+		So(spool.Push(batch(3)), ShouldBeNil)
+		So(spool.Len(), ShouldEqual, 2)
+		So(filterMetrics.SpoolDroppedMetrics.Count()-droppedBefore, ShouldEqual, 1)
+
+		oldest, err := spool.Peek()
+		So(err, ShouldBeNil)
+		So(oldest, ShouldResemble, batch(2))
+
+		Convey("Batch larger than max size should be dropped", func() {
+			tiny, err := NewSpool(filepath.Join(dir, "tiny"), 10, logger, filterMetrics)
+			So(err, ShouldBeNil)
+			So(tiny.Push(batch(1)), ShouldBeError)
+			So(tiny.Len(), ShouldEqual, 0)
+		})
+	})
+}
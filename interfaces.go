@@ -33,6 +33,7 @@ type Database interface {
 	GetLocalTriggerIDs() ([]string, error)
 	GetAllTriggerIDs() ([]string, error)
 	GetRemoteTriggerIDs() ([]string, error)
+	GetCompositeTriggerIDs() ([]string, error)
 	GetTrigger(triggerID string) (Trigger, error)
 	GetTriggers(triggerIDs []string) ([]*Trigger, error)
 	GetTriggerChecks(triggerIDs []string) ([]*TriggerCheck, error)
@@ -80,8 +81,13 @@ type Database interface {
 
 	// Patterns and metrics storing
 	GetPatterns() ([]string, error)
+	GetPatternsVersion() (int64, error)
+	GetPatternChanges(fromVersion int64) ([]*PatternChange, int64, error)
 	AddPatternMetric(pattern, metric string) error
 	GetPatternMetrics(pattern string) ([]string, error)
+	GetPatternsMetricsCount(patterns []string) (map[string]int64, error)
+	GetLimitedPatterns(patterns []string) (map[string]int64, error)
+	GetTaggedMetrics(tags map[string]string) ([]string, error)
 	RemovePattern(pattern string) error
 	RemovePatternsMetrics(pattern []string) error
 	RemovePatternWithMetrics(pattern string) error
@@ -2,12 +2,40 @@ package graphite
 
 // FilterMetrics is a collection of metrics used in filter
 type FilterMetrics struct {
-	TotalMetricsReceived    Counter
-	ValidMetricsReceived    Counter
-	MatchingMetricsReceived Counter
-	MatchingTimer           Timer
-	SavingTimer             Timer
-	BuildTreeTimer          Timer
-	MetricChannelLen        Histogram
-	LineChannelLen          Histogram
+	TotalMetricsReceived        Counter
+	ValidMetricsReceived        Counter
+	MatchingMetricsReceived     Counter
+	MatchingTimer               Timer
+	SavingTimer                 Timer
+	BuildTreeTimer              Timer
+	MetricChannelLen            Histogram
+	LineChannelLen              Histogram
+	UDPPacketsReceived          Counter
+	UDPLinesMalformed           Counter
+	UDPPacketsTruncated         Counter
+	PickleMessagesReceived      Counter
+	PickleMessagesMalformed     Counter
+	PrometheusRequestsReceived  Counter
+	PrometheusRequestsMalformed Counter
+	PrometheusSamplesReceived   Counter
+	InfluxLinesReceived         Counter
+	InfluxLinesMalformed        Counter
+	TLSHandshakesFailed         Counter
+	DroppedMetricsReceived      Counter
+	OutOfWindowMetricsReceived  Counter
+	MetricsCacheHits            Counter
+	MetricsCacheMisses          Counter
+	MetricsCacheEvictions       Counter
+	RetentionsCacheHits         Counter
+	RetentionsCacheMisses       Counter
+	RetentionsCacheEvictions    Counter
+	SpoolDepth                  Histogram
+	SpoolDroppedMetrics         Counter
+	SpoolReplayedMetrics        Counter
+	RelayQueueLen               HistogramsMap
+	RelaySentMetrics            MetricsMap
+	RelayDroppedMetrics         MetricsMap
+	RulesMatchedMetrics         MetricsMap
+	TLSClientConnections        MetricsMap
+	TLSClientLines              MetricsMap
 }
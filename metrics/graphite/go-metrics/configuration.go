@@ -9,14 +9,42 @@ import (
 // ConfigureFilterMetrics initialize graphite metrics
 func ConfigureFilterMetrics(prefix string) *graphite.FilterMetrics {
 	return &graphite.FilterMetrics{
-		TotalMetricsReceived:    registerCounter(metricNameWithPrefix(prefix, "received.total")),
-		ValidMetricsReceived:    registerCounter(metricNameWithPrefix(prefix, "received.valid")),
-		MatchingMetricsReceived: registerCounter(metricNameWithPrefix(prefix, "received.matching")),
-		MatchingTimer:           registerTimer(metricNameWithPrefix(prefix, "time.match")),
-		SavingTimer:             registerTimer(metricNameWithPrefix(prefix, "time.save")),
-		BuildTreeTimer:          registerTimer(metricNameWithPrefix(prefix, "time.buildtree")),
-		MetricChannelLen:        registerHistogram(metricNameWithPrefix(prefix, "metricsToSave")),
-		LineChannelLen:          registerHistogram(metricNameWithPrefix(prefix, "linesToMatch")),
+		TotalMetricsReceived:        registerCounter(metricNameWithPrefix(prefix, "received.total")),
+		ValidMetricsReceived:        registerCounter(metricNameWithPrefix(prefix, "received.valid")),
+		MatchingMetricsReceived:     registerCounter(metricNameWithPrefix(prefix, "received.matching")),
+		MatchingTimer:               registerTimer(metricNameWithPrefix(prefix, "time.match")),
+		SavingTimer:                 registerTimer(metricNameWithPrefix(prefix, "time.save")),
+		BuildTreeTimer:              registerTimer(metricNameWithPrefix(prefix, "time.buildtree")),
+		MetricChannelLen:            registerHistogram(metricNameWithPrefix(prefix, "metricsToSave")),
+		LineChannelLen:              registerHistogram(metricNameWithPrefix(prefix, "linesToMatch")),
+		UDPPacketsReceived:          registerCounter(metricNameWithPrefix(prefix, "received.udp.packets")),
+		UDPLinesMalformed:           registerCounter(metricNameWithPrefix(prefix, "received.udp.malformed")),
+		UDPPacketsTruncated:         registerCounter(metricNameWithPrefix(prefix, "received.udp.truncated")),
+		PickleMessagesReceived:      registerCounter(metricNameWithPrefix(prefix, "received.pickle.messages")),
+		PickleMessagesMalformed:     registerCounter(metricNameWithPrefix(prefix, "received.pickle.malformed")),
+		PrometheusRequestsReceived:  registerCounter(metricNameWithPrefix(prefix, "received.prometheus.requests")),
+		PrometheusRequestsMalformed: registerCounter(metricNameWithPrefix(prefix, "received.prometheus.malformed")),
+		PrometheusSamplesReceived:   registerCounter(metricNameWithPrefix(prefix, "received.prometheus.samples")),
+		InfluxLinesReceived:         registerCounter(metricNameWithPrefix(prefix, "received.influx.lines")),
+		InfluxLinesMalformed:        registerCounter(metricNameWithPrefix(prefix, "received.influx.malformed")),
+		TLSHandshakesFailed:         registerCounter(metricNameWithPrefix(prefix, "received.tls.handshake_failed")),
+		DroppedMetricsReceived:      registerCounter(metricNameWithPrefix(prefix, "received.dropped")),
+		OutOfWindowMetricsReceived:  registerCounter(metricNameWithPrefix(prefix, "received.out_of_window")),
+		MetricsCacheHits:            registerCounter(metricNameWithPrefix(prefix, "cache.metrics.hits")),
+		MetricsCacheMisses:          registerCounter(metricNameWithPrefix(prefix, "cache.metrics.misses")),
+		MetricsCacheEvictions:       registerCounter(metricNameWithPrefix(prefix, "cache.metrics.evictions")),
+		RetentionsCacheHits:         registerCounter(metricNameWithPrefix(prefix, "cache.retentions.hits")),
+		RetentionsCacheMisses:       registerCounter(metricNameWithPrefix(prefix, "cache.retentions.misses")),
+		RetentionsCacheEvictions:    registerCounter(metricNameWithPrefix(prefix, "cache.retentions.evictions")),
+		SpoolDepth:                  registerHistogram(metricNameWithPrefix(prefix, "spool.batches")),
+		SpoolDroppedMetrics:         registerCounter(metricNameWithPrefix(prefix, "spool.dropped")),
+		SpoolReplayedMetrics:        registerCounter(metricNameWithPrefix(prefix, "spool.replayed")),
+		RelayQueueLen:               newPrefixedHistogramMap(prefix),
+		RelaySentMetrics:            newPrefixedMeterMap(prefix),
+		RelayDroppedMetrics:         newPrefixedMeterMap(prefix),
+		RulesMatchedMetrics:         newPrefixedMeterMap(prefix),
+		TLSClientConnections:        newPrefixedMeterMap(prefix),
+		TLSClientLines:              newPrefixedMeterMap(prefix),
 	}
 }
 
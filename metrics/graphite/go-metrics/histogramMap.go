@@ -0,0 +1,26 @@
+// nolint
+package metrics
+
+import (
+	"github.com/moira-alert/moira/metrics/graphite"
+)
+
+// HistogramMap is realization of metrics map of type Histogram
+type HistogramMap struct {
+	prefix  string
+	metrics map[string]*ExpDecayHistogram
+}
+
+// newPrefixedHistogramMap create empty Histogram map, paths of its histograms are prefixed with given prefix
+func newPrefixedHistogramMap(prefix string) *HistogramMap {
+	return &HistogramMap{prefix: prefix, metrics: make(map[string]*ExpDecayHistogram)}
+}
+
+func (metricsMap *HistogramMap) AddMetric(name, path string) {
+	metricsMap.metrics[name] = registerHistogram(metricNameWithPrefix(metricsMap.prefix, path))
+}
+
+func (metricsMap *HistogramMap) GetMetric(name string) (graphite.Histogram, bool) {
+	value, found := metricsMap.metrics[name]
+	return value, found
+}
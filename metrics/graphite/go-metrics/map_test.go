@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"testing"
+
+	goMetrics "github.com/rcrowley/go-metrics"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMeterMap(t *testing.T) {
+	Convey("Prefixed meter map should register metrics with its prefix", t, func() {
+		metricsMap := newPrefixedMeterMap("service")
+		metricsMap.AddMetric("rule", "rules.rule.matched")
+		_, found := metricsMap.GetMetric("rule")
+		So(found, ShouldBeTrue)
+		So(goMetrics.DefaultRegistry.Get("service.rules.rule.matched"), ShouldNotBeNil)
+		So(goMetrics.DefaultRegistry.Get("rules.rule.matched"), ShouldBeNil)
+	})
+
+	Convey("Meter map without prefix should register metrics with given paths", t, func() {
+		metricsMap := newMeterMap()
+		metricsMap.AddMetric("sender", "service.sender.sends_ok")
+		_, found := metricsMap.GetMetric("sender")
+		So(found, ShouldBeTrue)
+		So(goMetrics.DefaultRegistry.Get("service.sender.sends_ok"), ShouldNotBeNil)
+	})
+}
+
+func TestHistogramMap(t *testing.T) {
+	Convey("Prefixed histogram map should register histograms with its prefix", t, func() {
+		histogramsMap := newPrefixedHistogramMap("service")
+		histogramsMap.AddMetric("relay", "relay.relay.queue")
+		_, found := histogramsMap.GetMetric("relay")
+		So(found, ShouldBeTrue)
+		So(goMetrics.DefaultRegistry.Get("service.relay.relay.queue"), ShouldNotBeNil)
+		So(goMetrics.DefaultRegistry.Get("relay.relay.queue"), ShouldBeNil)
+	})
+}
@@ -7,15 +7,24 @@ import (
 
 // MeterMap is realization of metrics map of type Meter
 type MeterMap struct {
+	prefix  string
 	metrics map[string]Meter
 }
 
 // newMeterMap create empty Meter map
 func newMeterMap() *MeterMap {
-	return &MeterMap{make(map[string]Meter)}
+	return &MeterMap{metrics: make(map[string]Meter)}
+}
+
+// newPrefixedMeterMap create empty Meter map, paths of its metrics are prefixed with given prefix
+func newPrefixedMeterMap(prefix string) *MeterMap {
+	return &MeterMap{prefix: prefix, metrics: make(map[string]Meter)}
 }
 
 func (metricsMap *MeterMap) AddMetric(name, path string) {
+	if metricsMap.prefix != "" {
+		path = metricNameWithPrefix(metricsMap.prefix, path)
+	}
 	metricsMap.metrics[name] = *registerMeter(path)
 }
 
@@ -8,6 +8,12 @@ type MetricsMap interface {
 	GetMetric(name string) (Meter, bool)
 }
 
+// HistogramsMap implements histogram collection abstraction
+type HistogramsMap interface {
+	AddMetric(name, path string)
+	GetMetric(name string) (Histogram, bool)
+}
+
 // Meter count events to produce exponentially-weighted moving average rates
 // at one-, five-, and fifteen-minutes and a mean rate.
 type Meter interface {
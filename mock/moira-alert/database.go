@@ -243,6 +243,19 @@ func (mr *MockDatabaseMockRecorder) GetChecksUpdatesCount() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChecksUpdatesCount", reflect.TypeOf((*MockDatabase)(nil).GetChecksUpdatesCount))
 }
 
+// GetCompositeTriggerIDs mocks base method
+func (m *MockDatabase) GetCompositeTriggerIDs() ([]string, error) {
+	ret := m.ctrl.Call(m, "GetCompositeTriggerIDs")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCompositeTriggerIDs indicates an expected call of GetCompositeTriggerIDs
+func (mr *MockDatabaseMockRecorder) GetCompositeTriggerIDs() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCompositeTriggerIDs", reflect.TypeOf((*MockDatabase)(nil).GetCompositeTriggerIDs))
+}
+
 // GetContact mocks base method
 func (m *MockDatabase) GetContact(arg0 string) (moira.ContactData, error) {
 	ret := m.ctrl.Call(m, "GetContact", arg0)
@@ -282,6 +295,19 @@ func (mr *MockDatabaseMockRecorder) GetIDByUsername(arg0, arg1 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIDByUsername", reflect.TypeOf((*MockDatabase)(nil).GetIDByUsername), arg0, arg1)
 }
 
+// GetLimitedPatterns mocks base method
+func (m *MockDatabase) GetLimitedPatterns(arg0 []string) (map[string]int64, error) {
+	ret := m.ctrl.Call(m, "GetLimitedPatterns", arg0)
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLimitedPatterns indicates an expected call of GetLimitedPatterns
+func (mr *MockDatabaseMockRecorder) GetLimitedPatterns(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLimitedPatterns", reflect.TypeOf((*MockDatabase)(nil).GetLimitedPatterns), arg0)
+}
+
 // GetLocalTriggerIDs mocks base method
 func (m *MockDatabase) GetLocalTriggerIDs() ([]string, error) {
 	ret := m.ctrl.Call(m, "GetLocalTriggerIDs")
@@ -386,6 +412,20 @@ func (mr *MockDatabaseMockRecorder) GetNotifierState() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNotifierState", reflect.TypeOf((*MockDatabase)(nil).GetNotifierState))
 }
 
+// GetPatternChanges mocks base method
+func (m *MockDatabase) GetPatternChanges(arg0 int64) ([]*moira.PatternChange, int64, error) {
+	ret := m.ctrl.Call(m, "GetPatternChanges", arg0)
+	ret0, _ := ret[0].([]*moira.PatternChange)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetPatternChanges indicates an expected call of GetPatternChanges
+func (mr *MockDatabaseMockRecorder) GetPatternChanges(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPatternChanges", reflect.TypeOf((*MockDatabase)(nil).GetPatternChanges), arg0)
+}
+
 // GetPatternMetrics mocks base method
 func (m *MockDatabase) GetPatternMetrics(arg0 string) ([]string, error) {
 	ret := m.ctrl.Call(m, "GetPatternMetrics", arg0)
@@ -425,6 +465,32 @@ func (mr *MockDatabaseMockRecorder) GetPatterns() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPatterns", reflect.TypeOf((*MockDatabase)(nil).GetPatterns))
 }
 
+// GetPatternsMetricsCount mocks base method
+func (m *MockDatabase) GetPatternsMetricsCount(arg0 []string) (map[string]int64, error) {
+	ret := m.ctrl.Call(m, "GetPatternsMetricsCount", arg0)
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPatternsMetricsCount indicates an expected call of GetPatternsMetricsCount
+func (mr *MockDatabaseMockRecorder) GetPatternsMetricsCount(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPatternsMetricsCount", reflect.TypeOf((*MockDatabase)(nil).GetPatternsMetricsCount), arg0)
+}
+
+// GetPatternsVersion mocks base method
+func (m *MockDatabase) GetPatternsVersion() (int64, error) {
+	ret := m.ctrl.Call(m, "GetPatternsVersion")
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPatternsVersion indicates an expected call of GetPatternsVersion
+func (mr *MockDatabaseMockRecorder) GetPatternsVersion() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPatternsVersion", reflect.TypeOf((*MockDatabase)(nil).GetPatternsVersion))
+}
+
 // GetRemoteChecksUpdatesCount mocks base method
 func (m *MockDatabase) GetRemoteChecksUpdatesCount() (int64, error) {
 	ret := m.ctrl.Call(m, "GetRemoteChecksUpdatesCount")
@@ -529,6 +595,19 @@ func (mr *MockDatabaseMockRecorder) GetTagTriggerIDs(arg0 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTagTriggerIDs", reflect.TypeOf((*MockDatabase)(nil).GetTagTriggerIDs), arg0)
 }
 
+// GetTaggedMetrics mocks base method
+func (m *MockDatabase) GetTaggedMetrics(arg0 map[string]string) ([]string, error) {
+	ret := m.ctrl.Call(m, "GetTaggedMetrics", arg0)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTaggedMetrics indicates an expected call of GetTaggedMetrics
+func (mr *MockDatabaseMockRecorder) GetTaggedMetrics(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTaggedMetrics", reflect.TypeOf((*MockDatabase)(nil).GetTaggedMetrics), arg0)
+}
+
 // GetTagsSubscriptions mocks base method
 func (m *MockDatabase) GetTagsSubscriptions(arg0 []string) ([]*moira.SubscriptionData, error) {
 	ret := m.ctrl.Call(m, "GetTagsSubscriptions", arg0)
@@ -40,8 +40,9 @@ func BenchmarkProcessIncomingMetric(b *testing.B) {
 	database := mock_moira_alert.NewMockDatabase(mockCtrl)
 	logger, _ := logging.GetLogger("Benchmark")
 
+	database.EXPECT().GetPatternsVersion().Return(int64(0), nil)
 	database.EXPECT().GetPatterns().Return(patterns, nil)
-	patternsStorage, err := filter.NewPatternStorage(database, metrics2, logger)
+	patternsStorage, err := filter.NewPatternStorage(database, metrics2, logger, nil)
 	if err != nil {
 		b.Errorf("Can not create new cache storage %s", err)
 	}
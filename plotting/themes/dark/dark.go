@@ -1,6 +1,8 @@
 package dark
 
 import (
+	"strings"
+
 	"github.com/golang/freetype/truetype"
 
 	"github.com/wcharczuk/go-chart"
@@ -79,17 +81,23 @@ func (theme *PlotTheme) GetBackgroundStyle(maxMarkLen int) chart.Style {
 func (theme *PlotTheme) GetThresholdStyle(thresholdType string) chart.Style {
 	var thresholdColor string
 	switch thresholdType {
-	case "ERROR":
+	case "ERROR", "ERROR_RECOVER":
 		thresholdColor = `ed2e18`
-	case "WARN":
+	case "WARN", "WARN_RECOVER":
 		thresholdColor = `f79520`
 	}
-	return chart.Style{
+	style := chart.Style{
 		Show:        true,
 		StrokeWidth: 1,
 		StrokeColor: drawing.ColorFromHex(thresholdColor).WithAlpha(90),
 		FillColor:   drawing.ColorFromHex(thresholdColor).WithAlpha(20),
 	}
+	if strings.HasSuffix(thresholdType, "_RECOVER") {
+		// recover threshold is drawn as dashed line without fill to not overlap area of its threshold
+		style.StrokeDashArray = []float64{5, 5}
+		style.FillColor = drawing.ColorTransparent
+	}
+	return style
 }
 
 // GetAnnotationStyle returns annotation style
@@ -39,7 +39,7 @@ func newThreshold(triggerType, thresholdType string, thresholdValue, higherLimit
 // getThresholdSeriesList returns collection of thresholds and annotations
 func getThresholdSeriesList(trigger *moira.Trigger, theme moira.PlotTheme, limits plotLimits) []chart.Series {
 	thresholdSeriesList := make([]chart.Series, 0)
-	if trigger.TriggerType == moira.ExpressionTrigger {
+	if trigger.TriggerType == moira.ExpressionTrigger || trigger.TriggerType == moira.AnomalyTrigger {
 		return thresholdSeriesList
 	}
 	plotThresholds := generateThresholds(trigger, limits)
@@ -68,6 +68,15 @@ func generateThresholds(trigger *moira.Trigger, limits plotLimits) []*threshold
 		thresholds = append(thresholds, newThreshold(
 			trigger.TriggerType, "WARN", *trigger.WarnValue, limits.highest))
 	}
+	// Trigger has recover values and their thresholds can be drawn
+	if trigger.ErrorRecoverValue != nil && limits.formsSetContaining(*trigger.ErrorRecoverValue) {
+		thresholds = append(thresholds, newThreshold(
+			trigger.TriggerType, "ERROR_RECOVER", *trigger.ErrorRecoverValue, limits.highest))
+	}
+	if trigger.WarnRecoverValue != nil && limits.formsSetContaining(*trigger.WarnRecoverValue) {
+		thresholds = append(thresholds, newThreshold(
+			trigger.TriggerType, "WARN_RECOVER", *trigger.WarnRecoverValue, limits.highest))
+	}
 	//// Trigger has ERROR value and threshold can be drawn
 	//errThresholdRequied := trigger.ErrorValue != nil && limits.formsSetContaining(*trigger.ErrorValue)
 	//if errThresholdRequied {
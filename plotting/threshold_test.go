@@ -431,3 +431,38 @@ func TestGenerateThresholds(t *testing.T) {
 		})
 	}
 }
+
+// TestGenerateRecoverThresholds tests recover thresholds will be generated correctly
+func TestGenerateRecoverThresholds(t *testing.T) {
+	Convey("Recover thresholds are generated after trigger thresholds", t, func() {
+		warnValue, errorValue := float64(100), float64(200)
+		warnRecoverValue, errorRecoverValue := float64(80), float64(180)
+		trigger := moira.Trigger{
+			TriggerType:       moira.RisingTrigger,
+			WarnValue:         &warnValue,
+			ErrorValue:        &errorValue,
+			WarnRecoverValue:  &warnRecoverValue,
+			ErrorRecoverValue: &errorRecoverValue,
+		}
+		actual := generateThresholds(&trigger, innerNonNegativeTestCaseLimits)
+		So(actual, ShouldResemble, []*threshold{
+			{thresholdType: "ERROR", yCoordinate: 0},
+			{thresholdType: "WARN", yCoordinate: 100},
+			{thresholdType: "ERROR_RECOVER", yCoordinate: 20},
+			{thresholdType: "WARN_RECOVER", yCoordinate: 120},
+		})
+	})
+
+	Convey("Recover thresholds out of limits are not generated", t, func() {
+		warnValue, warnRecoverValue := float64(100), float64(-20)
+		trigger := moira.Trigger{
+			TriggerType:      moira.RisingTrigger,
+			WarnValue:        &warnValue,
+			WarnRecoverValue: &warnRecoverValue,
+		}
+		actual := generateThresholds(&trigger, innerNonNegativeTestCaseLimits)
+		So(actual, ShouldResemble, []*threshold{
+			{thresholdType: "WARN", yCoordinate: 100},
+		})
+	})
+}
@@ -0,0 +1,208 @@
+package tags
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SpecOperator is an operator of seriesByTag tag expression
+type SpecOperator string
+
+// Operators of seriesByTag tag expressions, see https://graphite.readthedocs.io/en/latest/tags.html#querying
+const (
+	EqualOperator    SpecOperator = "="
+	NotEqualOperator SpecOperator = "!="
+	MatchOperator    SpecOperator = "=~"
+	NotMatchOperator SpecOperator = "!=~"
+)
+
+// nameTag is a name of pseudo tag containing metric path of tagged series
+const nameTag = "name"
+
+const seriesByTagPrefix = "seriesByTag("
+
+// Spec is a single tag expression of seriesByTag pattern
+type Spec struct {
+	Name     string
+	Operator SpecOperator
+	Value    string
+	regexp   *regexp.Regexp
+}
+
+// IsSeriesByTag checks that pattern is seriesByTag expression
+func IsSeriesByTag(pattern string) bool {
+	return strings.HasPrefix(pattern, seriesByTagPrefix)
+}
+
+// ParseSeriesByTag parses seriesByTag('tag1=value1', 'tag2!=~value2') pattern into tag specs
+func ParseSeriesByTag(pattern string) ([]Spec, error) {
+	if !IsSeriesByTag(pattern) || !strings.HasSuffix(pattern, ")") {
+		return nil, fmt.Errorf("pattern is not a seriesByTag expression: %s", pattern)
+	}
+	args, err := splitSeriesByTagArgs(pattern[len(seriesByTagPrefix) : len(pattern)-1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", pattern, err.Error())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("seriesByTag has no tag expressions: %s", pattern)
+	}
+	specs := make([]Spec, 0, len(args))
+	hasNonEmptyMatch := false
+	for _, arg := range args {
+		spec, err := parseSpec(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %s", pattern, err.Error())
+		}
+		if !spec.Matches("") {
+			hasNonEmptyMatch = true
+		}
+		specs = append(specs, spec)
+	}
+	if !hasNonEmptyMatch {
+		return nil, fmt.Errorf("at least one tag expression of %s must not match empty value", pattern)
+	}
+	return specs, nil
+}
+
+// Matches checks that given tag value satisfies tag spec, absent tag has empty value
+func (spec *Spec) Matches(value string) bool {
+	switch spec.Operator {
+	case EqualOperator:
+		return value == spec.Value
+	case NotEqualOperator:
+		return value != spec.Value
+	case MatchOperator:
+		return spec.regexp.MatchString(value)
+	case NotMatchOperator:
+		return !spec.regexp.MatchString(value)
+	}
+	return false
+}
+
+// MatchSpecs checks that tagged series with given name and tags satisfies all tag specs
+func MatchSpecs(specs []Spec, name string, tags map[string]string) bool {
+	for i := range specs {
+		value := tags[specs[i].Name]
+		if specs[i].Name == nameTag {
+			value = name
+		}
+		if !specs[i].Matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetEqualityTags returns tags required to have exact values by given specs
+func GetEqualityTags(specs []Spec) map[string]string {
+	tags := make(map[string]string)
+	for _, spec := range specs {
+		if spec.Operator == EqualOperator && spec.Value != "" {
+			tags[spec.Name] = spec.Value
+		}
+	}
+	return tags
+}
+
+// ParseTaggedMetric parses graphite tagged series 'name;tag1=value1;tag2=value2'
+func ParseTaggedMetric(metric string) (string, map[string]string, error) {
+	parts := strings.Split(metric, ";")
+	name := parts[0]
+	if name == "" {
+		return "", nil, fmt.Errorf("tagged metric has empty name: '%s'", metric)
+	}
+	tags := make(map[string]string, len(parts)-1)
+	for _, part := range parts[1:] {
+		tagValue := strings.SplitN(part, "=", 2)
+		if len(tagValue) != 2 || tagValue[0] == "" || tagValue[1] == "" {
+			return "", nil, fmt.Errorf("invalid tag '%s' in metric: '%s'", part, metric)
+		}
+		if strings.ContainsAny(tagValue[0], "!~") {
+			return "", nil, fmt.Errorf("invalid tag name '%s' in metric: '%s'", tagValue[0], metric)
+		}
+		tags[tagValue[0]] = tagValue[1]
+	}
+	return name, tags, nil
+}
+
+// FormatTaggedMetric makes graphite tagged series name with tags sorted by their names
+func FormatTaggedMetric(name string, tags map[string]string) string {
+	tagNames := make([]string, 0, len(tags))
+	for tagName := range tags {
+		tagNames = append(tagNames, tagName)
+	}
+	sort.Strings(tagNames)
+	var builder strings.Builder
+	builder.WriteString(name)
+	for _, tagName := range tagNames {
+		builder.WriteString(";")
+		builder.WriteString(tagName)
+		builder.WriteString("=")
+		builder.WriteString(tags[tagName])
+	}
+	return builder.String()
+}
+
+func parseSpec(arg string) (Spec, error) {
+	operatorIndex := strings.IndexAny(arg, "!=")
+	if operatorIndex < 1 {
+		return Spec{}, fmt.Errorf("invalid tag expression '%s'", arg)
+	}
+	spec := Spec{Name: arg[:operatorIndex]}
+	rest := arg[operatorIndex:]
+	for _, operator := range []SpecOperator{NotMatchOperator, MatchOperator, NotEqualOperator, EqualOperator} {
+		if strings.HasPrefix(rest, string(operator)) {
+			spec.Operator = operator
+			spec.Value = rest[len(operator):]
+			break
+		}
+	}
+	if spec.Operator == "" {
+		return Spec{}, fmt.Errorf("invalid tag expression '%s'", arg)
+	}
+	if spec.Operator == MatchOperator || spec.Operator == NotMatchOperator {
+		// graphite matches tag values with python re.match, which is anchored at the beginning only
+		compiled, err := regexp.Compile("^(?:" + spec.Value + ")")
+		if err != nil {
+			return Spec{}, fmt.Errorf("invalid regular expression in tag expression '%s': %s", arg, err.Error())
+		}
+		spec.regexp = compiled
+	}
+	return spec, nil
+}
+
+// splitSeriesByTagArgs splits comma separated list of quoted strings
+func splitSeriesByTagArgs(rawArgs string) ([]string, error) {
+	args := make([]string, 0)
+	var quote byte
+	var current strings.Builder
+	expectComma := false
+	for i := 0; i < len(rawArgs); i++ {
+		c := rawArgs[i]
+		switch {
+		case quote != 0 && c == quote:
+			args = append(args, current.String())
+			current.Reset()
+			quote = 0
+			expectComma = true
+		case quote != 0:
+			current.WriteByte(c)
+		case c == ' ':
+		case c == ',' && expectComma:
+			expectComma = false
+		case (c == '\'' || c == '"') && !expectComma:
+			quote = c
+		default:
+			return nil, fmt.Errorf("unexpected character '%c' at position %d", c, i)
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string")
+	}
+	if len(args) > 0 && !expectComma {
+		return nil, fmt.Errorf("trailing comma")
+	}
+	return args, nil
+}
@@ -0,0 +1,92 @@
+package tags
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseSeriesByTag(t *testing.T) {
+	Convey("Given valid seriesByTag patterns, should parse tag specs", t, func() {
+		specs, err := ParseSeriesByTag("seriesByTag('name=cpu.load', \"dc!=x\", 'host=~a.*', 'rack!=~1,2')")
+		So(err, ShouldBeNil)
+		So(len(specs), ShouldEqual, 4)
+		So(specs[0].Name, ShouldEqual, "name")
+		So(specs[0].Operator, ShouldEqual, EqualOperator)
+		So(specs[0].Value, ShouldEqual, "cpu.load")
+		So(specs[1].Name, ShouldEqual, "dc")
+		So(specs[1].Operator, ShouldEqual, NotEqualOperator)
+		So(specs[1].Value, ShouldEqual, "x")
+		So(specs[2].Name, ShouldEqual, "host")
+		So(specs[2].Operator, ShouldEqual, MatchOperator)
+		So(specs[2].Value, ShouldEqual, "a.*")
+		So(specs[3].Name, ShouldEqual, "rack")
+		So(specs[3].Operator, ShouldEqual, NotMatchOperator)
+		So(specs[3].Value, ShouldEqual, "1,2")
+	})
+
+	Convey("Given invalid seriesByTag patterns, should return errors", t, func() {
+		invalidPatterns := []string{
+			"cpu.load",
+			"seriesByTag()",
+			"seriesByTag('name=cpu.load'",
+			"seriesByTag('name=cpu.load',)",
+			"seriesByTag('name=cpu.load' 'dc=x')",
+			"seriesByTag(name=cpu.load)",
+			"seriesByTag('name')",
+			"seriesByTag('=cpu.load')",
+			"seriesByTag('host=~(')",
+			"seriesByTag('dc!=x')",
+			"seriesByTag('dc=')",
+		}
+		for _, pattern := range invalidPatterns {
+			_, err := ParseSeriesByTag(pattern)
+			So(err, ShouldBeError)
+		}
+	})
+}
+
+func TestMatchTagSpecs(t *testing.T) {
+	specs, _ := ParseSeriesByTag("seriesByTag('name=cpu.load', 'dc!=x', 'host=~a')")
+
+	Convey("Should match series satisfying all tag expressions", t, func() {
+		So(MatchSpecs(specs, "cpu.load", map[string]string{"host": "a1", "dc": "y"}), ShouldBeTrue)
+		So(MatchSpecs(specs, "cpu.load", map[string]string{"host": "a1"}), ShouldBeTrue)
+	})
+
+	Convey("Should not match series violating any tag expression", t, func() {
+		So(MatchSpecs(specs, "cpu.idle", map[string]string{"host": "a1"}), ShouldBeFalse)
+		So(MatchSpecs(specs, "cpu.load", map[string]string{"host": "a1", "dc": "x"}), ShouldBeFalse)
+		So(MatchSpecs(specs, "cpu.load", map[string]string{"host": "ba1"}), ShouldBeFalse)
+		So(MatchSpecs(specs, "cpu.load", map[string]string{}), ShouldBeFalse)
+	})
+
+	Convey("Should return equality tags for tag index lookup", t, func() {
+		So(GetEqualityTags(specs), ShouldResemble, map[string]string{"name": "cpu.load"})
+	})
+}
+
+func TestParseTaggedMetric(t *testing.T) {
+	Convey("Given valid tagged metric, should parse name and tags", t, func() {
+		name, tags, err := ParseTaggedMetric("cpu.load;host=a;dc=x")
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, "cpu.load")
+		So(tags, ShouldResemble, map[string]string{"host": "a", "dc": "x"})
+		So(FormatTaggedMetric(name, tags), ShouldEqual, "cpu.load;dc=x;host=a")
+	})
+
+	Convey("Given invalid tagged metrics, should return errors", t, func() {
+		invalidMetrics := []string{
+			";host=a",
+			"cpu.load;",
+			"cpu.load;host",
+			"cpu.load;=a",
+			"cpu.load;host=",
+			"cpu.load;host!=a",
+		}
+		for _, metric := range invalidMetrics {
+			_, _, err := ParseTaggedMetric(metric)
+			So(err, ShouldBeError)
+		}
+	})
+}
@@ -2,15 +2,17 @@ package target
 
 import (
 	"math"
+	"sort"
 
 	"github.com/go-graphite/carbonapi/expr/types"
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
 	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/tags"
 )
 
 // FetchData gets values of given pattern metrics from given interval and returns values and all found pattern metrics
 func FetchData(database moira.Database, pattern string, from int64, until int64, allowRealTimeAlerting bool) ([]*types.MetricData, []string, error) {
-	metrics, err := database.GetPatternMetrics(pattern)
+	metrics, err := getPatternMetrics(database, pattern)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -38,6 +40,38 @@ func FetchData(database moira.Database, pattern string, from int64, until int64,
 	return metricsData, metrics, nil
 }
 
+// getPatternMetrics gets metrics by given pattern, metrics of seriesByTag pattern are found using tag index.
+// seriesByTag pattern without exact tag values can't use the index, so only metrics matched by filter are returned
+func getPatternMetrics(database moira.Database, pattern string) ([]string, error) {
+	if !tags.IsSeriesByTag(pattern) {
+		return database.GetPatternMetrics(pattern)
+	}
+	specs, err := tags.ParseSeriesByTag(pattern)
+	if err != nil {
+		return nil, err
+	}
+	equalityTags := tags.GetEqualityTags(specs)
+	if len(equalityTags) == 0 {
+		return database.GetPatternMetrics(pattern)
+	}
+	taggedMetrics, err := database.GetTaggedMetrics(equalityTags)
+	if err != nil {
+		return nil, err
+	}
+	metrics := make([]string, 0, len(taggedMetrics))
+	for _, metric := range taggedMetrics {
+		name, seriesTags, err := tags.ParseTaggedMetric(metric)
+		if err != nil {
+			continue
+		}
+		if tags.MatchSpecs(specs, name, seriesTags) {
+			metrics = append(metrics, metric)
+		}
+	}
+	sort.Strings(metrics)
+	return metrics, nil
+}
+
 func createMetricData(metric string, from int64, until int64, retention int64, values []float64) *types.MetricData {
 	fetchResponse := pb.FetchResponse{
 		Name:      metric,
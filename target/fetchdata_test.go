@@ -3,13 +3,18 @@ package target
 import (
 	"fmt"
 	"math"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/go-graphite/carbonapi/expr/types"
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
 	"github.com/golang/mock/gomock"
 	"github.com/moira-alert/moira"
+	"github.com/moira-alert/moira/filter"
+	"github.com/moira-alert/moira/metrics/graphite/go-metrics"
 	"github.com/moira-alert/moira/mock/moira-alert"
+	"github.com/op/go-logging"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -236,9 +241,195 @@ func TestFetchData(t *testing.T) {
 		So(err, ShouldBeNil)
 	})
 
+	Convey("Test seriesByTag pattern", t, func() {
+		seriesByTag := "seriesByTag('name=cpu.load', 'dc!=x', 'host=~a')"
+		taggedMetric := "cpu.load;dc=y;host=a1"
+		Convey("GetTaggedMetricsError", func() {
+			dataBase.EXPECT().GetTaggedMetrics(map[string]string{"name": "cpu.load"}).Return(nil, patternErr)
+			metricData, metrics, err := FetchData(dataBase, seriesByTag, from, until, true)
+			So(metricData, ShouldBeNil)
+			So(metrics, ShouldBeNil)
+			So(err, ShouldResemble, patternErr)
+		})
+		Convey("Should fetch only metrics matching all tag expressions", func() {
+			taggedMetrics := []string{"cpu.load;dc=x;host=a1", "cpu.load;dc=y;host=b1", taggedMetric}
+			dataBase.EXPECT().GetTaggedMetrics(map[string]string{"name": "cpu.load"}).Return(taggedMetrics, nil)
+			dataBase.EXPECT().GetMetricRetention(taggedMetric).Return(retention, nil)
+			dataBase.EXPECT().GetMetricsValues([]string{taggedMetric}, from, until).Return(map[string][]*moira.MetricValue{taggedMetric: dataList[metric]}, nil)
+			metricData, metrics, err := FetchData(dataBase, seriesByTag, from, until, true)
+			fetchResponse := pb.FetchResponse{
+				Name:      taggedMetric,
+				StartTime: from,
+				StopTime:  until,
+				StepTime:  retention,
+				Values:    []float64{0, 1, 2, 3, 4},
+			}
+			expected := &types.MetricData{FetchResponse: fetchResponse}
+			So(metricData, ShouldResemble, []*types.MetricData{expected})
+			So(metrics, ShouldResemble, []string{taggedMetric})
+			So(err, ShouldBeNil)
+		})
+		Convey("Without exact tag values should fetch metrics matched by filter", func() {
+			regexSeriesByTag := "seriesByTag('name=~cpu')"
+			dataBase.EXPECT().GetPatternMetrics(regexSeriesByTag).Return([]string{}, nil)
+			_, metrics, err := FetchData(dataBase, regexSeriesByTag, from, until, true)
+			So(metrics, ShouldBeEmpty)
+			So(err, ShouldBeNil)
+		})
+	})
+
 	mockCtrl.Finish()
 }
 
+// TestFetchDataGlobs checks that metrics matched by filter for graphite glob patterns are the same
+// as metrics fetched by checker when patterns are resolved over stored metrics the way graphite does
+func TestFetchDataGlobs(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dataBase := mock_moira_alert.NewMockDatabase(mockCtrl)
+	logger, _ := logging.GetLogger("FetchData")
+
+	testMetrics := []string{
+		"server-1.cpu.user",
+		"server-2.cpu.user",
+		"server-10.cpu.user",
+		"server-a.cpu.user",
+		"server-1.cpu.system",
+		"server-1.disk.sda",
+		"server-1.disk.sdb",
+		"server-1.disk.nvme0",
+		"db1.prod.requests",
+		"db2.prod.requests",
+		"db1.staging.requests",
+		"web.prod.errors",
+		"web.prod.errors.5xx",
+	}
+	patterns := []string{
+		"server-[0-9].cpu.user",
+		"server-[0-9]*.cpu.user",
+		"server-[!0-9].cpu.user",
+		"server-[!a-z]*.cpu.*",
+		"server-[12].cpu.{user,system}",
+		"server-1.disk.{sd[a-b],nvme*}",
+		"{db{1,2},web}.prod.{requests,errors}",
+		"{db{1,{2,3}},w?b}.*.{requests,err*}",
+		"db?.*.requests",
+		"web.prod.errors",
+		"web.prod.errors.*",
+		"*.*.*",
+		"server-[3-9].cpu.user",
+	}
+
+	dataBase.EXPECT().GetPatternsVersion().Return(int64(0), nil)
+	dataBase.EXPECT().GetPatterns().Return(patterns, nil)
+	patternStorage, err := filter.NewPatternStorage(dataBase, metrics.ConfigureFilterMetrics("test"), logger, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matchedByFilter := make(map[string][]string)
+	for _, metric := range testMetrics {
+		matched := patternStorage.ProcessIncomingMetric([]byte(metric + " 1 1234567890"))
+		if matched == nil {
+			continue
+		}
+		for _, pattern := range matched.Patterns {
+			matchedByFilter[pattern] = append(matchedByFilter[pattern], metric)
+		}
+	}
+
+	dataBase.EXPECT().GetPatternMetrics(gomock.Any()).DoAndReturn(func(pattern string) ([]string, error) {
+		return resolveGraphiteGlob(pattern, testMetrics), nil
+	}).AnyTimes()
+	dataBase.EXPECT().GetMetricRetention(gomock.Any()).Return(int64(60), nil).AnyTimes()
+	dataBase.EXPECT().GetMetricsValues(gomock.Any(), int64(0), int64(60)).Return(map[string][]*moira.MetricValue{}, nil).AnyTimes()
+
+	Convey("Metrics fetched by patterns should be the same as metrics matched by filter", t, func() {
+		for _, pattern := range patterns {
+			Convey(pattern, func() {
+				_, fetched, err := FetchData(dataBase, pattern, 0, 60, true)
+				So(err, ShouldBeNil)
+				if len(matchedByFilter[pattern]) == 0 {
+					So(fetched, ShouldBeEmpty)
+				} else {
+					So(fetched, ShouldResemble, matchedByFilter[pattern])
+				}
+			})
+		}
+	})
+}
+
+// resolveGraphiteGlob finds metrics matched by pattern like graphite-web finder does:
+// innermost braces are expanded first, then every node is matched with fnmatch rules
+func resolveGraphiteGlob(pattern string, metrics []string) []string {
+	globs := expandInnermostBraces(pattern)
+	resolved := make([]string, 0)
+	for _, metric := range metrics {
+		for _, glob := range globs {
+			if matchGraphiteNodes(strings.Split(glob, "."), strings.Split(metric, ".")) {
+				resolved = append(resolved, metric)
+				break
+			}
+		}
+	}
+	return resolved
+}
+
+var innermostBraces = regexp.MustCompile(`\{([^{}]*)\}`)
+
+func expandInnermostBraces(pattern string) []string {
+	location := innermostBraces.FindStringSubmatchIndex(pattern)
+	if location == nil {
+		return []string{pattern}
+	}
+	expanded := make([]string, 0)
+	for _, alternative := range strings.Split(pattern[location[2]:location[3]], ",") {
+		expanded = append(expanded, expandInnermostBraces(pattern[:location[0]]+alternative+pattern[location[1]:])...)
+	}
+	return expanded
+}
+
+func matchGraphiteNodes(globNodes, metricNodes []string) bool {
+	if len(globNodes) != len(metricNodes) {
+		return false
+	}
+	for i := range globNodes {
+		if !regexp.MustCompile(translateFnmatch(globNodes[i])).MatchString(metricNodes[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// translateFnmatch converts shell pattern to regexp like python fnmatch.translate
+func translateFnmatch(glob string) string {
+	var builder strings.Builder
+	builder.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '*':
+			builder.WriteString(".*")
+		case '?':
+			builder.WriteString(".")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				builder.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			builder.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			builder.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	builder.WriteString("$")
+	return builder.String()
+}
+
 func TestAllowRealTimeAlerting(t *testing.T) {
 	metricsValues := []*moira.MetricValue{
 		{
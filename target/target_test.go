@@ -141,6 +141,22 @@ func TestEvaluateTarget(t *testing.T) {
 		})
 	})
 
+	Convey("Test success evaluate seriesByTag target", t, func() {
+		seriesByTag := "seriesByTag('name=cpu.load', 'host!=b')"
+		taggedMetric1 := "cpu.load;dc=x;host=a"
+		taggedMetric2 := "cpu.load;dc=x;host=b"
+		taggedDataList := map[string][]*moira.MetricValue{taggedMetric1: dataList[metric]}
+		dataBase.EXPECT().GetTaggedMetrics(map[string]string{"name": "cpu.load"}).Return([]string{taggedMetric1, taggedMetric2}, nil)
+		dataBase.EXPECT().GetMetricRetention(taggedMetric1).Return(retention, nil)
+		dataBase.EXPECT().GetMetricsValues([]string{taggedMetric1}, from, until).Return(taggedDataList, nil)
+		result, err := EvaluateTarget(dataBase, fmt.Sprintf("scale(%s, 10)", seriesByTag), from, until, true)
+		So(err, ShouldBeNil)
+		So(result.Metrics, ShouldResemble, []string{taggedMetric1})
+		So(result.Patterns, ShouldResemble, []string{seriesByTag})
+		So(result.TimeSeries, ShouldHaveLength, 1)
+		So(result.TimeSeries[0].Values, ShouldResemble, []float64{0, 10, 20, 30, 40})
+	})
+
 	Convey("Test success evaluate pipe target", t, func() {
 		dataBase.EXPECT().GetPatternMetrics("super.puper.pattern").Return([]string{metric}, nil)
 		dataBase.EXPECT().GetMetricRetention(metric).Return(retention, nil)